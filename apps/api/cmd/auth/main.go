@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"encoding/base64"
 	"fmt"
 	"net/http"
 
@@ -13,8 +14,10 @@ import (
 	"github.com/kobayashiyabako16g/passkey-auth-example/internal/ui/router"
 	"github.com/kobayashiyabako16g/passkey-auth-example/internal/usecase"
 	"github.com/kobayashiyabako16g/passkey-auth-example/pkg/db"
+	"github.com/kobayashiyabako16g/passkey-auth-example/pkg/jws"
 	"github.com/kobayashiyabako16g/passkey-auth-example/pkg/kvstore"
 	"github.com/kobayashiyabako16g/passkey-auth-example/pkg/logger"
+	"github.com/kobayashiyabako16g/passkey-auth-example/pkg/mailer"
 )
 
 func main() {
@@ -33,6 +36,10 @@ func main() {
 	if err != nil {
 		panic(err)
 	}
+	mail, err := mailer.New(cfg.Mail)
+	if err != nil {
+		panic(err)
+	}
 
 	// webautn
 	wconfig := &webauthn.Config{
@@ -46,18 +53,111 @@ func main() {
 	}
 
 	// Repository
-	sessionRepository := repository.NewSession(kvClient)
+	sessionRepository := repository.NewSession(kvClient, cfg.Session.AbsoluteTimeout, cfg.Session.IdleTimeout)
+	ceremonyRepository := repository.NewCeremony(kvClient, cfg.Session.CeremonyTimeout)
 	userRepository := repository.NewUser(dbClient)
+	refreshTokenRepository := repository.NewRefreshToken(kvClient)
+
+	oauthClientRepository := repository.NewOAuthClient(dbClient)
+	authorizationRepository := repository.NewAuthorization(kvClient)
+	deviceGrantRepository := repository.NewDeviceGrant(kvClient)
+	qrLoginRepository := repository.NewQRLogin(kvClient)
+	recoveryCodeRepository := repository.NewRecoveryCode(dbClient)
+	auditRepository := repository.NewAudit(dbClient)
+	magicLinkRepository := repository.NewMagicLink(kvClient)
+	emailVerificationRepository := repository.NewEmailVerification(kvClient)
+	passwordRepository := repository.NewPassword(dbClient)
+	totpRepository := repository.NewTOTP(dbClient)
+	totpStateRepository := repository.NewTOTPState(kvClient)
+	loginAttemptRepository := repository.NewLoginAttempt(kvClient)
+	enrollmentTokenRepository := repository.NewEnrollmentToken(dbClient)
+
+	// Signing keys
+	keyManager, err := newKeyManager(ctx, cfg.SigningKey, dbClient)
+	if err != nil {
+		panic(err)
+	}
+	go keyManager.Run(ctx, cfg.SigningKey.CheckInterval)
+
+	tokenIssuer := usecase.NewTokenIssuer(refreshTokenRepository, keyManager, usecase.TokenOptions{
+		Issuer:          cfg.Token.Issuer,
+		AccessTokenTTL:  cfg.Token.AccessTokenTTL,
+		RefreshTokenTTL: cfg.Token.RefreshTokenTTL,
+	})
+
+	recoveryIssuer := usecase.NewRecoveryCodeIssuer(recoveryCodeRepository, auditRepository, []byte(cfg.RecoveryCode.LookupKey))
+	emailVerifier := usecase.NewEmailVerifier(emailVerificationRepository, auditRepository, mail, usecase.EmailVerificationOptions{
+		URL: cfg.EmailVerification.URL,
+		TTL: cfg.EmailVerification.TTL,
+	})
+
+	enrollmentLinks := usecase.NewEnrollmentLinks(enrollmentTokenRepository, auditRepository, usecase.EnrollmentOptions{
+		URL: cfg.Enrollment.URL,
+		TTL: cfg.Enrollment.TTL,
+	})
 
 	// Usecase
-	authUsecase := usecase.NewAuth(sessionRepository, userRepository, webAuthn)
+	authUsecase := usecase.NewAuth(sessionRepository, ceremonyRepository, userRepository, totpRepository, webAuthn, cfg.ClonePolicy, tokenIssuer, recoveryIssuer, emailVerifier, enrollmentLinks)
+	passkeyUsecase := usecase.NewPasskey(sessionRepository, ceremonyRepository, userRepository, passwordRepository, totpRepository, recoveryCodeRepository, auditRepository, webAuthn)
+	sessionUsecase := usecase.NewSession(sessionRepository, userRepository, refreshTokenRepository)
+	adminUsecase := usecase.NewAdmin(userRepository, oauthClientRepository, auditRepository, enrollmentLinks)
+	tokenUsecase := usecase.NewToken(refreshTokenRepository, userRepository, tokenIssuer)
+	oidcUsecase := usecase.NewOIDC(sessionRepository, userRepository, oauthClientRepository, authorizationRepository, deviceGrantRepository, keyManager, usecase.OIDCOptions{
+		Issuer:                cfg.Token.Issuer,
+		LoginURL:              cfg.OIDC.LoginURL,
+		RequestTTL:            cfg.OIDC.RequestTTL,
+		CodeTTL:               cfg.OIDC.CodeTTL,
+		AccessTokenTTL:        cfg.Token.AccessTokenTTL,
+		IDTokenTTL:            cfg.OIDC.IDTokenTTL,
+		SigningAlgorithms:     keyManager.Algorithms(),
+		DeviceVerificationURL: cfg.OIDC.DeviceVerificationURL,
+		DeviceCodeTTL:         cfg.OIDC.DeviceCodeTTL,
+		DevicePollInterval:    cfg.OIDC.DevicePollInterval,
+	})
+	accountUsecase := usecase.NewAccount(sessionRepository, userRepository, refreshTokenRepository)
+	qrLoginUsecase := usecase.NewQRLogin(sessionRepository, ceremonyRepository, userRepository, qrLoginRepository, webAuthn, usecase.QRLoginOptions{
+		ApproveURL:  cfg.QRLogin.ApproveURL,
+		TTL:         cfg.QRLogin.TTL,
+		WaitTimeout: cfg.QRLogin.WaitTimeout,
+	})
+	recoveryUsecase := usecase.NewRecovery(sessionRepository, userRepository, recoveryCodeRepository, loginAttemptRepository, auditRepository, recoveryIssuer)
+	magicLinkUsecase := usecase.NewMagicLink(sessionRepository, userRepository, magicLinkRepository, totpRepository, auditRepository, mail, usecase.MagicLinkOptions{
+		Enabled:    cfg.MagicLink.Enabled,
+		URL:        cfg.MagicLink.URL,
+		TTL:        cfg.MagicLink.TTL,
+		RateLimit:  cfg.MagicLink.RateLimit,
+		RateWindow: cfg.MagicLink.RateWindow,
+	})
+	passwordUsecase := usecase.NewPassword(sessionRepository, userRepository, passwordRepository, totpRepository, loginAttemptRepository, auditRepository)
+	totpUsecase := usecase.NewTOTP(sessionRepository, userRepository, totpRepository, totpStateRepository, auditRepository, usecase.TOTPOptions{
+		Issuer: cfg.TOTP.Issuer,
+	})
+	emailUsecase := usecase.NewEmail(ceremonyRepository, userRepository, emailVerificationRepository, auditRepository, webAuthn, emailVerifier)
 
 	mux := http.NewServeMux()
 	auth := handler.NewAuth(authUsecase)
-	rt := router.NewRouter(auth)
+	passkey := handler.NewPasskey(passkeyUsecase)
+	session := handler.NewSession(sessionUsecase, cfg.ForwardAuthLoginURL, cfg.ForwardAuthHosts)
+	admin := handler.NewAdmin(adminUsecase)
+	token := handler.NewToken(tokenUsecase)
+	wellKnown := handler.NewWellKnown(keyManager)
+	oidc := handler.NewOIDC(oidcUsecase)
+	qrLogin := handler.NewQRLogin(qrLoginUsecase)
+	account := handler.NewAccount(accountUsecase)
+	recovery := handler.NewRecovery(recoveryUsecase)
+	magicLink := handler.NewMagicLink(magicLinkUsecase)
+	email := handler.NewEmail(emailUsecase)
+	password := handler.NewPassword(passwordUsecase)
+	totp := handler.NewTOTP(totpUsecase)
+	rt := router.NewRouter(auth, passkey, session, admin, token, wellKnown, oidc, qrLogin, account, recovery, magicLink, email, password, totp,
+		middleware.RequireAuth(sessionRepository, userRepository),
+		middleware.RequireEnrollment(sessionRepository, userRepository),
+		middleware.RequireRecentAuth(cfg.Session.ReauthMaxAge),
+		middleware.RequireAdmin(cfg.AdminAPIKey))
 	rt.HandleRequest(mux)
 
 	server := middleware.CORSMiddleware(mux, cfg.AllowOrigin)
+	server = middleware.RealIPMiddleware(server, cfg.TrustedProxies)
 	server = middleware.LogMiddleware(server)
 	port := fmt.Sprintf(":%s", cfg.Port)
 	logger.Info(ctx, fmt.Sprintf("Starting server on port %s", port))
@@ -65,3 +165,28 @@ func main() {
 		panic(err)
 	}
 }
+
+// newKeyManager uses the keys in cfg.Dir if set, otherwise keys generated and rotated in the database.
+func newKeyManager(ctx context.Context, cfg config.SigningKeyConfig, dbClient *db.Client) (*jws.KeyManager, error) {
+	if cfg.Dir != "" {
+		keys, err := jws.LoadKeyDir(cfg.Dir)
+		if err != nil {
+			return nil, err
+		}
+		return jws.NewStaticKeyManager(keys)
+	}
+	encryptionKey, err := base64.StdEncoding.DecodeString(cfg.EncryptionKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid SIGNING_KEY_ENCRYPTION_KEY: %v", err)
+	}
+	store, err := repository.NewSigningKey(dbClient, encryptionKey)
+	if err != nil {
+		return nil, err
+	}
+	return jws.NewKeyManager(ctx, store, jws.KeyManagerOptions{
+		Algorithm:      cfg.Algorithm,
+		RotationPeriod: cfg.RotationPeriod,
+		PublishAhead:   cfg.PublishAhead,
+		RetainPeriod:   cfg.RetainPeriod,
+	})
+}
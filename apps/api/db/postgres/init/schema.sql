@@ -1,11 +1,146 @@
 CREATE TABLE IF NOT EXISTS users (
   id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
   name TEXT UNIQUE NOT NULL,
-  display_name TEXT NOT NULL
+  display_name TEXT NOT NULL,
+  -- Optional, lowercased. It identifies the user only once verified.
+  email TEXT,
+  email_verified_at TIMESTAMPTZ
 );
 
+-- Unverified addresses may be claimed by several users, verified ones by one.
+CREATE UNIQUE INDEX users_verified_email_idx ON users (email) WHERE email_verified_at IS NOT NULL;
+
 CREATE TABLE credentials (
     id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
-    user_id UUID REFERENCES users(id),
-    metadata JSONB NOT NULL
+    user_id UUID NOT NULL REFERENCES users(id),
+    name TEXT NOT NULL DEFAULT '',
+    credential_id BYTEA NOT NULL UNIQUE,
+    public_key BYTEA NOT NULL,
+    attestation_type TEXT NOT NULL DEFAULT '',
+    aaguid UUID NOT NULL DEFAULT '00000000-0000-0000-0000-000000000000',
+    sign_count BIGINT NOT NULL DEFAULT 0,
+    clone_warning BOOLEAN NOT NULL DEFAULT false,
+    attachment TEXT NOT NULL DEFAULT '',
+    transports TEXT[] NOT NULL DEFAULT '{}',
+    user_present BOOLEAN NOT NULL DEFAULT false,
+    user_verified BOOLEAN NOT NULL DEFAULT false,
+    backup_eligible BOOLEAN NOT NULL DEFAULT false,
+    backup_state BOOLEAN NOT NULL DEFAULT false,
+    attestation JSONB,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    last_used_at TIMESTAMPTZ,
+    quarantined_at TIMESTAMPTZ
+);
+
+CREATE INDEX credentials_user_id_idx ON credentials (user_id);
+CREATE INDEX credentials_aaguid_idx ON credentials (aaguid);
+
+CREATE TABLE credential_clone_events (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    credential_id UUID NOT NULL REFERENCES credentials(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id),
+    sign_count BIGINT NOT NULL,
+    policy TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX credential_clone_events_user_id_idx ON credential_clone_events (user_id);
+
+-- Signing keys for tokens. Private keys are stored as PKCS #8 DER, encrypted with
+-- AES-GCM under SIGNING_KEY_ENCRYPTION_KEY when encrypted is true.
+CREATE TABLE signing_keys (
+    kid TEXT PRIMARY KEY,
+    algorithm TEXT NOT NULL,
+    private_key BYTEA NOT NULL,
+    encrypted BOOLEAN NOT NULL DEFAULT false,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    retired_at TIMESTAMPTZ,
+    expires_at TIMESTAMPTZ
+);
+
+-- OpenID Connect clients. secret_hash is NULL for public clients.
+CREATE TABLE oauth_clients (
+    id TEXT PRIMARY KEY,
+    name TEXT NOT NULL,
+    secret_hash TEXT,
+    redirect_uris TEXT[] NOT NULL,
+    -- First-party APIs that introspect and revoke any session. They don't sign users in.
+    resource_server BOOLEAN NOT NULL DEFAULT false,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+-- Passwords of accounts migrated from the legacy system, as argon2id PHC strings.
+-- A password is deleted once the user has a passkey.
+CREATE TABLE password_credentials (
+    user_id UUID PRIMARY KEY REFERENCES users(id),
+    hash TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    last_used_at TIMESTAMPTZ
+);
+
+-- Authenticator app secrets. policy is recovery (sign in to enroll a new passkey)
+-- or second_factor (required after every login).
+CREATE TABLE totp_credentials (
+    user_id UUID PRIMARY KEY REFERENCES users(id),
+    secret BYTEA NOT NULL,
+    policy TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+-- One-time links for users provisioned by an administrator to register their first passkey.
+-- token_hash is the SHA-256 of the token in the link.
+CREATE TABLE enrollment_tokens (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id),
+    token_hash TEXT NOT NULL UNIQUE,
+    expires_at TIMESTAMPTZ NOT NULL,
+    used_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+-- Single-use recovery codes, hashed with bcrypt. used_at is set when a code is spent.
+-- lookup is a short keyed hash that selects the code to verify; older codes have none.
+CREATE TABLE recovery_codes (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id),
+    code_hash TEXT NOT NULL,
+    lookup TEXT,
+    used_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX recovery_codes_user_id_idx ON recovery_codes (user_id);
+
+-- Security-relevant events. user_id has no foreign key so events outlive deleted accounts.
+CREATE TABLE audit_events (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID,
+    event TEXT NOT NULL,
+    ip TEXT NOT NULL DEFAULT '',
+    user_agent TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
 );
+
+CREATE INDEX audit_events_user_id_idx ON audit_events (user_id, created_at);
+
+-- Migrations recorded by `make migratePostgres`. This schema already includes them,
+-- so a new migration is added here as well.
+CREATE TABLE schema_migrations (
+    version TEXT PRIMARY KEY,
+    applied_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+INSERT INTO schema_migrations (version) VALUES
+    ('001_normalize_credentials'),
+    ('002_clone_detection'),
+    ('003_signing_keys'),
+    ('004_oauth_clients'),
+    ('005_recovery_codes'),
+    ('006_user_email'),
+    ('007_email_verification'),
+    ('008_password_credentials'),
+    ('009_totp'),
+    ('010_enrollment_tokens'),
+    ('011_recovery_code_lookup'),
+    ('012_signing_key_encryption'),
+    ('013_resource_server_clients');
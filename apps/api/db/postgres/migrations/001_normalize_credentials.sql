@@ -0,0 +1,56 @@
+-- Converts the JSONB `metadata` credentials into real columns.
+-- The JSON document is a marshalled webauthn.Credential, so []byte fields are standard base64.
+-- A row that can't be decoded aborts the migration instead of being dropped silently.
+BEGIN;
+
+ALTER TABLE credentials
+    ADD COLUMN IF NOT EXISTS name TEXT NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    ADD COLUMN IF NOT EXISTS last_used_at TIMESTAMPTZ,
+    ADD COLUMN credential_id BYTEA,
+    ADD COLUMN public_key BYTEA,
+    ADD COLUMN attestation_type TEXT NOT NULL DEFAULT '',
+    ADD COLUMN aaguid UUID NOT NULL DEFAULT '00000000-0000-0000-0000-000000000000',
+    ADD COLUMN sign_count BIGINT NOT NULL DEFAULT 0,
+    ADD COLUMN clone_warning BOOLEAN NOT NULL DEFAULT false,
+    ADD COLUMN attachment TEXT NOT NULL DEFAULT '',
+    ADD COLUMN transports TEXT[] NOT NULL DEFAULT '{}',
+    ADD COLUMN user_present BOOLEAN NOT NULL DEFAULT false,
+    ADD COLUMN user_verified BOOLEAN NOT NULL DEFAULT false,
+    ADD COLUMN backup_eligible BOOLEAN NOT NULL DEFAULT false,
+    ADD COLUMN backup_state BOOLEAN NOT NULL DEFAULT false,
+    ADD COLUMN attestation JSONB;
+
+UPDATE credentials SET
+    credential_id = decode(metadata->>'id', 'base64'),
+    public_key = decode(metadata->>'publicKey', 'base64'),
+    attestation_type = COALESCE(metadata->>'attestationType', ''),
+    aaguid = COALESCE(
+        encode(decode(NULLIF(metadata->'authenticator'->>'AAGUID', ''), 'base64'), 'hex')::uuid,
+        '00000000-0000-0000-0000-000000000000'
+    ),
+    sign_count = COALESCE((metadata->'authenticator'->>'signCount')::bigint, 0),
+    clone_warning = COALESCE((metadata->'authenticator'->>'cloneWarning')::boolean, false),
+    attachment = COALESCE(metadata->'authenticator'->>'attachment', ''),
+    transports = CASE
+        WHEN jsonb_typeof(metadata->'transport') = 'array'
+            THEN ARRAY(SELECT jsonb_array_elements_text(metadata->'transport'))
+        ELSE '{}'
+    END,
+    user_present = COALESCE((metadata->'flags'->>'userPresent')::boolean, false),
+    user_verified = COALESCE((metadata->'flags'->>'userVerified')::boolean, false),
+    backup_eligible = COALESCE((metadata->'flags'->>'backupEligible')::boolean, false),
+    backup_state = COALESCE((metadata->'flags'->>'backupState')::boolean, false),
+    attestation = metadata->'attestation';
+
+ALTER TABLE credentials
+    ALTER COLUMN user_id SET NOT NULL,
+    ALTER COLUMN credential_id SET NOT NULL,
+    ALTER COLUMN public_key SET NOT NULL,
+    ADD CONSTRAINT credentials_credential_id_key UNIQUE (credential_id),
+    DROP COLUMN metadata;
+
+CREATE INDEX credentials_user_id_idx ON credentials (user_id);
+CREATE INDEX credentials_aaguid_idx ON credentials (aaguid);
+
+COMMIT;
@@ -0,0 +1,17 @@
+-- Records cloned-authenticator events and lets credentials be quarantined.
+BEGIN;
+
+ALTER TABLE credentials ADD COLUMN quarantined_at TIMESTAMPTZ;
+
+CREATE TABLE credential_clone_events (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    credential_id UUID NOT NULL REFERENCES credentials(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id),
+    sign_count BIGINT NOT NULL,
+    policy TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX credential_clone_events_user_id_idx ON credential_clone_events (user_id);
+
+COMMIT;
@@ -0,0 +1,13 @@
+-- Stores generated signing keys so that every instance signs with the same keys.
+BEGIN;
+
+CREATE TABLE signing_keys (
+    kid TEXT PRIMARY KEY,
+    algorithm TEXT NOT NULL,
+    private_key BYTEA NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    retired_at TIMESTAMPTZ,
+    expires_at TIMESTAMPTZ
+);
+
+COMMIT;
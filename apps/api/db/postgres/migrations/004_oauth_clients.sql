@@ -0,0 +1,12 @@
+-- Registers applications that sign users in through the OpenID Connect provider.
+BEGIN;
+
+CREATE TABLE oauth_clients (
+    id TEXT PRIMARY KEY,
+    name TEXT NOT NULL,
+    secret_hash TEXT,
+    redirect_uris TEXT[] NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+COMMIT;
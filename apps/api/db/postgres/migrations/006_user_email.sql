@@ -0,0 +1,6 @@
+-- Adds an optional email address to users for sign-in links.
+BEGIN;
+
+ALTER TABLE users ADD COLUMN email TEXT UNIQUE;
+
+COMMIT;
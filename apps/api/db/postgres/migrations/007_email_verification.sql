@@ -0,0 +1,10 @@
+-- Requires verification before an email address identifies a user.
+-- Existing addresses start unverified.
+BEGIN;
+
+ALTER TABLE users DROP CONSTRAINT users_email_key;
+ALTER TABLE users ADD COLUMN email_verified_at TIMESTAMPTZ;
+
+CREATE UNIQUE INDEX users_verified_email_idx ON users (email) WHERE email_verified_at IS NOT NULL;
+
+COMMIT;
@@ -0,0 +1,15 @@
+-- Adds passwords for accounts migrated from the legacy system.
+-- Import users with their argon2id hashes in the PHC string format, e.g.
+--   INSERT INTO users (name, display_name) VALUES ('alice', 'alice');
+--   INSERT INTO password_credentials (user_id, hash)
+--     SELECT id, '$argon2id$v=19$m=65536,t=3,p=4$...$...' FROM users WHERE name = 'alice';
+BEGIN;
+
+CREATE TABLE password_credentials (
+    user_id UUID PRIMARY KEY REFERENCES users(id),
+    hash TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    last_used_at TIMESTAMPTZ
+);
+
+COMMIT;
@@ -0,0 +1,11 @@
+-- Adds authenticator app (TOTP) secrets, used for recovery or as a second factor.
+BEGIN;
+
+CREATE TABLE totp_credentials (
+    user_id UUID PRIMARY KEY REFERENCES users(id),
+    secret BYTEA NOT NULL,
+    policy TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+COMMIT;
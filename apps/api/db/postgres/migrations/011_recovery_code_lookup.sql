@@ -0,0 +1,7 @@
+-- Adds a lookup to recovery codes so a login verifies one bcrypt hash instead of the whole set.
+-- Existing codes keep a NULL lookup and are still verified.
+BEGIN;
+
+ALTER TABLE recovery_codes ADD COLUMN lookup TEXT;
+
+COMMIT;
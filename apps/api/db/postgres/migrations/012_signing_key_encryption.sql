@@ -0,0 +1,7 @@
+-- Encrypts new signing keys at rest. Existing keys stay in plain text until they are
+-- rotated out; delete them to rotate right away.
+BEGIN;
+
+ALTER TABLE signing_keys ADD COLUMN encrypted BOOLEAN NOT NULL DEFAULT false;
+
+COMMIT;
@@ -0,0 +1,7 @@
+-- Marks first-party resource servers, which introspect and revoke any session
+-- but don't sign users in.
+BEGIN;
+
+ALTER TABLE oauth_clients ADD COLUMN resource_server BOOLEAN NOT NULL DEFAULT false;
+
+COMMIT;
@@ -1,21 +1,136 @@
 package config
 
 import (
+	"fmt"
+	"net/netip"
+	"time"
+
 	"github.com/caarlos0/env/v11"
+	"github.com/kobayashiyabako16g/passkey-auth-example/internal/domain/model"
 	"github.com/kobayashiyabako16g/passkey-auth-example/pkg/kvstore"
+	"github.com/kobayashiyabako16g/passkey-auth-example/pkg/mailer"
 )
 
 type Config struct {
-	Port                 string `env:"PORT" envDefault:"8080"`
-	AllowDomain          string `env:"ALLOW_DOMAIN" envDefault:"localhost"`
-	AllowOrigin          string `env:"ALLOW_ORIGIN" envDefault:"http://localhost:5173"`
+	Port                 string                  `env:"PORT" envDefault:"8080"`
+	AllowDomain          string                  `env:"ALLOW_DOMAIN" envDefault:"localhost"`
+	AllowOrigin          string                  `env:"ALLOW_ORIGIN" envDefault:"http://localhost:5173"`
+	ClonePolicy          model.ClonePolicy       `env:"CLONE_POLICY" envDefault:"reject"`
+	AdminAPIKey          string                  `env:"ADMIN_API_KEY"`
+	TrustedProxies       []netip.Prefix          `env:"TRUSTED_PROXIES"`
+	Session              SessionConfig           `envPrefix:"SESSION_"`
+	Token                TokenConfig             `envPrefix:"TOKEN_"`
+	SigningKey           SigningKeyConfig        `envPrefix:"SIGNING_KEY_"`
+	OIDC                 OIDCConfig              `envPrefix:"OIDC_"`
+	QRLogin              QRLoginConfig           `envPrefix:"QR_LOGIN_"`
+	MagicLink            MagicLinkConfig         `envPrefix:"MAGIC_LINK_"`
+	EmailVerification    EmailVerificationConfig `envPrefix:"EMAIL_VERIFICATION_"`
+	Mail                 mailer.Config           `envPrefix:"MAIL_"`
+	TOTP                 TOTPConfig              `envPrefix:"TOTP_"`
+	Enrollment           EnrollmentConfig        `envPrefix:"ENROLLMENT_"`
+	RecoveryCode         RecoveryCodeConfig      `envPrefix:"RECOVERY_CODE_"`
+	ForwardAuthLoginURL  string                  `env:"FORWARD_AUTH_LOGIN_URL" envDefault:"https://myserver.localhost/auth/signin"`
+	ForwardAuthHosts     []string                `env:"FORWARD_AUTH_HOSTS" envDefault:"myserver.localhost"`
 	kvstore.ValKeyConfig `envPrefix:"KV_"`
 }
 
+type SessionConfig struct {
+	AbsoluteTimeout time.Duration `env:"ABSOLUTE_TIMEOUT" envDefault:"24h"`
+	IdleTimeout     time.Duration `env:"IDLE_TIMEOUT" envDefault:"30m"`
+	CeremonyTimeout time.Duration `env:"CEREMONY_TIMEOUT" envDefault:"5m"`
+	// ReauthMaxAge is how long a user-verified authentication allows sensitive operations.
+	ReauthMaxAge time.Duration `env:"REAUTH_MAX_AGE" envDefault:"5m"`
+}
+
+// TokenConfig configures access tokens for services that can't read the session.
+type TokenConfig struct {
+	Issuer          string        `env:"ISSUER" envDefault:"https://myserver.localhost/api"`
+	AccessTokenTTL  time.Duration `env:"ACCESS_TTL" envDefault:"15m"`
+	RefreshTokenTTL time.Duration `env:"REFRESH_TTL" envDefault:"720h"`
+}
+
+// SigningKeyConfig configures the keys tokens are signed with.
+// Keys are generated and rotated unless Dir provides them.
+type SigningKeyConfig struct {
+	Dir            string        `env:"DIR"`
+	Algorithm      string        `env:"ALGORITHM" envDefault:"EdDSA"`
+	RotationPeriod time.Duration `env:"ROTATION_PERIOD" envDefault:"720h"`
+	PublishAhead   time.Duration `env:"PUBLISH_AHEAD" envDefault:"1h"`
+	RetainPeriod   time.Duration `env:"RETAIN_PERIOD" envDefault:"24h"`
+	CheckInterval  time.Duration `env:"CHECK_INTERVAL" envDefault:"10m"`
+	// EncryptionKey is a base64 AES key (32 bytes for AES-256) that encrypts generated keys in the database.
+	EncryptionKey string `env:"ENCRYPTION_KEY"`
+}
+
+// OIDCConfig configures the OpenID Connect provider. The issuer is TokenConfig.Issuer.
+type OIDCConfig struct {
+	LoginURL   string        `env:"LOGIN_URL" envDefault:"https://myserver.localhost/auth/signin"`
+	RequestTTL time.Duration `env:"REQUEST_TTL" envDefault:"10m"`
+	CodeTTL    time.Duration `env:"CODE_TTL" envDefault:"1m"`
+	IDTokenTTL time.Duration `env:"ID_TOKEN_TTL" envDefault:"1h"`
+	// DeviceVerificationURL is the frontend page where the user enters the code shown on a device.
+	DeviceVerificationURL string        `env:"DEVICE_VERIFICATION_URL" envDefault:"https://myserver.localhost/device"`
+	DeviceCodeTTL         time.Duration `env:"DEVICE_CODE_TTL" envDefault:"10m"`
+	DevicePollInterval    time.Duration `env:"DEVICE_POLL_INTERVAL" envDefault:"5s"`
+}
+
+// QRLoginConfig configures sign-in of a new browser approved on a signed-in device.
+type QRLoginConfig struct {
+	ApproveURL  string        `env:"APPROVE_URL" envDefault:"https://myserver.localhost/auth/qr"`
+	TTL         time.Duration `env:"TTL" envDefault:"2m"`
+	WaitTimeout time.Duration `env:"WAIT_TIMEOUT" envDefault:"25s"`
+}
+
+// MagicLinkConfig configures the optional sign-in link sent by email.
+type MagicLinkConfig struct {
+	Enabled    bool          `env:"ENABLED" envDefault:"false"`
+	URL        string        `env:"URL" envDefault:"https://myserver.localhost/auth/magic-link"`
+	TTL        time.Duration `env:"TTL" envDefault:"15m"`
+	RateLimit  int           `env:"RATE_LIMIT" envDefault:"3"`
+	RateWindow time.Duration `env:"RATE_WINDOW" envDefault:"1h"`
+}
+
+// EmailVerificationConfig configures the link that verifies an email address.
+type EmailVerificationConfig struct {
+	URL string        `env:"URL" envDefault:"https://myserver.localhost/auth/verify-email"`
+	TTL time.Duration `env:"TTL" envDefault:"24h"`
+}
+
+// TOTPConfig configures authenticator app codes.
+type TOTPConfig struct {
+	// Issuer is the account label shown in authenticator apps.
+	Issuer string `env:"ISSUER" envDefault:"Passkey Demo"`
+}
+
+// EnrollmentConfig configures the links that administrators issue to provisioned users.
+type EnrollmentConfig struct {
+	URL string        `env:"URL" envDefault:"https://myserver.localhost/auth/enroll"`
+	TTL time.Duration `env:"TTL" envDefault:"72h"`
+}
+
+// RecoveryCodeConfig configures recovery codes.
+type RecoveryCodeConfig struct {
+	// LookupKey keys the lookups that select the code to verify. Changing it makes
+	// the existing codes unusable, so users have to generate new ones.
+	LookupKey string `env:"LOOKUP_KEY"`
+}
+
 func NewConfig() (*Config, error) {
 	cfg, err := env.ParseAs[Config]()
 	if err != nil {
 		return nil, err
 	}
+	if !cfg.ClonePolicy.Valid() {
+		return nil, fmt.Errorf("invalid CLONE_POLICY: %s", cfg.ClonePolicy)
+	}
+	if cfg.RecoveryCode.LookupKey == "" {
+		return nil, fmt.Errorf("RECOVERY_CODE_LOOKUP_KEY is required")
+	}
+	if cfg.SigningKey.Dir == "" && cfg.SigningKey.EncryptionKey == "" {
+		return nil, fmt.Errorf("SIGNING_KEY_ENCRYPTION_KEY is required unless SIGNING_KEY_DIR is set")
+	}
+	if cfg.SigningKey.RetainPeriod < max(cfg.Token.AccessTokenTTL, cfg.OIDC.IDTokenTTL) {
+		return nil, fmt.Errorf("SIGNING_KEY_RETAIN_PERIOD must be at least TOKEN_ACCESS_TTL and OIDC_ID_TOKEN_TTL")
+	}
 	return &cfg, nil
 }
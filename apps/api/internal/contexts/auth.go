@@ -0,0 +1,33 @@
+package contexts
+
+import (
+	"context"
+
+	"github.com/kobayashiyabako16g/passkey-auth-example/internal/domain/model"
+)
+
+type userKey struct{}
+
+type sessionKey struct{}
+
+func SetUser(ctx context.Context, user *model.User) context.Context {
+	return context.WithValue(ctx, userKey{}, user)
+}
+
+func GetUser(ctx context.Context) *model.User {
+	if user, ok := ctx.Value(userKey{}).(*model.User); ok {
+		return user
+	}
+	return nil
+}
+
+func SetSession(ctx context.Context, session *model.Session) context.Context {
+	return context.WithValue(ctx, sessionKey{}, session)
+}
+
+func GetSession(ctx context.Context) *model.Session {
+	if session, ok := ctx.Value(sessionKey{}).(*model.Session); ok {
+		return session
+	}
+	return nil
+}
@@ -4,6 +4,8 @@ import "context"
 
 type requestIDKey struct{}
 
+type clientIPKey struct{}
+
 func SetRequestID(ctx context.Context, reqID string) context.Context {
 	return context.WithValue(ctx, requestIDKey{}, reqID)
 }
@@ -14,3 +16,14 @@ func GetRequestID(ctx context.Context) string {
 	}
 	return ""
 }
+
+func SetClientIP(ctx context.Context, ip string) context.Context {
+	return context.WithValue(ctx, clientIPKey{}, ip)
+}
+
+func GetClientIP(ctx context.Context) string {
+	if ip, ok := ctx.Value(clientIPKey{}).(string); ok {
+		return ip
+	}
+	return ""
+}
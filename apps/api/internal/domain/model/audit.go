@@ -0,0 +1,34 @@
+package model
+
+import "time"
+
+type AuditEventType string
+
+const (
+	AuditRecoveryCodesGenerated AuditEventType = "recovery_codes_generated"
+	AuditRecoveryCodeUsed       AuditEventType = "recovery_code_used"
+	AuditRecoveryCodeFailed     AuditEventType = "recovery_code_failed"
+	AuditMagicLinkSent          AuditEventType = "magic_link_sent"
+	AuditMagicLinkUsed          AuditEventType = "magic_link_used"
+	AuditEmailVerificationSent  AuditEventType = "email_verification_sent"
+	AuditEmailVerified          AuditEventType = "email_verified"
+	AuditPasswordLogin          AuditEventType = "password_login"
+	AuditPasswordLoginFailed    AuditEventType = "password_login_failed"
+	AuditPasswordRetired        AuditEventType = "password_retired"
+	AuditTOTPEnabled            AuditEventType = "totp_enabled"
+	AuditTOTPDisabled           AuditEventType = "totp_disabled"
+	AuditTOTPUsed               AuditEventType = "totp_used"
+	AuditTOTPFailed             AuditEventType = "totp_failed"
+	AuditEnrollmentLinkIssued   AuditEventType = "enrollment_link_issued"
+	AuditEnrollmentLinkUsed     AuditEventType = "enrollment_link_used"
+)
+
+// AuditEvent records a security-relevant action on an account.
+type AuditEvent struct {
+	ID        string
+	UserID    string
+	Event     AuditEventType
+	IP        string
+	UserAgent string
+	CreatedAt time.Time
+}
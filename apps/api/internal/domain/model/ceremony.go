@@ -0,0 +1,21 @@
+package model
+
+import (
+	"time"
+
+	"github.com/go-webauthn/webauthn/webauthn"
+)
+
+// Ceremony holds the state of a WebAuthn ceremony between its start and finish requests.
+type Ceremony struct {
+	ID                 string
+	Username           string                `json:"username"`
+	UserID             string                `json:"user_id,omitempty"`
+	Email              string                `json:"email,omitempty"`
+	StepUpUserID       string                `json:"step_up_user_id,omitempty"`
+	EnrollmentID       string                `json:"enrollment_id,omitempty"`
+	QRLoginCode        string                `json:"qr_login_code,omitempty"`
+	RegistrationData   *webauthn.SessionData `json:"registration_data,omitempty"`
+	AuthenticationData *webauthn.SessionData `json:"authentication_data,omitempty"`
+	ExpiresAt          time.Time             `json:"expires_at"`
+}
@@ -0,0 +1,72 @@
+package model
+
+import (
+	"time"
+
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/google/uuid"
+)
+
+// ClonePolicy decides what happens when an authenticator reports a sign count that went backwards.
+type ClonePolicy string
+
+const (
+	// ClonePolicyReject fails the login. The credential stays usable.
+	ClonePolicyReject ClonePolicy = "reject"
+	// ClonePolicyFlag allows the login and flags the credential.
+	ClonePolicyFlag ClonePolicy = "flag"
+	// ClonePolicyStepUp quarantines the credential and requires a login with another credential.
+	ClonePolicyStepUp ClonePolicy = "step_up"
+)
+
+func (p ClonePolicy) Valid() bool {
+	switch p {
+	case ClonePolicyReject, ClonePolicyFlag, ClonePolicyStepUp:
+		return true
+	}
+	return false
+}
+
+// Credential is a passkey registered to a user together with its management data.
+type Credential struct {
+	ID            string
+	UserID        string
+	Name          string
+	Credential    webauthn.Credential
+	CreatedAt     time.Time
+	LastUsedAt    *time.Time
+	QuarantinedAt *time.Time
+	CloneEvents   []CloneEvent
+}
+
+// CloneEvent records a login where the sign count suggested a cloned authenticator.
+type CloneEvent struct {
+	ID           string
+	CredentialID string
+	SignCount    uint32
+	Policy       ClonePolicy
+	CreatedAt    time.Time
+}
+
+// Quarantined reports whether the credential is excluded from logins.
+func (c *Credential) Quarantined() bool {
+	return c.QuarantinedAt != nil
+}
+
+// AAGUID returns the authenticator model identifier in its textual form.
+func (c *Credential) AAGUID() string {
+	aaguid, err := uuid.FromBytes(c.Credential.Authenticator.AAGUID)
+	if err != nil {
+		return uuid.Nil.String()
+	}
+	return aaguid.String()
+}
+
+// Transports returns the transports reported by the authenticator.
+func (c *Credential) Transports() []string {
+	transports := make([]string, 0, len(c.Credential.Transport))
+	for _, t := range c.Credential.Transport {
+		transports = append(transports, string(t))
+	}
+	return transports
+}
@@ -0,0 +1,60 @@
+package model
+
+import (
+	"strings"
+	"time"
+)
+
+// DeviceGrantStatus is the state of a device authorization (RFC 8628).
+type DeviceGrantStatus string
+
+const (
+	DeviceGrantPending  DeviceGrantStatus = "pending"
+	DeviceGrantApproved DeviceGrantStatus = "approved"
+	DeviceGrantDenied   DeviceGrantStatus = "denied"
+)
+
+// DeviceGrant is a device authorization waiting for the user to approve it on another device.
+type DeviceGrant struct {
+	// DeviceCode is only known to the device, which polls the token endpoint with it.
+	DeviceCode string            `json:"-"`
+	UserCode   string            `json:"user_code"`
+	ClientID   string            `json:"client_id"`
+	Scope      []string          `json:"scope"`
+	Status     DeviceGrantStatus `json:"status"`
+	// UserID, AMR and AuthTime are set by the approving session.
+	UserID    string    `json:"user_id,omitempty"`
+	AMR       []string  `json:"amr,omitempty"`
+	AuthTime  time.Time `json:"auth_time,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+	// Interval is the minimum polling interval. It grows each time the device polls too fast.
+	// The device updates these while the user approves the grant, so they are stored apart.
+	Interval     time.Duration `json:"-"`
+	LastPolledAt time.Time     `json:"-"`
+}
+
+// UserCodeAlphabet has no vowels, so user codes don't spell words, and no look-alike characters.
+const UserCodeAlphabet = "BCDFGHJKLMNPQRSTVWXZ"
+
+// UserCodeLength is the number of characters in a user code, without the separator.
+const UserCodeLength = 8
+
+// NormalizeUserCode uppercases the code typed by the user and drops separators.
+func NormalizeUserCode(code string) string {
+	code = strings.ToUpper(code)
+	return strings.Map(func(r rune) rune {
+		if r == '-' || r == ' ' {
+			return -1
+		}
+		return r
+	}, code)
+}
+
+// FormatUserCode shows a normalized user code as XXXX-XXXX.
+func FormatUserCode(code string) string {
+	if len(code) != UserCodeLength {
+		return code
+	}
+	return code[:UserCodeLength/2] + "-" + code[UserCodeLength/2:]
+}
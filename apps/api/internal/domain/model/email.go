@@ -0,0 +1,28 @@
+package model
+
+import (
+	"net/mail"
+	"strings"
+	"time"
+)
+
+// NormalizeEmail accepts a bare address such as "alice@example.com" and lowercases it,
+// so addresses can be compared and looked up. Display names and angle brackets are rejected.
+func NormalizeEmail(email string) (string, bool) {
+	email = strings.TrimSpace(email)
+	addr, err := mail.ParseAddress(email)
+	if err != nil || addr.Name != "" || addr.Address != email {
+		return "", false
+	}
+	return strings.ToLower(addr.Address), true
+}
+
+// EmailVerification proves that the user can read mail sent to the address.
+// The address becomes the user's verified email when the token is used.
+type EmailVerification struct {
+	// Token is only known to the recipient. The store keeps its hash.
+	Token     string    `json:"-"`
+	UserID    string    `json:"user_id"`
+	Email     string    `json:"email"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
@@ -0,0 +1,13 @@
+package model
+
+import "time"
+
+// EnrollmentToken lets a user provisioned by an administrator register their first passkey.
+type EnrollmentToken struct {
+	ID string
+	// Token is only known to the recipient of the link. The database keeps its hash.
+	Token     string
+	UserID    string
+	ExpiresAt time.Time
+	CreatedAt time.Time
+}
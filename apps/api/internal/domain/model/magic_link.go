@@ -0,0 +1,12 @@
+package model
+
+import "time"
+
+// MagicLink is a single-use sign-in link sent to the email address of a user.
+type MagicLink struct {
+	// Token is only known to the recipient. The store keeps its hash.
+	Token     string    `json:"-"`
+	UserID    string    `json:"user_id"`
+	Email     string    `json:"email"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
@@ -0,0 +1,123 @@
+package model
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// PasswordCredential is the password of an account migrated from the legacy system.
+// It's retired once the user has a passkey.
+type PasswordCredential struct {
+	UserID string
+	// Hash is argon2id in the PHC string format, e.g.
+	// $argon2id$v=19$m=65536,t=3,p=4$<salt>$<hash> with unpadded standard base64.
+	Hash       string
+	CreatedAt  time.Time
+	LastUsedAt *time.Time
+}
+
+// Argon2Params are the argon2id parameters of a hash.
+type Argon2Params struct {
+	Memory  uint32 // KiB
+	Time    uint32
+	Threads uint8
+	SaltLen uint32
+	KeyLen  uint32
+}
+
+// DefaultArgon2Params is the second recommended option of RFC 9106.
+var DefaultArgon2Params = Argon2Params{
+	Memory:  64 * 1024,
+	Time:    3,
+	Threads: 4,
+	SaltLen: 16,
+	KeyLen:  32,
+}
+
+// MaxArgon2Params bound the parameters of a stored hash, so a bad imported row
+// can't make a verification allocate unbounded memory or run forever.
+var MaxArgon2Params = Argon2Params{
+	Memory:  256 * 1024,
+	Time:    10,
+	Threads: 16,
+	SaltLen: 64,
+	KeyLen:  64,
+}
+
+// HashPassword hashes a password with argon2id and DefaultArgon2Params.
+func HashPassword(password string) (string, error) {
+	p := DefaultArgon2Params
+	salt := make([]byte, p.SaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key := argon2.IDKey([]byte(password), salt, p.Time, p.Memory, p.Threads, p.KeyLen)
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, p.Memory, p.Time, p.Threads,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+// Verify compares a password with the stored hash in constant time.
+func (c *PasswordCredential) Verify(password string) (bool, error) {
+	p, salt, key, err := decodeArgon2Hash(c.Hash)
+	if err != nil {
+		return false, err
+	}
+	actual := argon2.IDKey([]byte(password), salt, p.Time, p.Memory, p.Threads, p.KeyLen)
+	return subtle.ConstantTimeCompare(key, actual) == 1, nil
+}
+
+// NeedsRehash reports whether the hash was made with other parameters than DefaultArgon2Params,
+// as imported hashes may be.
+func (c *PasswordCredential) NeedsRehash() bool {
+	p, _, _, err := decodeArgon2Hash(c.Hash)
+	if err != nil {
+		return true
+	}
+	return p != DefaultArgon2Params
+}
+
+func decodeArgon2Hash(hash string) (Argon2Params, []byte, []byte, error) {
+	var p Argon2Params
+	// "", "argon2id", "v=19", "m=...,t=...,p=...", salt, key
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[0] != "" || parts[1] != "argon2id" {
+		return p, nil, nil, fmt.Errorf("not an argon2id hash")
+	}
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return p, nil, nil, fmt.Errorf("unsupported argon2 version: %s", parts[2])
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.Memory, &p.Time, &p.Threads); err != nil {
+		return p, nil, nil, fmt.Errorf("invalid argon2 parameters: %v", err)
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return p, nil, nil, fmt.Errorf("invalid argon2 salt: %v", err)
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return p, nil, nil, fmt.Errorf("invalid argon2 key")
+	}
+	p.SaltLen = uint32(len(salt))
+	p.KeyLen = uint32(len(key))
+	if !p.withinLimits() {
+		return p, nil, nil, fmt.Errorf("argon2 parameters out of range: m=%d,t=%d,p=%d", p.Memory, p.Time, p.Threads)
+	}
+	return p, salt, key, nil
+}
+
+func (p Argon2Params) withinLimits() bool {
+	m := MaxArgon2Params
+	return p.Memory > 0 && p.Memory <= m.Memory &&
+		p.Time > 0 && p.Time <= m.Time &&
+		p.Threads > 0 && p.Threads <= m.Threads &&
+		p.SaltLen <= m.SaltLen && p.KeyLen <= m.KeyLen
+}
@@ -0,0 +1,77 @@
+package model
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// testArgon2Hash hashes with small parameters to keep the tests fast.
+func testArgon2Hash(password string, params string) string {
+	salt := []byte("0123456789abcdef")
+	key := argon2.IDKey([]byte(password), salt, 1, 8, 1, 32)
+	return "$argon2id$v=19$" + params + "$" +
+		base64.RawStdEncoding.EncodeToString(salt) + "$" +
+		base64.RawStdEncoding.EncodeToString(key)
+}
+
+func TestPasswordVerify(t *testing.T) {
+	c := &PasswordCredential{Hash: testArgon2Hash("correct horse", "m=8,t=1,p=1")}
+
+	if ok, err := c.Verify("correct horse"); err != nil || !ok {
+		t.Errorf("Verify(correct) = %v, %v, want true", ok, err)
+	}
+	if ok, err := c.Verify("battery staple"); err != nil || ok {
+		t.Errorf("Verify(wrong) = %v, %v, want false", ok, err)
+	}
+}
+
+func TestPasswordVerifyMalformedHash(t *testing.T) {
+	valid := testArgon2Hash("correct horse", "m=8,t=1,p=1")
+	parts := strings.Split(valid, "$")
+	salt, key := parts[4], parts[5]
+	replace := func(i int, value string) string {
+		p := append([]string{}, parts...)
+		p[i] = value
+		return strings.Join(p, "$")
+	}
+
+	tests := []struct {
+		name string
+		hash string
+	}{
+		{"empty", ""},
+		{"bcrypt", "$2b$10$N9qo8uLOickgx2ZMRZoMyeIjZAgcfl7p92ldGxad68LJZdL17lhWy"},
+		{"argon2i", replace(1, "argon2i")},
+		{"missing key", strings.Join(parts[:5], "$")},
+		{"extra field", valid + "$" + key},
+		{"no leading dollar", strings.TrimPrefix(valid, "$")},
+		{"old version", replace(2, "v=16")},
+		{"garbage version", replace(2, "version")},
+		{"garbage parameters", replace(3, "m=x,t=1,p=1")},
+		{"missing parameter", replace(3, "m=8,t=1")},
+		{"zero memory", replace(3, "m=0,t=1,p=1")},
+		{"too much memory", replace(3, "m=4194304,t=1,p=1")},
+		{"zero time", replace(3, "m=8,t=0,p=1")},
+		{"too many passes", replace(3, "m=8,t=1000,p=1")},
+		{"zero threads", replace(3, "m=8,t=1,p=0")},
+		{"too many threads", replace(3, "m=8,t=1,p=255")},
+		{"salt not base64", replace(4, "!!!!")},
+		{"padded salt", replace(4, salt+"==")},
+		{"salt too long", replace(4, base64.RawStdEncoding.EncodeToString(make([]byte, 65)))},
+		{"key not base64", replace(5, "!!!!")},
+		{"empty key", replace(5, "")},
+		{"key too long", replace(5, base64.RawStdEncoding.EncodeToString(make([]byte, 65)))},
+	}
+	for _, tt := range tests {
+		c := &PasswordCredential{Hash: tt.hash}
+		if ok, err := c.Verify("correct horse"); err == nil || ok {
+			t.Errorf("%s: Verify = %v, %v, want an error", tt.name, ok, err)
+		}
+		if !c.NeedsRehash() {
+			t.Errorf("%s: NeedsRehash = false, want true", tt.name)
+		}
+	}
+}
@@ -0,0 +1,34 @@
+package model
+
+import (
+	"time"
+
+	"github.com/kobayashiyabako16g/passkey-auth-example/pkg/useragent"
+)
+
+type QRLoginStatus string
+
+const (
+	QRLoginPending  QRLoginStatus = "pending"
+	QRLoginApproved QRLoginStatus = "approved"
+)
+
+// QRLogin is a sign-in request from a new browser, approved on a device that is already signed in.
+type QRLogin struct {
+	// ID is only known to the new browser, which waits for the approval with it.
+	ID string `json:"-"`
+	// Code is shown as a QR code and as text on the new browser.
+	Code   string        `json:"code"`
+	Status QRLoginStatus `json:"status"`
+	// IP, UserAgent and Device describe the new browser to the approving user.
+	IP        string          `json:"ip"`
+	UserAgent string          `json:"user_agent"`
+	Device    useragent.Agent `json:"device"`
+	// UserID and the rest are set by the passkey assertion that approved the request.
+	UserID       string    `json:"user_id,omitempty"`
+	CredentialID string    `json:"credential_id,omitempty"`
+	UserVerified bool      `json:"user_verified,omitempty"`
+	AMR          []string  `json:"amr,omitempty"`
+	CreatedAt    time.Time `json:"created_at"`
+	ExpiresAt    time.Time `json:"expires_at"`
+}
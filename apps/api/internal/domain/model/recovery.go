@@ -0,0 +1,63 @@
+package model
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	// RecoveryCodeCount is the number of codes in a set.
+	RecoveryCodeCount = 10
+	// RecoveryCodeLength is the number of characters of a code, without the separator.
+	RecoveryCodeLength = 10
+	// recoveryCodeLookupLength is the number of bytes of the lookup. It's short so that
+	// the lookup doesn't shortcut guessing the bcrypt hashes even if the key leaks.
+	recoveryCodeLookupLength = 2
+)
+
+// RecoveryCode is a single-use code that signs the user in when every passkey is lost.
+// Only the bcrypt hash is stored; the codes are shown once when they are generated.
+type RecoveryCode struct {
+	ID       string
+	UserID   string
+	CodeHash string
+	// Lookup selects the code to verify, so a login checks one hash instead of the whole set.
+	// Codes generated before it was introduced have none.
+	Lookup    string
+	UsedAt    *time.Time
+	CreatedAt time.Time
+}
+
+// HashRecoveryCode hashes a normalized code with bcrypt. Codes are short enough to be
+// guessed offline with a fast hash.
+func HashRecoveryCode(code string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(code), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// RecoveryCodeLookup derives the lookup of a normalized code with a server-side key.
+func RecoveryCodeLookup(key []byte, userID string, code string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(userID + ":" + code))
+	return hex.EncodeToString(mac.Sum(nil)[:recoveryCodeLookupLength])
+}
+
+// Verify compares a normalized code with the stored hash.
+func (c *RecoveryCode) Verify(code string) bool {
+	return bcrypt.CompareHashAndPassword([]byte(c.CodeHash), []byte(code)) == nil
+}
+
+// FormatRecoveryCode shows a normalized code as XXXXX-XXXXX.
+func FormatRecoveryCode(code string) string {
+	if len(code) != RecoveryCodeLength {
+		return code
+	}
+	return code[:RecoveryCodeLength/2] + "-" + code[RecoveryCodeLength/2:]
+}
@@ -1,16 +1,82 @@
 package model
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"slices"
 	"time"
 
-	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/kobayashiyabako16g/passkey-auth-example/pkg/useragent"
 )
 
+// Session is an authenticated session issued after a successful ceremony.
 type Session struct {
-	ID                 string
-	Username           string                `json:"username"`
-	Authenticated      bool                  `json:"authenticated"`
-	RegistrationData   *webauthn.SessionData `json:"registration_data,omitempty"`
-	AuthenticationData *webauthn.SessionData `json:"authentication_data,omitempty"`
-	ExpiresAt          time.Time             `json:"expires_at"`
+	ID            string
+	UserID        string `json:"user_id"`
+	Username      string `json:"username"`
+	Authenticated bool   `json:"authenticated"`
+	// EnrollmentRequired marks a session from a recovery code or a TOTP recovery.
+	// It isn't authenticated and only allows registering a new passkey.
+	EnrollmentRequired bool `json:"enrollment_required,omitempty"`
+	// SecondFactorRequired marks a login that isn't authenticated until a TOTP code is verified.
+	SecondFactorRequired bool            `json:"second_factor_required,omitempty"`
+	CredentialID         string          `json:"credential_id,omitempty"`
+	AuthTime             time.Time       `json:"auth_time"`
+	UserVerified         bool            `json:"user_verified"`
+	AMR                  []string        `json:"amr,omitempty"`
+	IP                   string          `json:"ip"`
+	UserAgent            string          `json:"user_agent"`
+	Device               useragent.Agent `json:"device"`
+	CreatedAt            time.Time       `json:"created_at"`
+	LastSeenAt           time.Time       `json:"last_seen_at"`
+	IdleExpiresAt        time.Time       `json:"idle_expires_at"`
+	ExpiresAt            time.Time       `json:"expires_at"`
+	// ClientIDs are the OIDC clients the user authorized with this session.
+	// Only they may introspect and revoke it.
+	ClientIDs []string `json:"client_ids,omitempty"`
+}
+
+// SessionInfo describes how and from where a session is created.
+type SessionInfo struct {
+	// CredentialID is the ID of the credential row used to sign in.
+	CredentialID string
+	// UserVerified reports whether the authenticator verified the user (PIN, biometrics).
+	UserVerified bool
+	// AMR lists the authentication methods (RFC 8176).
+	AMR       []string
+	IP        string
+	UserAgent string
+	// EnrollmentRequired creates a session that must register a passkey first.
+	EnrollmentRequired bool
+	// SecondFactorRequired creates a session that must verify a TOTP code first.
+	SecondFactorRequired bool
+}
+
+// Info returns how the session was created, to issue a session with the same login.
+func (s *Session) Info() SessionInfo {
+	return SessionInfo{
+		CredentialID:         s.CredentialID,
+		UserVerified:         s.UserVerified,
+		AMR:                  s.AMR,
+		IP:                   s.IP,
+		UserAgent:            s.UserAgent,
+		EnrollmentRequired:   s.EnrollmentRequired,
+		SecondFactorRequired: s.SecondFactorRequired,
+	}
+}
+
+// IssuedTo reports whether the client was authorized with the session.
+func (s *Session) IssuedTo(clientID string) bool {
+	return slices.Contains(s.ClientIDs, clientID)
+}
+
+// Expired reports whether the absolute or the idle timeout has passed.
+func (s *Session) Expired(now time.Time) bool {
+	return !now.Before(s.ExpiresAt) || !now.Before(s.IdleExpiresAt)
+}
+
+// PublicID identifies the session in listings without revealing the session ID itself.
+func (s *Session) PublicID() string {
+	sum := sha256.Sum256([]byte(s.ID))
+	return hex.EncodeToString(sum[:16])
 }
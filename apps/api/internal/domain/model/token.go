@@ -0,0 +1,42 @@
+package model
+
+import "time"
+
+// RefreshToken is an opaque token exchanged for a new access token.
+// Tokens rotated from one login share a family and are revoked together.
+type RefreshToken struct {
+	Token        string    `json:"-"`
+	FamilyID     string    `json:"family_id"`
+	UserID       string    `json:"user_id"`
+	CredentialID string    `json:"credential_id,omitempty"`
+	AMR          []string  `json:"amr"`
+	AuthTime     time.Time `json:"auth_time"`
+	// ExpiresAt is fixed at login and isn't extended by rotation.
+	ExpiresAt time.Time `json:"expires_at"`
+	// SessionID binds a new family to the session of the login, so that logging out revokes it.
+	SessionID string `json:"-"`
+}
+
+// Authentication method references (RFC 8176) for passkeys.
+const (
+	// AMRHardwareKey is a device-bound passkey.
+	AMRHardwareKey = "hwk"
+	// AMRSoftwareKey is a synced passkey, whose key can leave the authenticator.
+	AMRSoftwareKey = "swk"
+	// AMRRecoveryCode is a one-time recovery code. RFC 8176 has no value for it.
+	AMRRecoveryCode = "rc"
+	// AMROTP is a one-time password, as defined by RFC 8176.
+	AMROTP = "otp"
+	// AMRPassword is a password, as defined by RFC 8176.
+	AMRPassword = "pwd"
+	// AMREmail is a sign-in link sent by email. RFC 8176 has no value for it.
+	AMREmail = "email"
+)
+
+// AMR returns the authentication method references for a passkey assertion.
+func AMR(backupEligible bool) []string {
+	if backupEligible {
+		return []string{AMRSoftwareKey}
+	}
+	return []string{AMRHardwareKey}
+}
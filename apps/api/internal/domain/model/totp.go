@@ -0,0 +1,32 @@
+package model
+
+import "time"
+
+// TOTPPolicy chooses what a TOTP authenticator is used for.
+type TOTPPolicy string
+
+const (
+	// TOTPPolicyRecovery signs in without a passkey, like a recovery code.
+	// The session only allows registering a new passkey.
+	TOTPPolicyRecovery TOTPPolicy = "recovery"
+	// TOTPPolicySecondFactor requires a code after every passkey or password login.
+	TOTPPolicySecondFactor TOTPPolicy = "second_factor"
+)
+
+func (p TOTPPolicy) Valid() bool {
+	switch p {
+	case TOTPPolicyRecovery, TOTPPolicySecondFactor:
+		return true
+	default:
+		return false
+	}
+}
+
+// TOTPCredential is a confirmed TOTP authenticator of a user.
+// The secret has to be kept as is to compute the codes.
+type TOTPCredential struct {
+	UserID    string
+	Secret    []byte
+	Policy    TOTPPolicy
+	CreatedAt time.Time
+}
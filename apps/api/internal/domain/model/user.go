@@ -10,10 +10,14 @@ import (
 
 // implements: https://pkg.go.dev/github.com/go-webauthn/webauthn/webauthn#User
 type User struct {
-	ID          string                `json:"id"`
-	Name        string                `json:"name"`
-	DisplayName string                `json:"displayName"`
-	Credentials []webauthn.Credential `json:"credentials"`
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	DisplayName string `json:"displayName"`
+	// Email is optional and normalized with NormalizeEmail.
+	// Only a verified address identifies the user.
+	Email         string                `json:"email,omitempty"`
+	EmailVerified bool                  `json:"emailVerified,omitempty"`
+	Credentials   []webauthn.Credential `json:"credentials"`
 }
 
 func NewUser(name string, displayName string) *User {
@@ -0,0 +1,81 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/kobayashiyabako16g/passkey-auth-example/internal/domain/model"
+	"github.com/kobayashiyabako16g/passkey-auth-example/pkg/db"
+	"github.com/kobayashiyabako16g/passkey-auth-example/pkg/logger"
+)
+
+// Audit is an append-only log of security-relevant events.
+type Audit interface {
+	Record(ctx context.Context, event *model.AuditEvent) error
+	// ListByUserID returns the latest events of the user, newest first.
+	ListByUserID(ctx context.Context, userID string, limit int) ([]model.AuditEvent, error)
+}
+
+type auditRepository struct {
+	db *db.Client
+}
+
+func NewAudit(db *db.Client) Audit {
+	return &auditRepository{
+		db: db,
+	}
+}
+
+func (r *auditRepository) Record(ctx context.Context, event *model.AuditEvent) error {
+	stmt, err := r.db.PrepareContext(ctx, "INSERT INTO audit_events (user_id, event, ip, user_agent) VALUES ($1, $2, $3, $4) RETURNING id, created_at")
+	if err != nil {
+		logger.Error(ctx, "Database Error", logger.WithError(err))
+		return err
+	}
+	defer stmt.Close()
+
+	userID := sql.NullString{String: event.UserID, Valid: event.UserID != ""}
+	if err := stmt.QueryRowContext(ctx, userID, string(event.Event), event.IP, event.UserAgent).Scan(&event.ID, &event.CreatedAt); err != nil {
+		logger.Error(ctx, "Database Error", logger.WithError(err))
+		return err
+	}
+
+	return nil
+}
+
+func (r *auditRepository) ListByUserID(ctx context.Context, userID string, limit int) ([]model.AuditEvent, error) {
+	stmt, err := r.db.PrepareContext(ctx, "SELECT id, user_id, event, ip, user_agent, created_at FROM audit_events WHERE user_id = $1 ORDER BY created_at DESC LIMIT $2")
+	if err != nil {
+		logger.Error(ctx, "Database Error", logger.WithError(err))
+		return nil, err
+	}
+	defer stmt.Close()
+
+	rows, err := stmt.QueryContext(ctx, userID, limit)
+	if err != nil {
+		logger.Error(ctx, "Database Error", logger.WithError(err))
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []model.AuditEvent{}
+	for rows.Next() {
+		var (
+			event     model.AuditEvent
+			eventType string
+		)
+		if err := rows.Scan(&event.ID, &event.UserID, &eventType, &event.IP, &event.UserAgent, &event.CreatedAt); err != nil {
+			logger.Error(ctx, "Database Error", logger.WithError(err))
+			return nil, err
+		}
+		event.Event = model.AuditEventType(eventType)
+		events = append(events, event)
+	}
+
+	if err := rows.Err(); err != nil {
+		logger.Error(ctx, "Database Rows Error", logger.WithError(err))
+		return nil, err
+	}
+
+	return events, nil
+}
@@ -0,0 +1,121 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/kobayashiyabako16g/passkey-auth-example/internal/domain/model"
+	"github.com/kobayashiyabako16g/passkey-auth-example/pkg/kvstore"
+	"github.com/kobayashiyabako16g/passkey-auth-example/pkg/random"
+)
+
+// Authorization stores the short-lived state of the authorization code flow.
+type Authorization interface {
+	SaveRequest(ctx context.Context, request *model.AuthorizationRequest) error
+	// ConsumeRequest returns the request at most once.
+	ConsumeRequest(ctx context.Context, id string) (*model.AuthorizationRequest, error)
+	CreateCode(ctx context.Context, code *model.AuthorizationCode) error
+	// ConsumeCode returns the code at most once.
+	ConsumeCode(ctx context.Context, raw string) (*model.AuthorizationCode, error)
+}
+
+type authorizationImpl struct {
+	client kvstore.Client
+}
+
+func NewAuthorization(client kvstore.Client) Authorization {
+	return &authorizationImpl{client}
+}
+
+// SaveRequest assigns a random ID to a new request.
+func (a *authorizationImpl) SaveRequest(ctx context.Context, request *model.AuthorizationRequest) error {
+	if request.ID == "" {
+		id, err := random.Token(32)
+		if err != nil {
+			return err
+		}
+		request.ID = id
+	}
+
+	data, err := json.Marshal(request)
+	if err != nil {
+		return fmt.Errorf("failed to marshal authorization request: %v", err)
+	}
+	ttl := int64(time.Until(request.ExpiresAt).Seconds())
+	if ttl <= 0 {
+		return fmt.Errorf("authorization request already expired")
+	}
+	return a.client.Set(ctx, a.getRequestKey(request.ID), string(data), kvstore.SetOptions{Expiration: ttl})
+}
+
+func (a *authorizationImpl) ConsumeRequest(ctx context.Context, id string) (*model.AuthorizationRequest, error) {
+	if id == "" {
+		return nil, nil
+	}
+	data, err := a.client.GetDel(ctx, a.getRequestKey(id))
+	if err != nil {
+		return nil, err
+	}
+	if data == "" {
+		return nil, nil
+	}
+
+	var request model.AuthorizationRequest
+	if err := json.Unmarshal([]byte(data), &request); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal authorization request: %v", err)
+	}
+	request.ID = id
+	return &request, nil
+}
+
+func (a *authorizationImpl) CreateCode(ctx context.Context, code *model.AuthorizationCode) error {
+	raw, err := random.Token(32)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(code)
+	if err != nil {
+		return fmt.Errorf("failed to marshal authorization code: %v", err)
+	}
+	ttl := int64(time.Until(code.ExpiresAt).Seconds())
+	if ttl <= 0 {
+		return fmt.Errorf("authorization code already expired")
+	}
+	if err := a.client.Set(ctx, a.getCodeKey(raw), string(data), kvstore.SetOptions{Expiration: ttl}); err != nil {
+		return err
+	}
+
+	code.Code = raw
+	return nil
+}
+
+func (a *authorizationImpl) ConsumeCode(ctx context.Context, raw string) (*model.AuthorizationCode, error) {
+	if raw == "" {
+		return nil, nil
+	}
+	data, err := a.client.GetDel(ctx, a.getCodeKey(raw))
+	if err != nil {
+		return nil, err
+	}
+	if data == "" {
+		return nil, nil
+	}
+
+	var code model.AuthorizationCode
+	if err := json.Unmarshal([]byte(data), &code); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal authorization code: %v", err)
+	}
+	code.Code = raw
+	return &code, nil
+}
+
+func (a *authorizationImpl) getRequestKey(id string) string {
+	return fmt.Sprintf("oauth_request:%s", id)
+}
+
+func (a *authorizationImpl) getCodeKey(raw string) string {
+	return fmt.Sprintf("oauth_code:%s", hashToken(raw))
+}
@@ -0,0 +1,111 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/kobayashiyabako16g/passkey-auth-example/internal/domain/model"
+	"github.com/kobayashiyabako16g/passkey-auth-example/pkg/kvstore"
+	"github.com/kobayashiyabako16g/passkey-auth-example/pkg/logger"
+	"github.com/kobayashiyabako16g/passkey-auth-example/pkg/random"
+)
+
+type Ceremony interface {
+	Create(ctx context.Context) (*model.Ceremony, error)
+	Save(ctx context.Context, ceremony *model.Ceremony) error
+	Get(ctx context.Context, id string) (*model.Ceremony, error)
+	// Consume returns the ceremony at most once, so concurrent finish requests can't replay it.
+	Consume(ctx context.Context, id string) (*model.Ceremony, error)
+	Delete(ctx context.Context, ceremony *model.Ceremony) error
+}
+
+type ceremonyImpl struct {
+	client  kvstore.Client
+	timeout time.Duration
+}
+
+func NewCeremony(client kvstore.Client, timeout time.Duration) Ceremony {
+	return &ceremonyImpl{client, timeout}
+}
+
+func (c *ceremonyImpl) Create(ctx context.Context) (*model.Ceremony, error) {
+	id, err := random.Token(32)
+	if err != nil {
+		return nil, err
+	}
+
+	ceremony := &model.Ceremony{
+		ID:        id,
+		ExpiresAt: time.Now().Add(c.timeout),
+	}
+
+	if err := c.Save(ctx, ceremony); err != nil {
+		return nil, err
+	}
+
+	return ceremony, nil
+}
+
+func (c *ceremonyImpl) Save(ctx context.Context, ceremony *model.Ceremony) error {
+	key := c.getKey(ceremony.ID)
+	data, err := json.Marshal(ceremony)
+	if err != nil {
+		return fmt.Errorf("failed to marshal ceremony: %v", err)
+	}
+
+	// Calculate TTL in seconds
+	ttl := int64(time.Until(ceremony.ExpiresAt).Seconds())
+	if ttl <= 0 {
+		return fmt.Errorf("ceremony already expired")
+	}
+
+	return c.client.Set(ctx, key, string(data), kvstore.SetOptions{Expiration: ttl})
+}
+
+func (c *ceremonyImpl) Get(ctx context.Context, id string) (*model.Ceremony, error) {
+	if id == "" {
+		return nil, nil
+	}
+	key := c.getKey(id)
+	logger.Debug(ctx, fmt.Sprintf("Get ceremony with ID %s", key))
+	data, err := c.client.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	return c.decode(data)
+}
+
+func (c *ceremonyImpl) Consume(ctx context.Context, id string) (*model.Ceremony, error) {
+	if id == "" {
+		return nil, nil
+	}
+	key := c.getKey(id)
+	logger.Debug(ctx, fmt.Sprintf("Consume ceremony with ID %s", key))
+	data, err := c.client.GetDel(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	return c.decode(data)
+}
+
+func (c *ceremonyImpl) decode(data string) (*model.Ceremony, error) {
+	if data == "" {
+		return nil, nil
+	}
+
+	var ceremony model.Ceremony
+	if err := json.Unmarshal([]byte(data), &ceremony); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal ceremony: %v", err)
+	}
+	return &ceremony, nil
+}
+
+func (c *ceremonyImpl) Delete(ctx context.Context, ceremony *model.Ceremony) error {
+	return c.client.Delete(ctx, c.getKey(ceremony.ID))
+}
+
+func (c *ceremonyImpl) getKey(id string) string {
+	return fmt.Sprintf("ceremony:%s", id)
+}
@@ -0,0 +1,435 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/kobayashiyabako16g/passkey-auth-example/internal/domain/model"
+	"github.com/kobayashiyabako16g/passkey-auth-example/pkg/logger"
+)
+
+// credentialColumns is the column list read by scanCredential.
+const credentialColumns = `id, user_id, name, credential_id, public_key, attestation_type, aaguid,
+	sign_count, clone_warning, attachment, transports,
+	user_present, user_verified, backup_eligible, backup_state,
+	attestation, created_at, last_used_at, quarantined_at`
+
+func (r *userRepository) AddCredential(ctx context.Context, userID string, credential *webauthn.Credential) error {
+	return addCredential(ctx, r.db, userID, credential)
+}
+
+// preparer is satisfied by both *sql.DB and *sql.Tx.
+type preparer interface {
+	PrepareContext(ctx context.Context, query string) (*sql.Stmt, error)
+}
+
+func addCredential(ctx context.Context, db preparer, userID string, credential *webauthn.Credential) error {
+	aaguid, err := uuid.FromBytes(credential.Authenticator.AAGUID)
+	if err != nil {
+		aaguid = uuid.Nil
+	}
+
+	attestation, err := json.Marshal(credential.Attestation)
+	if err != nil {
+		logger.Error(ctx, "JSON Marshal Error", logger.WithError(err))
+		return err
+	}
+
+	transports := make([]string, 0, len(credential.Transport))
+	for _, t := range credential.Transport {
+		transports = append(transports, string(t))
+	}
+
+	stmt, err := db.PrepareContext(ctx, `INSERT INTO credentials (
+		user_id, credential_id, public_key, attestation_type, aaguid,
+		sign_count, clone_warning, attachment, transports,
+		user_present, user_verified, backup_eligible, backup_state, attestation
+	) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)`)
+	if err != nil {
+		logger.Error(ctx, "Database Error", logger.WithError(err))
+		return err
+	}
+	defer stmt.Close()
+
+	res, err := stmt.ExecContext(ctx,
+		userID,
+		credential.ID,
+		credential.PublicKey,
+		credential.AttestationType,
+		aaguid.String(),
+		int64(credential.Authenticator.SignCount),
+		credential.Authenticator.CloneWarning,
+		string(credential.Authenticator.Attachment),
+		transports,
+		credential.Flags.UserPresent,
+		credential.Flags.UserVerified,
+		credential.Flags.BackupEligible,
+		credential.Flags.BackupState,
+		attestation,
+	)
+	if err != nil {
+		logger.Error(ctx, "Database Error", logger.WithError(err))
+		return err
+	}
+
+	row, err := res.RowsAffected()
+	if err != nil {
+		logger.Error(ctx, "Database Error", logger.WithError(err))
+		return err
+	}
+
+	logger.Debug(ctx, fmt.Sprintf("Last Insert credential: %v", row))
+
+	return nil
+}
+
+// UpdateCredential records the authenticator state returned by a successful assertion.
+func (r *userRepository) UpdateCredential(ctx context.Context, userID string, credential *webauthn.Credential) error {
+	stmt, err := r.db.PrepareContext(ctx, `UPDATE credentials SET
+		sign_count = $1, clone_warning = clone_warning OR $2,
+		user_present = $3, user_verified = $4, backup_eligible = $5, backup_state = $6,
+		last_used_at = now()
+	WHERE user_id = $7 AND credential_id = $8`)
+	if err != nil {
+		logger.Error(ctx, "Database Error", logger.WithError(err))
+		return err
+	}
+	defer stmt.Close()
+
+	res, err := stmt.ExecContext(ctx,
+		int64(credential.Authenticator.SignCount),
+		credential.Authenticator.CloneWarning,
+		credential.Flags.UserPresent,
+		credential.Flags.UserVerified,
+		credential.Flags.BackupEligible,
+		credential.Flags.BackupState,
+		userID,
+		credential.ID,
+	)
+	if err != nil {
+		logger.Error(ctx, "Database Error", logger.WithError(err))
+		return err
+	}
+
+	row, err := res.RowsAffected()
+	if err != nil {
+		logger.Error(ctx, "Database Error", logger.WithError(err))
+		return err
+	}
+	if row == 0 {
+		return fmt.Errorf("credential not found")
+	}
+
+	return nil
+}
+
+func (r *userRepository) ListCredentials(ctx context.Context, userID string) ([]model.Credential, error) {
+	stmt, err := r.db.PrepareContext(ctx, "SELECT "+credentialColumns+" FROM credentials WHERE user_id = $1 ORDER BY created_at")
+	if err != nil {
+		logger.Error(ctx, "Database Error", logger.WithError(err))
+		return nil, err
+	}
+	defer stmt.Close()
+
+	rows, err := stmt.QueryContext(ctx, userID)
+	if err != nil {
+		logger.Error(ctx, "Database Error", logger.WithError(err))
+		return nil, err
+	}
+	defer rows.Close()
+
+	credentials := []model.Credential{}
+	for rows.Next() {
+		credential, err := scanCredential(rows)
+		if err != nil {
+			logger.Error(ctx, "Database Error", logger.WithError(err))
+			return nil, err
+		}
+		credentials = append(credentials, *credential)
+	}
+
+	if err := rows.Err(); err != nil {
+		logger.Error(ctx, "Database Rows Error", logger.WithError(err))
+		return nil, err
+	}
+
+	events, err := r.listCloneEvents(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range credentials {
+		credentials[i].CloneEvents = events[credentials[i].ID]
+	}
+
+	return credentials, nil
+}
+
+func (r *userRepository) FindCredential(ctx context.Context, userID string, id string) (*model.Credential, error) {
+	stmt, err := r.db.PrepareContext(ctx, "SELECT "+credentialColumns+" FROM credentials WHERE user_id = $1 AND id = $2")
+	if err != nil {
+		logger.Error(ctx, "Database Error", logger.WithError(err))
+		return nil, err
+	}
+	defer stmt.Close()
+
+	credential, err := scanCredential(stmt.QueryRowContext(ctx, userID, id))
+	if err != nil {
+		//Not found
+		if err == sql.ErrNoRows {
+			logger.Info(ctx, fmt.Sprintf("repo: No Exists credential: %s", id))
+			return nil, nil
+		}
+		logger.Error(ctx, "Database Error", logger.WithError(err))
+		return nil, err
+	}
+
+	return credential, nil
+}
+
+func (r *userRepository) FindCredentialByCredentialID(ctx context.Context, userID string, credentialID []byte) (*model.Credential, error) {
+	stmt, err := r.db.PrepareContext(ctx, "SELECT "+credentialColumns+" FROM credentials WHERE user_id = $1 AND credential_id = $2")
+	if err != nil {
+		logger.Error(ctx, "Database Error", logger.WithError(err))
+		return nil, err
+	}
+	defer stmt.Close()
+
+	credential, err := scanCredential(stmt.QueryRowContext(ctx, userID, credentialID))
+	if err != nil {
+		//Not found
+		if err == sql.ErrNoRows {
+			logger.Info(ctx, "repo: No Exists credential")
+			return nil, nil
+		}
+		logger.Error(ctx, "Database Error", logger.WithError(err))
+		return nil, err
+	}
+
+	return credential, nil
+}
+
+func (r *userRepository) RenameCredential(ctx context.Context, userID string, id string, name string) error {
+	stmt, err := r.db.PrepareContext(ctx, "UPDATE credentials SET name = $1 WHERE user_id = $2 AND id = $3")
+	if err != nil {
+		logger.Error(ctx, "Database Error", logger.WithError(err))
+		return err
+	}
+	defer stmt.Close()
+
+	if _, err := stmt.ExecContext(ctx, name, userID, id); err != nil {
+		logger.Error(ctx, "Database Error", logger.WithError(err))
+		return err
+	}
+
+	return nil
+}
+
+func (r *userRepository) DeleteCredential(ctx context.Context, userID string, id string) error {
+	stmt, err := r.db.PrepareContext(ctx, "DELETE FROM credentials WHERE user_id = $1 AND id = $2")
+	if err != nil {
+		logger.Error(ctx, "Database Error", logger.WithError(err))
+		return err
+	}
+	defer stmt.Close()
+
+	if _, err := stmt.ExecContext(ctx, userID, id); err != nil {
+		logger.Error(ctx, "Database Error", logger.WithError(err))
+		return err
+	}
+
+	return nil
+}
+
+func (r *userRepository) RecordCloneEvent(ctx context.Context, userID string, credential *webauthn.Credential, policy model.ClonePolicy) error {
+	stmt, err := r.db.PrepareContext(ctx, `INSERT INTO credential_clone_events (credential_id, user_id, sign_count, policy)
+		SELECT id, user_id, $3, $4 FROM credentials WHERE user_id = $1 AND credential_id = $2`)
+	if err != nil {
+		logger.Error(ctx, "Database Error", logger.WithError(err))
+		return err
+	}
+	defer stmt.Close()
+
+	if _, err := stmt.ExecContext(ctx, userID, credential.ID, int64(credential.Authenticator.SignCount), string(policy)); err != nil {
+		logger.Error(ctx, "Database Error", logger.WithError(err))
+		return err
+	}
+
+	return nil
+}
+
+func (r *userRepository) QuarantineCredential(ctx context.Context, userID string, credentialID []byte) error {
+	stmt, err := r.db.PrepareContext(ctx, "UPDATE credentials SET quarantined_at = now() WHERE user_id = $1 AND credential_id = $2 AND quarantined_at IS NULL")
+	if err != nil {
+		logger.Error(ctx, "Database Error", logger.WithError(err))
+		return err
+	}
+	defer stmt.Close()
+
+	if _, err := stmt.ExecContext(ctx, userID, credentialID); err != nil {
+		logger.Error(ctx, "Database Error", logger.WithError(err))
+		return err
+	}
+
+	return nil
+}
+
+// ClearQuarantine puts a credential back into use and resets its clone warning.
+func (r *userRepository) ClearQuarantine(ctx context.Context, userID string, id string) error {
+	stmt, err := r.db.PrepareContext(ctx, "UPDATE credentials SET quarantined_at = NULL, clone_warning = false WHERE user_id = $1 AND id = $2")
+	if err != nil {
+		logger.Error(ctx, "Database Error", logger.WithError(err))
+		return err
+	}
+	defer stmt.Close()
+
+	if _, err := stmt.ExecContext(ctx, userID, id); err != nil {
+		logger.Error(ctx, "Database Error", logger.WithError(err))
+		return err
+	}
+
+	return nil
+}
+
+// listCloneEvents returns the clone events of a user keyed by credential row ID.
+func (r *userRepository) listCloneEvents(ctx context.Context, userID string) (map[string][]model.CloneEvent, error) {
+	stmt, err := r.db.PrepareContext(ctx, "SELECT id, credential_id, sign_count, policy, created_at FROM credential_clone_events WHERE user_id = $1 ORDER BY created_at")
+	if err != nil {
+		logger.Error(ctx, "Database Error", logger.WithError(err))
+		return nil, err
+	}
+	defer stmt.Close()
+
+	rows, err := stmt.QueryContext(ctx, userID)
+	if err != nil {
+		logger.Error(ctx, "Database Error", logger.WithError(err))
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := map[string][]model.CloneEvent{}
+	for rows.Next() {
+		var (
+			event     model.CloneEvent
+			signCount int64
+			policy    string
+		)
+		if err := rows.Scan(&event.ID, &event.CredentialID, &signCount, &policy, &event.CreatedAt); err != nil {
+			logger.Error(ctx, "Database Error", logger.WithError(err))
+			return nil, err
+		}
+		event.SignCount = uint32(signCount)
+		event.Policy = model.ClonePolicy(policy)
+		events[event.CredentialID] = append(events[event.CredentialID], event)
+	}
+
+	if err := rows.Err(); err != nil {
+		logger.Error(ctx, "Database Rows Error", logger.WithError(err))
+		return nil, err
+	}
+
+	return events, nil
+}
+
+// findWebAuthnCredentials loads the credentials of a user for the WebAuthn ceremonies.
+// Quarantined credentials are left out so they can't be used to sign in.
+func (r *userRepository) findWebAuthnCredentials(ctx context.Context, userID string) ([]webauthn.Credential, error) {
+	stmt, err := r.db.PrepareContext(ctx, "SELECT "+credentialColumns+" FROM credentials WHERE user_id = $1 AND quarantined_at IS NULL")
+	if err != nil {
+		logger.Error(ctx, "Database Error", logger.WithError(err))
+		return nil, err
+	}
+	defer stmt.Close()
+
+	rows, err := stmt.QueryContext(ctx, userID)
+	if err != nil {
+		logger.Error(ctx, "Database Error", logger.WithError(err))
+		return nil, err
+	}
+	defer rows.Close()
+
+	var credentials []webauthn.Credential
+	for rows.Next() {
+		credential, err := scanCredential(rows)
+		if err != nil {
+			logger.Error(ctx, "Database Error", logger.WithError(err))
+			return nil, err
+		}
+		// 保存済みのフラグはカラムに残し、セレモニーは自身のクローン警告だけを報告する
+		credential.Credential.Authenticator.CloneWarning = false
+		credentials = append(credentials, credential.Credential)
+	}
+
+	if err := rows.Err(); err != nil {
+		logger.Error(ctx, "Database Rows Error", logger.WithError(err))
+		return nil, err
+	}
+
+	return credentials, nil
+}
+
+// rowScanner is satisfied by both *sql.Row and *sql.Rows.
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanCredential(row rowScanner) (*model.Credential, error) {
+	var (
+		credential    model.Credential
+		aaguid        uuid.UUID
+		signCount     int64
+		attachment    string
+		transports    []string
+		attestation   []byte
+		lastUsedAt    sql.NullTime
+		quarantinedAt sql.NullTime
+	)
+	c := &credential.Credential
+	if err := row.Scan(
+		&credential.ID,
+		&credential.UserID,
+		&credential.Name,
+		&c.ID,
+		&c.PublicKey,
+		&c.AttestationType,
+		&aaguid,
+		&signCount,
+		&c.Authenticator.CloneWarning,
+		&attachment,
+		pgtype.NewMap().SQLScanner(&transports),
+		&c.Flags.UserPresent,
+		&c.Flags.UserVerified,
+		&c.Flags.BackupEligible,
+		&c.Flags.BackupState,
+		&attestation,
+		&credential.CreatedAt,
+		&lastUsedAt,
+		&quarantinedAt,
+	); err != nil {
+		return nil, err
+	}
+
+	c.Authenticator.AAGUID = aaguid[:]
+	c.Authenticator.SignCount = uint32(signCount)
+	c.Authenticator.Attachment = protocol.AuthenticatorAttachment(attachment)
+	for _, t := range transports {
+		c.Transport = append(c.Transport, protocol.AuthenticatorTransport(t))
+	}
+	if len(attestation) > 0 {
+		if err := json.Unmarshal(attestation, &c.Attestation); err != nil {
+			return nil, err
+		}
+	}
+	if lastUsedAt.Valid {
+		credential.LastUsedAt = &lastUsedAt.Time
+	}
+	if quarantinedAt.Valid {
+		credential.QuarantinedAt = &quarantinedAt.Time
+	}
+	return &credential, nil
+}
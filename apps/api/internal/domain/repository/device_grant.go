@@ -0,0 +1,182 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/kobayashiyabako16g/passkey-auth-example/internal/domain/model"
+	"github.com/kobayashiyabako16g/passkey-auth-example/pkg/kvstore"
+	"github.com/kobayashiyabako16g/passkey-auth-example/pkg/random"
+)
+
+// DeviceGrant stores pending device authorizations until they expire.
+// The grant is keyed by its user code, and the device code points to it.
+type DeviceGrant interface {
+	// Create assigns a device code and a unique user code to the grant.
+	Create(ctx context.Context, grant *model.DeviceGrant) error
+	Save(ctx context.Context, grant *model.DeviceGrant) error
+	// SavePoll records the polling interval and time of the device.
+	SavePoll(ctx context.Context, grant *model.DeviceGrant) error
+	FindByDeviceCode(ctx context.Context, raw string) (*model.DeviceGrant, error)
+	FindByUserCode(ctx context.Context, userCode string) (*model.DeviceGrant, error)
+	// Consume deletes the grant and reports whether this call deleted it,
+	// so an approved grant is exchanged at most once.
+	Consume(ctx context.Context, grant *model.DeviceGrant) (bool, error)
+}
+
+type deviceGrantImpl struct {
+	client kvstore.Client
+}
+
+func NewDeviceGrant(client kvstore.Client) DeviceGrant {
+	return &deviceGrantImpl{client}
+}
+
+// userCodeAttempts bounds the retries when a generated user code is already taken.
+const userCodeAttempts = 5
+
+type devicePoll struct {
+	Interval     time.Duration `json:"interval"`
+	LastPolledAt time.Time     `json:"last_polled_at"`
+}
+
+func (d *deviceGrantImpl) Create(ctx context.Context, grant *model.DeviceGrant) error {
+	raw, err := random.Token(32)
+	if err != nil {
+		return err
+	}
+
+	for range userCodeAttempts {
+		userCode, err := random.String(model.UserCodeLength, model.UserCodeAlphabet)
+		if err != nil {
+			return err
+		}
+		existing, err := d.client.Get(ctx, d.getKey(userCode))
+		if err != nil {
+			return err
+		}
+		if existing == "" {
+			grant.UserCode = userCode
+			break
+		}
+	}
+	if grant.UserCode == "" {
+		return fmt.Errorf("failed to generate a unique user code")
+	}
+
+	if err := d.Save(ctx, grant); err != nil {
+		return err
+	}
+	if err := d.SavePoll(ctx, grant); err != nil {
+		return err
+	}
+	ttl := int64(time.Until(grant.ExpiresAt).Seconds())
+	if err := d.client.Set(ctx, d.getDeviceCodeKey(raw), grant.UserCode, kvstore.SetOptions{Expiration: ttl}); err != nil {
+		return err
+	}
+
+	grant.DeviceCode = raw
+	return nil
+}
+
+func (d *deviceGrantImpl) Save(ctx context.Context, grant *model.DeviceGrant) error {
+	data, err := json.Marshal(grant)
+	if err != nil {
+		return fmt.Errorf("failed to marshal device grant: %v", err)
+	}
+	ttl := int64(time.Until(grant.ExpiresAt).Seconds())
+	if ttl <= 0 {
+		return fmt.Errorf("device grant already expired")
+	}
+	return d.client.Set(ctx, d.getKey(grant.UserCode), string(data), kvstore.SetOptions{Expiration: ttl})
+}
+
+func (d *deviceGrantImpl) SavePoll(ctx context.Context, grant *model.DeviceGrant) error {
+	data, err := json.Marshal(devicePoll{Interval: grant.Interval, LastPolledAt: grant.LastPolledAt})
+	if err != nil {
+		return fmt.Errorf("failed to marshal device poll: %v", err)
+	}
+	ttl := int64(time.Until(grant.ExpiresAt).Seconds())
+	if ttl <= 0 {
+		return fmt.Errorf("device grant already expired")
+	}
+	return d.client.Set(ctx, d.getPollKey(grant.UserCode), string(data), kvstore.SetOptions{Expiration: ttl})
+}
+
+func (d *deviceGrantImpl) FindByDeviceCode(ctx context.Context, raw string) (*model.DeviceGrant, error) {
+	if raw == "" {
+		return nil, nil
+	}
+	userCode, err := d.client.Get(ctx, d.getDeviceCodeKey(raw))
+	if err != nil {
+		return nil, err
+	}
+	grant, err := d.FindByUserCode(ctx, userCode)
+	if err != nil || grant == nil {
+		return nil, err
+	}
+	grant.DeviceCode = raw
+
+	data, err := d.client.Get(ctx, d.getPollKey(grant.UserCode))
+	if err != nil {
+		return nil, err
+	}
+	if data != "" {
+		var poll devicePoll
+		if err := json.Unmarshal([]byte(data), &poll); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal device poll: %v", err)
+		}
+		grant.Interval = poll.Interval
+		grant.LastPolledAt = poll.LastPolledAt
+	}
+	return grant, nil
+}
+
+// FindByUserCode accepts the code as typed by the user, e.g. "bcdf-ghjk".
+func (d *deviceGrantImpl) FindByUserCode(ctx context.Context, userCode string) (*model.DeviceGrant, error) {
+	userCode = model.NormalizeUserCode(userCode)
+	if userCode == "" {
+		return nil, nil
+	}
+	data, err := d.client.Get(ctx, d.getKey(userCode))
+	if err != nil {
+		return nil, err
+	}
+	if data == "" {
+		return nil, nil
+	}
+
+	var grant model.DeviceGrant
+	if err := json.Unmarshal([]byte(data), &grant); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal device grant: %v", err)
+	}
+	return &grant, nil
+}
+
+func (d *deviceGrantImpl) Consume(ctx context.Context, grant *model.DeviceGrant) (bool, error) {
+	userCode, err := d.client.GetDel(ctx, d.getDeviceCodeKey(grant.DeviceCode))
+	if err != nil {
+		return false, err
+	}
+	if err := d.client.Delete(ctx, d.getKey(grant.UserCode)); err != nil {
+		return false, err
+	}
+	if err := d.client.Delete(ctx, d.getPollKey(grant.UserCode)); err != nil {
+		return false, err
+	}
+	return userCode != "", nil
+}
+
+func (d *deviceGrantImpl) getKey(userCode string) string {
+	return fmt.Sprintf("device_grant:%s", userCode)
+}
+
+func (d *deviceGrantImpl) getPollKey(userCode string) string {
+	return fmt.Sprintf("device_poll:%s", userCode)
+}
+
+func (d *deviceGrantImpl) getDeviceCodeKey(raw string) string {
+	return fmt.Sprintf("device_code:%s", hashToken(raw))
+}
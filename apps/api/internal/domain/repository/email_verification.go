@@ -0,0 +1,74 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/kobayashiyabako16g/passkey-auth-example/internal/domain/model"
+	"github.com/kobayashiyabako16g/passkey-auth-example/pkg/kvstore"
+	"github.com/kobayashiyabako16g/passkey-auth-example/pkg/random"
+)
+
+// EmailVerification stores pending email verifications until they are used or expire.
+type EmailVerification interface {
+	// Create assigns a random token to the verification.
+	Create(ctx context.Context, verification *model.EmailVerification) error
+	// Consume returns the verification at most once.
+	Consume(ctx context.Context, raw string) (*model.EmailVerification, error)
+}
+
+type emailVerificationImpl struct {
+	client kvstore.Client
+}
+
+func NewEmailVerification(client kvstore.Client) EmailVerification {
+	return &emailVerificationImpl{client}
+}
+
+func (e *emailVerificationImpl) Create(ctx context.Context, verification *model.EmailVerification) error {
+	raw, err := random.Token(32)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(verification)
+	if err != nil {
+		return fmt.Errorf("failed to marshal email verification: %v", err)
+	}
+	ttl := int64(time.Until(verification.ExpiresAt).Seconds())
+	if ttl <= 0 {
+		return fmt.Errorf("email verification already expired")
+	}
+	if err := e.client.Set(ctx, e.getKey(raw), string(data), kvstore.SetOptions{Expiration: ttl}); err != nil {
+		return err
+	}
+
+	verification.Token = raw
+	return nil
+}
+
+func (e *emailVerificationImpl) Consume(ctx context.Context, raw string) (*model.EmailVerification, error) {
+	if raw == "" {
+		return nil, nil
+	}
+	data, err := e.client.GetDel(ctx, e.getKey(raw))
+	if err != nil {
+		return nil, err
+	}
+	if data == "" {
+		return nil, nil
+	}
+
+	var verification model.EmailVerification
+	if err := json.Unmarshal([]byte(data), &verification); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal email verification: %v", err)
+	}
+	verification.Token = raw
+	return &verification, nil
+}
+
+func (e *emailVerificationImpl) getKey(raw string) string {
+	return fmt.Sprintf("email_verification:%s", hashToken(raw))
+}
@@ -0,0 +1,114 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/kobayashiyabako16g/passkey-auth-example/internal/domain/model"
+	"github.com/kobayashiyabako16g/passkey-auth-example/pkg/db"
+	"github.com/kobayashiyabako16g/passkey-auth-example/pkg/logger"
+	"github.com/kobayashiyabako16g/passkey-auth-example/pkg/random"
+)
+
+type EnrollmentToken interface {
+	// Create assigns a random token and replaces the unused tokens of the user.
+	Create(ctx context.Context, token *model.EnrollmentToken) error
+	// FindByToken returns the token if it's neither used nor expired.
+	FindByToken(ctx context.Context, raw string) (*model.EnrollmentToken, error)
+	// MarkUsed spends the token. It reports false when it was already used or expired.
+	MarkUsed(ctx context.Context, id string) (bool, error)
+}
+
+type enrollmentTokenRepository struct {
+	db *db.Client
+}
+
+func NewEnrollmentToken(db *db.Client) EnrollmentToken {
+	return &enrollmentTokenRepository{
+		db: db,
+	}
+}
+
+func (r *enrollmentTokenRepository) Create(ctx context.Context, token *model.EnrollmentToken) error {
+	raw, err := random.Token(32)
+	if err != nil {
+		return err
+	}
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		logger.Error(ctx, "Database Error", logger.WithError(err))
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM enrollment_tokens WHERE user_id = $1 AND used_at IS NULL", token.UserID); err != nil {
+		logger.Error(ctx, "Database Error", logger.WithError(err))
+		return err
+	}
+
+	if err := tx.QueryRowContext(ctx,
+		"INSERT INTO enrollment_tokens (user_id, token_hash, expires_at) VALUES ($1, $2, $3) RETURNING id, created_at",
+		token.UserID, hashToken(raw), token.ExpiresAt,
+	).Scan(&token.ID, &token.CreatedAt); err != nil {
+		logger.Error(ctx, "Database Error", logger.WithError(err))
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		logger.Error(ctx, "Database Error", logger.WithError(err))
+		return err
+	}
+	logger.Debug(ctx, fmt.Sprintf("Created enrollment token for user %s", token.UserID))
+
+	token.Token = raw
+	return nil
+}
+
+func (r *enrollmentTokenRepository) FindByToken(ctx context.Context, raw string) (*model.EnrollmentToken, error) {
+	if raw == "" {
+		return nil, nil
+	}
+	stmt, err := r.db.PrepareContext(ctx, "SELECT id, user_id, expires_at, created_at FROM enrollment_tokens WHERE token_hash = $1 AND used_at IS NULL AND expires_at > now()")
+	if err != nil {
+		logger.Error(ctx, "Database Error", logger.WithError(err))
+		return nil, err
+	}
+	defer stmt.Close()
+
+	var token model.EnrollmentToken
+	if err := stmt.QueryRowContext(ctx, hashToken(raw)).Scan(&token.ID, &token.UserID, &token.ExpiresAt, &token.CreatedAt); err != nil {
+		//Not found
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		logger.Error(ctx, "Database Error", logger.WithError(err))
+		return nil, err
+	}
+	token.Token = raw
+
+	return &token, nil
+}
+
+func (r *enrollmentTokenRepository) MarkUsed(ctx context.Context, id string) (bool, error) {
+	stmt, err := r.db.PrepareContext(ctx, "UPDATE enrollment_tokens SET used_at = now() WHERE id = $1 AND used_at IS NULL AND expires_at > now()")
+	if err != nil {
+		logger.Error(ctx, "Database Error", logger.WithError(err))
+		return false, err
+	}
+	defer stmt.Close()
+
+	res, err := stmt.ExecContext(ctx, id)
+	if err != nil {
+		logger.Error(ctx, "Database Error", logger.WithError(err))
+		return false, err
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		logger.Error(ctx, "Database Error", logger.WithError(err))
+		return false, err
+	}
+
+	return rows == 1, nil
+}
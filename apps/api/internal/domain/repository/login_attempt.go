@@ -0,0 +1,48 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/kobayashiyabako16g/passkey-auth-example/pkg/kvstore"
+)
+
+// LoginAttempt counts the sign-in attempts of a method, such as password or recovery code,
+// per username and per client IP address.
+type LoginAttempt interface {
+	// CountUser counts an attempt for the username and returns the number of attempts
+	// in the current window, which starts with the first one. Unknown usernames count too.
+	CountUser(ctx context.Context, method string, username string, window time.Duration) (int64, error)
+	// CountIP counts an attempt from the IP address like CountUser.
+	CountIP(ctx context.Context, method string, ip string, window time.Duration) (int64, error)
+}
+
+type loginAttemptImpl struct {
+	client kvstore.Client
+}
+
+func NewLoginAttempt(client kvstore.Client) LoginAttempt {
+	return &loginAttemptImpl{client}
+}
+
+func (l *loginAttemptImpl) CountUser(ctx context.Context, method string, username string, window time.Duration) (int64, error) {
+	return l.count(ctx, fmt.Sprintf("login_attempt:%s:user:%s", method, hashToken(username)), window)
+}
+
+func (l *loginAttemptImpl) CountIP(ctx context.Context, method string, ip string, window time.Duration) (int64, error) {
+	return l.count(ctx, fmt.Sprintf("login_attempt:%s:ip:%s", method, ip), window)
+}
+
+func (l *loginAttemptImpl) count(ctx context.Context, key string, window time.Duration) (int64, error) {
+	count, err := l.client.Incr(ctx, key)
+	if err != nil {
+		return 0, err
+	}
+	if count == 1 {
+		if err := l.client.Expire(ctx, key, int64(window.Seconds())); err != nil {
+			return 0, err
+		}
+	}
+	return count, nil
+}
@@ -0,0 +1,96 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/kobayashiyabako16g/passkey-auth-example/internal/domain/model"
+	"github.com/kobayashiyabako16g/passkey-auth-example/pkg/kvstore"
+	"github.com/kobayashiyabako16g/passkey-auth-example/pkg/random"
+)
+
+// MagicLink stores sign-in links sent by email until they are used or expire.
+type MagicLink interface {
+	// Create assigns a random token to the link.
+	Create(ctx context.Context, link *model.MagicLink) error
+	// Consume returns the link at most once.
+	Consume(ctx context.Context, raw string) (*model.MagicLink, error)
+	// CountRequest counts a request for the email address and returns the number of requests
+	// in the current window, which starts with the first request.
+	CountRequest(ctx context.Context, email string, window time.Duration) (int64, error)
+}
+
+type magicLinkImpl struct {
+	client kvstore.Client
+}
+
+func NewMagicLink(client kvstore.Client) MagicLink {
+	return &magicLinkImpl{client}
+}
+
+func (m *magicLinkImpl) Create(ctx context.Context, link *model.MagicLink) error {
+	raw, err := random.Token(32)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(link)
+	if err != nil {
+		return fmt.Errorf("failed to marshal magic link: %v", err)
+	}
+	ttl := int64(time.Until(link.ExpiresAt).Seconds())
+	if ttl <= 0 {
+		return fmt.Errorf("magic link already expired")
+	}
+	if err := m.client.Set(ctx, m.getKey(raw), string(data), kvstore.SetOptions{Expiration: ttl}); err != nil {
+		return err
+	}
+
+	link.Token = raw
+	return nil
+}
+
+func (m *magicLinkImpl) Consume(ctx context.Context, raw string) (*model.MagicLink, error) {
+	if raw == "" {
+		return nil, nil
+	}
+	data, err := m.client.GetDel(ctx, m.getKey(raw))
+	if err != nil {
+		return nil, err
+	}
+	if data == "" {
+		return nil, nil
+	}
+
+	var link model.MagicLink
+	if err := json.Unmarshal([]byte(data), &link); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal magic link: %v", err)
+	}
+	link.Token = raw
+	return &link, nil
+}
+
+func (m *magicLinkImpl) CountRequest(ctx context.Context, email string, window time.Duration) (int64, error) {
+	key := m.getRateKey(email)
+	count, err := m.client.Incr(ctx, key)
+	if err != nil {
+		return 0, err
+	}
+	if count == 1 {
+		if err := m.client.Expire(ctx, key, int64(window.Seconds())); err != nil {
+			return 0, err
+		}
+	}
+	return count, nil
+}
+
+func (m *magicLinkImpl) getKey(raw string) string {
+	return fmt.Sprintf("magic_link:%s", hashToken(raw))
+}
+
+// アドレスはハッシュ化してキーに含める
+func (m *magicLinkImpl) getRateKey(email string) string {
+	return fmt.Sprintf("magic_link_rate:%s", hashToken(email))
+}
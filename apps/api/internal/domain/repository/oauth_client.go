@@ -0,0 +1,77 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/kobayashiyabako16g/passkey-auth-example/internal/domain/model"
+	"github.com/kobayashiyabako16g/passkey-auth-example/pkg/db"
+	"github.com/kobayashiyabako16g/passkey-auth-example/pkg/logger"
+)
+
+type OAuthClient interface {
+	Create(ctx context.Context, client *model.OAuthClient) error
+	FindById(ctx context.Context, id string) (*model.OAuthClient, error)
+}
+
+type oauthClientRepository struct {
+	db *db.Client
+}
+
+func NewOAuthClient(db *db.Client) OAuthClient {
+	return &oauthClientRepository{
+		db: db,
+	}
+}
+
+func (r *oauthClientRepository) Create(ctx context.Context, client *model.OAuthClient) error {
+	stmt, err := r.db.PrepareContext(ctx, "INSERT INTO oauth_clients (id, name, secret_hash, redirect_uris, resource_server) VALUES ($1, $2, $3, $4, $5) RETURNING created_at")
+	if err != nil {
+		logger.Error(ctx, "Database Error", logger.WithError(err))
+		return err
+	}
+	defer stmt.Close()
+
+	secretHash := sql.NullString{String: client.SecretHash, Valid: client.SecretHash != ""}
+	if err := stmt.QueryRowContext(ctx, client.ID, client.Name, secretHash, client.RedirectURIs, client.ResourceServer).Scan(&client.CreatedAt); err != nil {
+		logger.Error(ctx, "Database Error", logger.WithError(err))
+		return err
+	}
+
+	return nil
+}
+
+func (r *oauthClientRepository) FindById(ctx context.Context, id string) (*model.OAuthClient, error) {
+	stmt, err := r.db.PrepareContext(ctx, "SELECT id, name, secret_hash, redirect_uris, resource_server, created_at FROM oauth_clients WHERE id = $1")
+	if err != nil {
+		logger.Error(ctx, "Database Error", logger.WithError(err))
+		return nil, err
+	}
+	defer stmt.Close()
+
+	var (
+		client     model.OAuthClient
+		secretHash sql.NullString
+	)
+	if err := stmt.QueryRowContext(ctx, id).Scan(
+		&client.ID,
+		&client.Name,
+		&secretHash,
+		pgtype.NewMap().SQLScanner(&client.RedirectURIs),
+		&client.ResourceServer,
+		&client.CreatedAt,
+	); err != nil {
+		//Not found
+		if err == sql.ErrNoRows {
+			logger.Info(ctx, fmt.Sprintf("repo: No Exists client: %s", id))
+			return nil, nil
+		}
+		logger.Error(ctx, "Database Error", logger.WithError(err))
+		return nil, err
+	}
+	client.SecretHash = secretHash.String
+
+	return &client, nil
+}
@@ -0,0 +1,88 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/kobayashiyabako16g/passkey-auth-example/internal/domain/model"
+	"github.com/kobayashiyabako16g/passkey-auth-example/pkg/db"
+	"github.com/kobayashiyabako16g/passkey-auth-example/pkg/logger"
+)
+
+// Password stores the passwords of accounts migrated from the legacy system.
+type Password interface {
+	Find(ctx context.Context, userID string) (*model.PasswordCredential, error)
+	// MarkUsed records a successful login and replaces the hash when rehash is set.
+	MarkUsed(ctx context.Context, userID string, rehash string) error
+	// Retire deletes the password. It reports false when the user had none.
+	Retire(ctx context.Context, userID string) (bool, error)
+}
+
+type passwordRepository struct {
+	db *db.Client
+}
+
+func NewPassword(db *db.Client) Password {
+	return &passwordRepository{
+		db: db,
+	}
+}
+
+func (r *passwordRepository) Find(ctx context.Context, userID string) (*model.PasswordCredential, error) {
+	stmt, err := r.db.PrepareContext(ctx, "SELECT user_id, hash, created_at, last_used_at FROM password_credentials WHERE user_id = $1")
+	if err != nil {
+		logger.Error(ctx, "Database Error", logger.WithError(err))
+		return nil, err
+	}
+	defer stmt.Close()
+
+	var password model.PasswordCredential
+	if err := stmt.QueryRowContext(ctx, userID).Scan(&password.UserID, &password.Hash, &password.CreatedAt, &password.LastUsedAt); err != nil {
+		//Not found
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		logger.Error(ctx, "Database Error", logger.WithError(err))
+		return nil, err
+	}
+
+	return &password, nil
+}
+
+func (r *passwordRepository) MarkUsed(ctx context.Context, userID string, rehash string) error {
+	stmt, err := r.db.PrepareContext(ctx, "UPDATE password_credentials SET last_used_at = now(), hash = COALESCE(NULLIF($1, ''), hash) WHERE user_id = $2")
+	if err != nil {
+		logger.Error(ctx, "Database Error", logger.WithError(err))
+		return err
+	}
+	defer stmt.Close()
+
+	if _, err := stmt.ExecContext(ctx, rehash, userID); err != nil {
+		logger.Error(ctx, "Database Error", logger.WithError(err))
+		return err
+	}
+
+	return nil
+}
+
+func (r *passwordRepository) Retire(ctx context.Context, userID string) (bool, error) {
+	stmt, err := r.db.PrepareContext(ctx, "DELETE FROM password_credentials WHERE user_id = $1")
+	if err != nil {
+		logger.Error(ctx, "Database Error", logger.WithError(err))
+		return false, err
+	}
+	defer stmt.Close()
+
+	res, err := stmt.ExecContext(ctx, userID)
+	if err != nil {
+		logger.Error(ctx, "Database Error", logger.WithError(err))
+		return false, err
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		logger.Error(ctx, "Database Error", logger.WithError(err))
+		return false, err
+	}
+
+	return rows == 1, nil
+}
@@ -0,0 +1,138 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/kobayashiyabako16g/passkey-auth-example/internal/domain/model"
+	"github.com/kobayashiyabako16g/passkey-auth-example/pkg/kvstore"
+	"github.com/kobayashiyabako16g/passkey-auth-example/pkg/random"
+)
+
+// QRLogin stores cross-device sign-in requests until they expire.
+// The request is keyed by its code, and the ID of the new browser points to it.
+type QRLogin interface {
+	// Create assigns an ID and a unique code to the request.
+	Create(ctx context.Context, login *model.QRLogin) error
+	Save(ctx context.Context, login *model.QRLogin) error
+	FindByID(ctx context.Context, id string) (*model.QRLogin, error)
+	FindByCode(ctx context.Context, code string) (*model.QRLogin, error)
+	// Consume deletes the request and reports whether this call deleted it,
+	// so an approval signs in at most one browser.
+	Consume(ctx context.Context, login *model.QRLogin) (bool, error)
+}
+
+type qrLoginImpl struct {
+	client kvstore.Client
+}
+
+func NewQRLogin(client kvstore.Client) QRLogin {
+	return &qrLoginImpl{client}
+}
+
+func (q *qrLoginImpl) Create(ctx context.Context, login *model.QRLogin) error {
+	id, err := random.Token(32)
+	if err != nil {
+		return err
+	}
+
+	// デバイスグラントのユーザーコードと同じ形式
+	for range userCodeAttempts {
+		code, err := random.String(model.UserCodeLength, model.UserCodeAlphabet)
+		if err != nil {
+			return err
+		}
+		existing, err := q.client.Get(ctx, q.getKey(code))
+		if err != nil {
+			return err
+		}
+		if existing == "" {
+			login.Code = code
+			break
+		}
+	}
+	if login.Code == "" {
+		return fmt.Errorf("failed to generate a unique code")
+	}
+
+	if err := q.Save(ctx, login); err != nil {
+		return err
+	}
+	ttl := int64(time.Until(login.ExpiresAt).Seconds())
+	if err := q.client.Set(ctx, q.getIDKey(id), login.Code, kvstore.SetOptions{Expiration: ttl}); err != nil {
+		return err
+	}
+
+	login.ID = id
+	return nil
+}
+
+func (q *qrLoginImpl) Save(ctx context.Context, login *model.QRLogin) error {
+	data, err := json.Marshal(login)
+	if err != nil {
+		return fmt.Errorf("failed to marshal qr login: %v", err)
+	}
+	ttl := int64(time.Until(login.ExpiresAt).Seconds())
+	if ttl <= 0 {
+		return fmt.Errorf("qr login already expired")
+	}
+	return q.client.Set(ctx, q.getKey(login.Code), string(data), kvstore.SetOptions{Expiration: ttl})
+}
+
+func (q *qrLoginImpl) FindByID(ctx context.Context, id string) (*model.QRLogin, error) {
+	if id == "" {
+		return nil, nil
+	}
+	code, err := q.client.Get(ctx, q.getIDKey(id))
+	if err != nil {
+		return nil, err
+	}
+	login, err := q.FindByCode(ctx, code)
+	if err != nil || login == nil {
+		return nil, err
+	}
+	login.ID = id
+	return login, nil
+}
+
+// FindByCode accepts the code as typed by the user, e.g. "bcdf-ghjk".
+func (q *qrLoginImpl) FindByCode(ctx context.Context, code string) (*model.QRLogin, error) {
+	code = model.NormalizeUserCode(code)
+	if code == "" {
+		return nil, nil
+	}
+	data, err := q.client.Get(ctx, q.getKey(code))
+	if err != nil {
+		return nil, err
+	}
+	if data == "" {
+		return nil, nil
+	}
+
+	var login model.QRLogin
+	if err := json.Unmarshal([]byte(data), &login); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal qr login: %v", err)
+	}
+	return &login, nil
+}
+
+func (q *qrLoginImpl) Consume(ctx context.Context, login *model.QRLogin) (bool, error) {
+	code, err := q.client.GetDel(ctx, q.getIDKey(login.ID))
+	if err != nil {
+		return false, err
+	}
+	if err := q.client.Delete(ctx, q.getKey(login.Code)); err != nil {
+		return false, err
+	}
+	return code != "", nil
+}
+
+func (q *qrLoginImpl) getKey(code string) string {
+	return fmt.Sprintf("qr_login:%s", code)
+}
+
+func (q *qrLoginImpl) getIDKey(id string) string {
+	return fmt.Sprintf("qr_login_id:%s", hashToken(id))
+}
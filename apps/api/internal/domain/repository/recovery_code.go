@@ -0,0 +1,129 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/kobayashiyabako16g/passkey-auth-example/internal/domain/model"
+	"github.com/kobayashiyabako16g/passkey-auth-example/pkg/db"
+	"github.com/kobayashiyabako16g/passkey-auth-example/pkg/logger"
+)
+
+type RecoveryCode interface {
+	// Replace discards the codes of the user and stores a new set of hashes and lookups.
+	Replace(ctx context.Context, userID string, codes []model.RecoveryCode) error
+	ListUnused(ctx context.Context, userID string) ([]model.RecoveryCode, error)
+	// FindUnused lists the unused codes with the lookup, and those without a lookup.
+	FindUnused(ctx context.Context, userID string, lookup string) ([]model.RecoveryCode, error)
+	// MarkUsed spends the code. It reports false when the code was already used.
+	MarkUsed(ctx context.Context, id string) (bool, error)
+}
+
+type recoveryCodeRepository struct {
+	db *db.Client
+}
+
+func NewRecoveryCode(db *db.Client) RecoveryCode {
+	return &recoveryCodeRepository{
+		db: db,
+	}
+}
+
+func (r *recoveryCodeRepository) Replace(ctx context.Context, userID string, codes []model.RecoveryCode) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		logger.Error(ctx, "Database Error", logger.WithError(err))
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM recovery_codes WHERE user_id = $1", userID); err != nil {
+		logger.Error(ctx, "Database Error", logger.WithError(err))
+		return err
+	}
+
+	stmt, err := tx.PrepareContext(ctx, "INSERT INTO recovery_codes (user_id, code_hash, lookup) VALUES ($1, $2, $3)")
+	if err != nil {
+		logger.Error(ctx, "Database Error", logger.WithError(err))
+		return err
+	}
+	defer stmt.Close()
+
+	for _, code := range codes {
+		if _, err := stmt.ExecContext(ctx, userID, code.CodeHash, code.Lookup); err != nil {
+			logger.Error(ctx, "Database Error", logger.WithError(err))
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		logger.Error(ctx, "Database Error", logger.WithError(err))
+		return err
+	}
+	logger.Debug(ctx, fmt.Sprintf("Stored %d recovery codes for user %s", len(codes), userID))
+
+	return nil
+}
+
+func (r *recoveryCodeRepository) ListUnused(ctx context.Context, userID string) ([]model.RecoveryCode, error) {
+	return r.list(ctx, "SELECT id, user_id, code_hash, COALESCE(lookup, ''), created_at FROM recovery_codes WHERE user_id = $1 AND used_at IS NULL", userID)
+}
+
+func (r *recoveryCodeRepository) FindUnused(ctx context.Context, userID string, lookup string) ([]model.RecoveryCode, error) {
+	return r.list(ctx, "SELECT id, user_id, code_hash, COALESCE(lookup, ''), created_at FROM recovery_codes WHERE user_id = $1 AND used_at IS NULL AND (lookup = $2 OR lookup IS NULL)", userID, lookup)
+}
+
+func (r *recoveryCodeRepository) list(ctx context.Context, query string, args ...any) ([]model.RecoveryCode, error) {
+	stmt, err := r.db.PrepareContext(ctx, query)
+	if err != nil {
+		logger.Error(ctx, "Database Error", logger.WithError(err))
+		return nil, err
+	}
+	defer stmt.Close()
+
+	rows, err := stmt.QueryContext(ctx, args...)
+	if err != nil {
+		logger.Error(ctx, "Database Error", logger.WithError(err))
+		return nil, err
+	}
+	defer rows.Close()
+
+	codes := []model.RecoveryCode{}
+	for rows.Next() {
+		var code model.RecoveryCode
+		if err := rows.Scan(&code.ID, &code.UserID, &code.CodeHash, &code.Lookup, &code.CreatedAt); err != nil {
+			logger.Error(ctx, "Database Error", logger.WithError(err))
+			return nil, err
+		}
+		codes = append(codes, code)
+	}
+
+	if err := rows.Err(); err != nil {
+		logger.Error(ctx, "Database Rows Error", logger.WithError(err))
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+func (r *recoveryCodeRepository) MarkUsed(ctx context.Context, id string) (bool, error) {
+	stmt, err := r.db.PrepareContext(ctx, "UPDATE recovery_codes SET used_at = now() WHERE id = $1 AND used_at IS NULL")
+	if err != nil {
+		logger.Error(ctx, "Database Error", logger.WithError(err))
+		return false, err
+	}
+	defer stmt.Close()
+
+	res, err := stmt.ExecContext(ctx, id)
+	if err != nil {
+		logger.Error(ctx, "Database Error", logger.WithError(err))
+		return false, err
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		logger.Error(ctx, "Database Error", logger.WithError(err))
+		return false, err
+	}
+
+	return rows == 1, nil
+}
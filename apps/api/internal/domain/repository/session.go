@@ -4,65 +4,109 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"sort"
 	"time"
 
 	"github.com/kobayashiyabako16g/passkey-auth-example/internal/domain/model"
 	"github.com/kobayashiyabako16g/passkey-auth-example/pkg/kvstore"
 	"github.com/kobayashiyabako16g/passkey-auth-example/pkg/logger"
+	"github.com/kobayashiyabako16g/passkey-auth-example/pkg/random"
+	"github.com/kobayashiyabako16g/passkey-auth-example/pkg/useragent"
 )
 
-// KV Expire
-const Expire = 10
-
 type Session interface {
-	Create(ctx context.Context, id string) (*model.Session, error)
+	Create(ctx context.Context, user *model.User, info model.SessionInfo) (*model.Session, error)
 	Save(ctx context.Context, session *model.Session) error
 	Get(ctx context.Context, id string) (*model.Session, error)
+	Touch(ctx context.Context, session *model.Session) error
+	// TouchIfStale touches the session only when less than half of the idle timeout is left,
+	// for requests too frequent to save the session on each of them.
+	TouchIfStale(ctx context.Context, session *model.Session) error
 	Delete(ctx context.Context, session *model.Session) error
+	ListByUserID(ctx context.Context, userID string) ([]model.Session, error)
+	DeleteAllByUserID(ctx context.Context, userID string) error
 }
 
 type sessionImpl struct {
-	client kvstore.Client
+	client          kvstore.Client
+	absoluteTimeout time.Duration
+	idleTimeout     time.Duration
 }
 
-func NewSession(client kvstore.Client) Session {
-	return &sessionImpl{client}
+func NewSession(client kvstore.Client, absoluteTimeout time.Duration, idleTimeout time.Duration) Session {
+	return &sessionImpl{client, absoluteTimeout, idleTimeout}
 }
 
-func (s *sessionImpl) Create(ctx context.Context, id string) (*model.Session, error) {
+// Create issues a new session with a random ID for the authenticated user.
+func (s *sessionImpl) Create(ctx context.Context, user *model.User, info model.SessionInfo) (*model.Session, error) {
+	id, err := random.Token(32)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
 	session := &model.Session{
-		ID:        id,
-		ExpiresAt: time.Now().Add(24 * time.Hour),
+		ID:                   id,
+		UserID:               user.ID,
+		Username:             user.Name,
+		Authenticated:        !info.EnrollmentRequired && !info.SecondFactorRequired,
+		EnrollmentRequired:   info.EnrollmentRequired,
+		SecondFactorRequired: info.SecondFactorRequired,
+		CredentialID:         info.CredentialID,
+		AuthTime:             now,
+		UserVerified:         info.UserVerified,
+		AMR:                  info.AMR,
+		IP:                   info.IP,
+		UserAgent:            info.UserAgent,
+		Device:               useragent.Parse(info.UserAgent),
+		CreatedAt:            now,
+		LastSeenAt:           now,
+		IdleExpiresAt:        now.Add(s.idleTimeout),
+		ExpiresAt:            now.Add(s.absoluteTimeout),
 	}
 
 	if err := s.Save(ctx, session); err != nil {
 		return nil, err
 	}
 
+	// ユーザーごとのセッション索引
+	indexKey := s.getUserKey(user.ID)
+	if err := s.client.SAdd(ctx, indexKey, session.ID); err != nil {
+		return nil, err
+	}
+	if err := s.client.Expire(ctx, indexKey, int64(s.absoluteTimeout.Seconds())); err != nil {
+		return nil, err
+	}
+
 	return session, nil
 }
 
 func (s *sessionImpl) Save(ctx context.Context, session *model.Session) error {
 	key := s.getKey(session.ID)
-	logger.Debug(ctx, fmt.Sprintf("Saving session with ID %s", key))
+	logger.Debug(ctx, fmt.Sprintf("Saving session for user %s", session.UserID))
 	data, err := json.Marshal(session)
 	if err != nil {
 		return fmt.Errorf("failed to marshal session: %v", err)
 	}
 
 	// Calculate TTL in seconds
-	ttl := time.Until(session.ExpiresAt)
+	expiresAt := session.ExpiresAt
+	if session.IdleExpiresAt.Before(expiresAt) {
+		expiresAt = session.IdleExpiresAt
+	}
+	ttl := int64(time.Until(expiresAt).Seconds())
 	if ttl <= 0 {
 		return fmt.Errorf("session already expired")
 	}
 
-	return s.client.Set(ctx, key, string(string(data)), kvstore.SetOptions{Expiration: Expire})
+	return s.client.Set(ctx, key, string(data), kvstore.SetOptions{Expiration: ttl})
 }
 
-func (s *sessionImpl) Get(ctx context.Context, key string) (*model.Session, error) {
-	sessionID := s.getKey(key)
-	logger.Debug(ctx, fmt.Sprintf("Get session with ID %s", sessionID))
-	data, err := s.client.Get(ctx, sessionID)
+func (s *sessionImpl) Get(ctx context.Context, id string) (*model.Session, error) {
+	if id == "" {
+		return nil, nil
+	}
+	data, err := s.client.Get(ctx, s.getKey(id))
 	if err != nil {
 		return nil, err
 	}
@@ -70,21 +114,92 @@ func (s *sessionImpl) Get(ctx context.Context, key string) (*model.Session, erro
 		return nil, nil
 	}
 
-	logger.Debug(ctx, fmt.Sprintf("Got session data %s", data))
 	var session model.Session
 	if err := json.Unmarshal([]byte(data), &session); err != nil {
 		return nil, fmt.Errorf("failed to unmarshal session: %v", err)
 	}
+	if session.Expired(time.Now()) {
+		logger.Debug(ctx, fmt.Sprintf("Session of user %s expired", session.UserID))
+		return nil, nil
+	}
 
-	logger.Debug(ctx, fmt.Sprintf("Get session id: %v, AuthenticationData: %v", session.ID, session.AuthenticationData))
 	return &session, nil
 }
 
+// Touch records activity on the session and extends its idle timeout.
+func (s *sessionImpl) Touch(ctx context.Context, session *model.Session) error {
+	now := time.Now()
+	session.LastSeenAt = now
+	session.IdleExpiresAt = now.Add(s.idleTimeout)
+	return s.Save(ctx, session)
+}
+
+func (s *sessionImpl) TouchIfStale(ctx context.Context, session *model.Session) error {
+	if time.Until(session.IdleExpiresAt) > s.idleTimeout/2 {
+		return nil
+	}
+	return s.Touch(ctx, session)
+}
+
 func (s *sessionImpl) Delete(ctx context.Context, session *model.Session) error {
 	key := s.getKey(session.ID)
-	return s.client.Delete(ctx, key)
+	if err := s.client.Delete(ctx, key); err != nil {
+		return err
+	}
+	return s.client.SRem(ctx, s.getUserKey(session.UserID), session.ID)
+}
+
+// ListByUserID returns the live sessions of the user and drops expired ones from the index.
+func (s *sessionImpl) ListByUserID(ctx context.Context, userID string) ([]model.Session, error) {
+	indexKey := s.getUserKey(userID)
+	ids, err := s.client.SMembers(ctx, indexKey)
+	if err != nil {
+		return nil, err
+	}
+
+	sessions := []model.Session{}
+	for _, id := range ids {
+		session, err := s.Get(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		if session == nil {
+			if err := s.client.SRem(ctx, indexKey, id); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		sessions = append(sessions, *session)
+	}
+
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].LastSeenAt.After(sessions[j].LastSeenAt)
+	})
+	return sessions, nil
+}
+
+// DeleteAllByUserID revokes every session of the user.
+func (s *sessionImpl) DeleteAllByUserID(ctx context.Context, userID string) error {
+	indexKey := s.getUserKey(userID)
+	ids, err := s.client.SMembers(ctx, indexKey)
+	if err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		if err := s.client.Delete(ctx, s.getKey(id)); err != nil {
+			return err
+		}
+	}
+	logger.Debug(ctx, fmt.Sprintf("Deleted %d sessions of user %s", len(ids), userID))
+
+	return s.client.Delete(ctx, indexKey)
 }
 
 func (s *sessionImpl) getKey(sessionID string) string {
 	return fmt.Sprintf("session:%s", sessionID)
 }
+
+func (s *sessionImpl) getUserKey(userID string) string {
+	return fmt.Sprintf("user_sessions:%s", userID)
+}
@@ -0,0 +1,182 @@
+package repository
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"database/sql"
+	"fmt"
+
+	"github.com/kobayashiyabako16g/passkey-auth-example/pkg/db"
+	"github.com/kobayashiyabako16g/passkey-auth-example/pkg/jws"
+	"github.com/kobayashiyabako16g/passkey-auth-example/pkg/logger"
+)
+
+type SigningKey interface {
+	jws.KeyStore
+}
+
+type signingKeyRepository struct {
+	db *db.Client
+	// aead encrypts the private keys at rest with the configured AES key.
+	aead cipher.AEAD
+}
+
+func NewSigningKey(db *db.Client, encryptionKey []byte) (SigningKey, error) {
+	block, err := aes.NewCipher(encryptionKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid signing key encryption key: %v", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &signingKeyRepository{
+		db:   db,
+		aead: aead,
+	}, nil
+}
+
+func (r *signingKeyRepository) ListKeys(ctx context.Context) ([]*jws.Key, error) {
+	stmt, err := r.db.PrepareContext(ctx, `SELECT kid, private_key, encrypted, created_at, retired_at, expires_at
+	FROM signing_keys WHERE expires_at IS NULL OR expires_at > now() ORDER BY created_at`)
+	if err != nil {
+		logger.Error(ctx, "Database Error", logger.WithError(err))
+		return nil, err
+	}
+	defer stmt.Close()
+
+	rows, err := stmt.QueryContext(ctx)
+	if err != nil {
+		logger.Error(ctx, "Database Error", logger.WithError(err))
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []*jws.Key{}
+	for rows.Next() {
+		var (
+			kid        string
+			privateKey []byte
+			encrypted  bool
+			createdAt  sql.NullTime
+			retiredAt  sql.NullTime
+			expiresAt  sql.NullTime
+		)
+		if err := rows.Scan(&kid, &privateKey, &encrypted, &createdAt, &retiredAt, &expiresAt); err != nil {
+			logger.Error(ctx, "Database Error", logger.WithError(err))
+			return nil, err
+		}
+
+		// 暗号化前に作られた鍵はローテーションで消えるまで平文のまま読む
+		if encrypted {
+			privateKey, err = r.open(kid, privateKey)
+			if err != nil {
+				logger.Error(ctx, "can't decrypt signing key", logger.WithError(err))
+				return nil, err
+			}
+		}
+		key, err := jws.ParsePrivateKey(privateKey, createdAt.Time)
+		if err != nil {
+			logger.Error(ctx, "can't parse signing key", logger.WithError(err))
+			return nil, err
+		}
+		if key.ID != kid {
+			return nil, fmt.Errorf("signing key %s doesn't match its thumbprint", kid)
+		}
+		if retiredAt.Valid {
+			key.RetiredAt = &retiredAt.Time
+		}
+		if expiresAt.Valid {
+			key.ExpiresAt = &expiresAt.Time
+		}
+		keys = append(keys, key)
+	}
+
+	if err := rows.Err(); err != nil {
+		logger.Error(ctx, "Database Rows Error", logger.WithError(err))
+		return nil, err
+	}
+
+	return keys, nil
+}
+
+func (r *signingKeyRepository) CreateKey(ctx context.Context, key *jws.Key) error {
+	privateKey, err := key.MarshalPrivateKey()
+	if err != nil {
+		return err
+	}
+	sealed, err := r.seal(key.ID, privateKey)
+	if err != nil {
+		return err
+	}
+
+	stmt, err := r.db.PrepareContext(ctx, "INSERT INTO signing_keys (kid, algorithm, private_key, encrypted, created_at) VALUES ($1, $2, $3, true, $4)")
+	if err != nil {
+		logger.Error(ctx, "Database Error", logger.WithError(err))
+		return err
+	}
+	defer stmt.Close()
+
+	if _, err := stmt.ExecContext(ctx, key.ID, key.Algorithm, sealed, key.CreatedAt); err != nil {
+		logger.Error(ctx, "Database Error", logger.WithError(err))
+		return err
+	}
+
+	return nil
+}
+
+func (r *signingKeyRepository) RetireKey(ctx context.Context, key *jws.Key) error {
+	stmt, err := r.db.PrepareContext(ctx, "UPDATE signing_keys SET retired_at = $1, expires_at = $2 WHERE kid = $3 AND retired_at IS NULL")
+	if err != nil {
+		logger.Error(ctx, "Database Error", logger.WithError(err))
+		return err
+	}
+	defer stmt.Close()
+
+	if _, err := stmt.ExecContext(ctx, key.RetiredAt, key.ExpiresAt, key.ID); err != nil {
+		logger.Error(ctx, "Database Error", logger.WithError(err))
+		return err
+	}
+
+	return nil
+}
+
+func (r *signingKeyRepository) DeleteExpiredKeys(ctx context.Context) error {
+	stmt, err := r.db.PrepareContext(ctx, "DELETE FROM signing_keys WHERE expires_at <= now()")
+	if err != nil {
+		logger.Error(ctx, "Database Error", logger.WithError(err))
+		return err
+	}
+	defer stmt.Close()
+
+	if _, err := stmt.ExecContext(ctx); err != nil {
+		logger.Error(ctx, "Database Error", logger.WithError(err))
+		return err
+	}
+
+	return nil
+}
+
+// seal encrypts the private key as nonce || ciphertext. The kid is authenticated,
+// so a ciphertext can't be swapped into another row.
+func (r *signingKeyRepository) seal(kid string, privateKey []byte) ([]byte, error) {
+	nonce := make([]byte, r.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return r.aead.Seal(nonce, nonce, privateKey, []byte(kid)), nil
+}
+
+func (r *signingKeyRepository) open(kid string, sealed []byte) ([]byte, error) {
+	if len(sealed) < r.aead.NonceSize() {
+		return nil, fmt.Errorf("signing key %s is too short", kid)
+	}
+	nonce, ciphertext := sealed[:r.aead.NonceSize()], sealed[r.aead.NonceSize():]
+	privateKey, err := r.aead.Open(nil, nonce, ciphertext, []byte(kid))
+	if err != nil {
+		return nil, fmt.Errorf("can't decrypt signing key %s: %v", kid, err)
+	}
+	return privateKey, nil
+}
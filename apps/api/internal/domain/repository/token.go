@@ -0,0 +1,226 @@
+package repository
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/kobayashiyabako16g/passkey-auth-example/internal/domain/model"
+	"github.com/kobayashiyabako16g/passkey-auth-example/pkg/kvstore"
+	"github.com/kobayashiyabako16g/passkey-auth-example/pkg/random"
+)
+
+type RefreshToken interface {
+	// Create issues a new token. A new family is started when FamilyID is empty.
+	Create(ctx context.Context, token *model.RefreshToken) error
+	// Consume invalidates the token and returns it. reused is true when
+	// the token had already been consumed, which means it has leaked.
+	Consume(ctx context.Context, raw string) (token *model.RefreshToken, reused bool, err error)
+	RevokeFamily(ctx context.Context, token *model.RefreshToken) error
+	// RevokeBySessionID revokes the families issued with the session.
+	RevokeBySessionID(ctx context.Context, userID string, sessionID string) error
+	// MoveSession binds the families of a session to the session that replaced it.
+	MoveSession(ctx context.Context, from string, to string, ttl time.Duration) error
+	RevokeAllByUserID(ctx context.Context, userID string) error
+}
+
+type refreshTokenImpl struct {
+	client kvstore.Client
+}
+
+func NewRefreshToken(client kvstore.Client) RefreshToken {
+	return &refreshTokenImpl{client}
+}
+
+func (r *refreshTokenImpl) Create(ctx context.Context, token *model.RefreshToken) error {
+	ttl := int64(time.Until(token.ExpiresAt).Seconds())
+	if ttl <= 0 {
+		return fmt.Errorf("refresh token already expired")
+	}
+
+	raw, err := random.Token(32)
+	if err != nil {
+		return err
+	}
+
+	if token.FamilyID == "" {
+		familyID, err := random.Token(16)
+		if err != nil {
+			return err
+		}
+		if err := r.client.Set(ctx, r.getFamilyKey(familyID), token.UserID, kvstore.SetOptions{Expiration: ttl}); err != nil {
+			return err
+		}
+		indexKey := r.getUserKey(token.UserID)
+		if err := r.client.SAdd(ctx, indexKey, familyID); err != nil {
+			return err
+		}
+		if err := r.client.Expire(ctx, indexKey, ttl); err != nil {
+			return err
+		}
+		if token.SessionID != "" {
+			sessionKey := r.getSessionKey(token.SessionID)
+			if err := r.client.SAdd(ctx, sessionKey, familyID); err != nil {
+				return err
+			}
+			if err := r.client.Expire(ctx, sessionKey, ttl); err != nil {
+				return err
+			}
+		}
+		token.FamilyID = familyID
+	}
+
+	data, err := json.Marshal(token)
+	if err != nil {
+		return fmt.Errorf("failed to marshal refresh token: %v", err)
+	}
+	if err := r.client.Set(ctx, r.getKey(raw), string(data), kvstore.SetOptions{Expiration: ttl}); err != nil {
+		return err
+	}
+
+	token.Token = raw
+	return nil
+}
+
+func (r *refreshTokenImpl) Consume(ctx context.Context, raw string) (*model.RefreshToken, bool, error) {
+	if raw == "" {
+		return nil, false, nil
+	}
+
+	data, err := r.client.GetDel(ctx, r.getKey(raw))
+	if err != nil {
+		return nil, false, err
+	}
+	if data == "" {
+		// 使用済みのトークンが再び提示された
+		used, err := r.client.Get(ctx, r.getUsedKey(raw))
+		if err != nil {
+			return nil, false, err
+		}
+		if used == "" {
+			return nil, false, nil
+		}
+		token, err := r.unmarshal(used)
+		if err != nil {
+			return nil, false, err
+		}
+		return token, true, nil
+	}
+
+	token, err := r.unmarshal(data)
+	if err != nil {
+		return nil, false, err
+	}
+
+	// 再利用を検知できるようにファミリーの有効期限まで使用済みの印を残す
+	ttl := int64(time.Until(token.ExpiresAt).Seconds())
+	if ttl <= 0 {
+		return nil, false, nil
+	}
+	if err := r.client.Set(ctx, r.getUsedKey(raw), data, kvstore.SetOptions{Expiration: ttl}); err != nil {
+		return nil, false, err
+	}
+
+	// 失効したファミリーは削除されている
+	family, err := r.client.Get(ctx, r.getFamilyKey(token.FamilyID))
+	if err != nil {
+		return nil, false, err
+	}
+	if family == "" {
+		return nil, false, nil
+	}
+
+	token.Token = raw
+	return token, false, nil
+}
+
+func (r *refreshTokenImpl) RevokeFamily(ctx context.Context, token *model.RefreshToken) error {
+	if err := r.client.Delete(ctx, r.getFamilyKey(token.FamilyID)); err != nil {
+		return err
+	}
+	return r.client.SRem(ctx, r.getUserKey(token.UserID), token.FamilyID)
+}
+
+func (r *refreshTokenImpl) RevokeBySessionID(ctx context.Context, userID string, sessionID string) error {
+	sessionKey := r.getSessionKey(sessionID)
+	families, err := r.client.SMembers(ctx, sessionKey)
+	if err != nil {
+		return err
+	}
+	for _, familyID := range families {
+		if err := r.RevokeFamily(ctx, &model.RefreshToken{FamilyID: familyID, UserID: userID}); err != nil {
+			return err
+		}
+	}
+	return r.client.Delete(ctx, sessionKey)
+}
+
+func (r *refreshTokenImpl) MoveSession(ctx context.Context, from string, to string, ttl time.Duration) error {
+	fromKey := r.getSessionKey(from)
+	families, err := r.client.SMembers(ctx, fromKey)
+	if err != nil {
+		return err
+	}
+	if len(families) == 0 {
+		return nil
+	}
+	toKey := r.getSessionKey(to)
+	if err := r.client.SAdd(ctx, toKey, families...); err != nil {
+		return err
+	}
+	if err := r.client.Expire(ctx, toKey, int64(ttl.Seconds())); err != nil {
+		return err
+	}
+	return r.client.Delete(ctx, fromKey)
+}
+
+func (r *refreshTokenImpl) RevokeAllByUserID(ctx context.Context, userID string) error {
+	indexKey := r.getUserKey(userID)
+	families, err := r.client.SMembers(ctx, indexKey)
+	if err != nil {
+		return err
+	}
+	for _, familyID := range families {
+		if err := r.client.Delete(ctx, r.getFamilyKey(familyID)); err != nil {
+			return err
+		}
+	}
+	return r.client.Delete(ctx, indexKey)
+}
+
+func (r *refreshTokenImpl) unmarshal(data string) (*model.RefreshToken, error) {
+	var token model.RefreshToken
+	if err := json.Unmarshal([]byte(data), &token); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal refresh token: %v", err)
+	}
+	return &token, nil
+}
+
+// getKey stores tokens by hash so that a dump of the store can't be replayed.
+func (r *refreshTokenImpl) getKey(raw string) string {
+	return fmt.Sprintf("refresh_token:%s", hashToken(raw))
+}
+
+func (r *refreshTokenImpl) getUsedKey(raw string) string {
+	return fmt.Sprintf("refresh_token_used:%s", hashToken(raw))
+}
+
+func (r *refreshTokenImpl) getFamilyKey(familyID string) string {
+	return fmt.Sprintf("refresh_family:%s", familyID)
+}
+
+func (r *refreshTokenImpl) getUserKey(userID string) string {
+	return fmt.Sprintf("user_refresh_families:%s", userID)
+}
+
+func (r *refreshTokenImpl) getSessionKey(sessionID string) string {
+	return fmt.Sprintf("session_refresh_families:%s", sessionID)
+}
+
+func hashToken(raw string) string {
+	sum := sha256.Sum256([]byte(raw))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,92 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/kobayashiyabako16g/passkey-auth-example/internal/domain/model"
+	"github.com/kobayashiyabako16g/passkey-auth-example/pkg/db"
+	"github.com/kobayashiyabako16g/passkey-auth-example/pkg/logger"
+)
+
+// TOTP stores the confirmed TOTP authenticators, one per user.
+type TOTP interface {
+	Find(ctx context.Context, userID string) (*model.TOTPCredential, error)
+	// Save replaces the authenticator of the user.
+	Save(ctx context.Context, credential *model.TOTPCredential) error
+	// Delete reports false when the user had none.
+	Delete(ctx context.Context, userID string) (bool, error)
+}
+
+type totpRepository struct {
+	db *db.Client
+}
+
+func NewTOTP(db *db.Client) TOTP {
+	return &totpRepository{
+		db: db,
+	}
+}
+
+func (r *totpRepository) Find(ctx context.Context, userID string) (*model.TOTPCredential, error) {
+	stmt, err := r.db.PrepareContext(ctx, "SELECT user_id, secret, policy, created_at FROM totp_credentials WHERE user_id = $1")
+	if err != nil {
+		logger.Error(ctx, "Database Error", logger.WithError(err))
+		return nil, err
+	}
+	defer stmt.Close()
+
+	var credential model.TOTPCredential
+	var policy string
+	if err := stmt.QueryRowContext(ctx, userID).Scan(&credential.UserID, &credential.Secret, &policy, &credential.CreatedAt); err != nil {
+		//Not found
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		logger.Error(ctx, "Database Error", logger.WithError(err))
+		return nil, err
+	}
+	credential.Policy = model.TOTPPolicy(policy)
+
+	return &credential, nil
+}
+
+func (r *totpRepository) Save(ctx context.Context, credential *model.TOTPCredential) error {
+	stmt, err := r.db.PrepareContext(ctx, `INSERT INTO totp_credentials (user_id, secret, policy) VALUES ($1, $2, $3)
+		ON CONFLICT (user_id) DO UPDATE SET secret = EXCLUDED.secret, policy = EXCLUDED.policy, created_at = now()
+		RETURNING created_at`)
+	if err != nil {
+		logger.Error(ctx, "Database Error", logger.WithError(err))
+		return err
+	}
+	defer stmt.Close()
+
+	if err := stmt.QueryRowContext(ctx, credential.UserID, credential.Secret, string(credential.Policy)).Scan(&credential.CreatedAt); err != nil {
+		logger.Error(ctx, "Database Error", logger.WithError(err))
+		return err
+	}
+
+	return nil
+}
+
+func (r *totpRepository) Delete(ctx context.Context, userID string) (bool, error) {
+	stmt, err := r.db.PrepareContext(ctx, "DELETE FROM totp_credentials WHERE user_id = $1")
+	if err != nil {
+		logger.Error(ctx, "Database Error", logger.WithError(err))
+		return false, err
+	}
+	defer stmt.Close()
+
+	res, err := stmt.ExecContext(ctx, userID)
+	if err != nil {
+		logger.Error(ctx, "Database Error", logger.WithError(err))
+		return false, err
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		logger.Error(ctx, "Database Error", logger.WithError(err))
+		return false, err
+	}
+
+	return rows == 1, nil
+}
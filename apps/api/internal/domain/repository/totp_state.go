@@ -0,0 +1,100 @@
+package repository
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/kobayashiyabako16g/passkey-auth-example/pkg/kvstore"
+)
+
+// TOTPState keeps the short-lived TOTP state: pending enrollments, used time steps
+// and failed attempts.
+type TOTPState interface {
+	SaveEnrollment(ctx context.Context, userID string, secret []byte, ttl time.Duration) error
+	// FindEnrollment returns nil when there is no pending enrollment.
+	FindEnrollment(ctx context.Context, userID string) ([]byte, error)
+	DeleteEnrollment(ctx context.Context, userID string) error
+	// MarkUsed records the time step of an accepted code. It reports false when the step isn't
+	// later than the last accepted one, which is a replayed or an older code.
+	MarkUsed(ctx context.Context, userID string, counter int64, ttl time.Duration) (bool, error)
+	// CountAttempt counts a verification and returns the number of verifications
+	// in the current window, which starts with the first one.
+	CountAttempt(ctx context.Context, userID string, window time.Duration) (int64, error)
+}
+
+type totpStateImpl struct {
+	client kvstore.Client
+}
+
+func NewTOTPState(client kvstore.Client) TOTPState {
+	return &totpStateImpl{client}
+}
+
+func (t *totpStateImpl) SaveEnrollment(ctx context.Context, userID string, secret []byte, ttl time.Duration) error {
+	value := base64.StdEncoding.EncodeToString(secret)
+	return t.client.Set(ctx, t.getEnrollmentKey(userID), value, kvstore.SetOptions{Expiration: int64(ttl.Seconds())})
+}
+
+func (t *totpStateImpl) FindEnrollment(ctx context.Context, userID string) ([]byte, error) {
+	value, err := t.client.Get(ctx, t.getEnrollmentKey(userID))
+	if err != nil {
+		return nil, err
+	}
+	if value == "" {
+		return nil, nil
+	}
+	return base64.StdEncoding.DecodeString(value)
+}
+
+func (t *totpStateImpl) DeleteEnrollment(ctx context.Context, userID string) error {
+	return t.client.Delete(ctx, t.getEnrollmentKey(userID))
+}
+
+// markUsedScript stores the counter only when it's later than the stored one.
+const markUsedScript = `
+local last = tonumber(redis.call("GET", KEYS[1]))
+if last and tonumber(ARGV[1]) <= last then
+  return 0
+end
+redis.call("SET", KEYS[1], ARGV[1], "EX", ARGV[2])
+return 1
+`
+
+func (t *totpStateImpl) MarkUsed(ctx context.Context, userID string, counter int64, ttl time.Duration) (bool, error) {
+	// 最後に受け付けたカウンター以前のコードは使えない
+	ok, err := t.client.EvalInt(ctx, markUsedScript, []string{t.getUsedKey(userID)},
+		strconv.FormatInt(counter, 10), strconv.FormatInt(int64(ttl.Seconds()), 10))
+	if err != nil {
+		return false, err
+	}
+	return ok == 1, nil
+}
+
+func (t *totpStateImpl) CountAttempt(ctx context.Context, userID string, window time.Duration) (int64, error) {
+	key := t.getAttemptKey(userID)
+	count, err := t.client.Incr(ctx, key)
+	if err != nil {
+		return 0, err
+	}
+	if count == 1 {
+		if err := t.client.Expire(ctx, key, int64(window.Seconds())); err != nil {
+			return 0, err
+		}
+	}
+	return count, nil
+}
+
+func (t *totpStateImpl) getEnrollmentKey(userID string) string {
+	return fmt.Sprintf("totp_enrollment:%s", userID)
+}
+
+func (t *totpStateImpl) getUsedKey(userID string) string {
+	return fmt.Sprintf("totp_last_used:%s", userID)
+}
+
+func (t *totpStateImpl) getAttemptKey(userID string) string {
+	return fmt.Sprintf("totp_attempt:%s", userID)
+}
@@ -3,20 +3,45 @@ package repository
 import (
 	"context"
 	"database/sql"
-	"encoding/json"
+	"errors"
 	"fmt"
 
 	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/kobayashiyabako16g/passkey-auth-example/internal/domain/model"
 	"github.com/kobayashiyabako16g/passkey-auth-example/pkg/db"
 	"github.com/kobayashiyabako16g/passkey-auth-example/pkg/logger"
 )
 
+// ErrEmailTaken is returned by VerifyEmail when another user has verified the address.
+var ErrEmailTaken = errors.New("email already verified by another user")
+
+// ErrUsernameTaken is returned by Rename when another user has the name.
+var ErrUsernameTaken = errors.New("username already taken")
+
 type User interface {
 	ExistsByUsername(ctx context.Context, username string) (bool, error)
 	Create(ctx context.Context, user *model.User) error
+	AddCredential(ctx context.Context, userID string, credential *webauthn.Credential) error
+	UpdateCredential(ctx context.Context, userID string, credential *webauthn.Credential) error
 	FindByUsername(ctx context.Context, username string) (*model.User, error)
 	FindById(ctx context.Context, id string) (*model.User, error)
+	// FindByEmail looks up a normalized email address. Unverified addresses don't match.
+	FindByEmail(ctx context.Context, email string) (*model.User, error)
+	// VerifyEmail sets the email address of the user as verified.
+	VerifyEmail(ctx context.Context, id string, email string) error
+	// Rename changes the username. It returns ErrUsernameTaken when another user has it.
+	Rename(ctx context.Context, id string, username string) error
+	// Delete removes the user with their credentials, password, TOTP, enrollment links, clone events and recovery codes.
+	Delete(ctx context.Context, id string) error
+	ListCredentials(ctx context.Context, userID string) ([]model.Credential, error)
+	FindCredential(ctx context.Context, userID string, id string) (*model.Credential, error)
+	FindCredentialByCredentialID(ctx context.Context, userID string, credentialID []byte) (*model.Credential, error)
+	RenameCredential(ctx context.Context, userID string, id string, name string) error
+	DeleteCredential(ctx context.Context, userID string, id string) error
+	RecordCloneEvent(ctx context.Context, userID string, credential *webauthn.Credential, policy model.ClonePolicy) error
+	QuarantineCredential(ctx context.Context, userID string, credentialID []byte) error
+	ClearQuarantine(ctx context.Context, userID string, id string) error
 }
 
 type userRepository struct {
@@ -53,61 +78,53 @@ func (r *userRepository) ExistsByUsername(ctx context.Context, username string)
 }
 
 func (r *userRepository) Create(ctx context.Context, user *model.User) error {
-	// users table
-	stmt, err := r.db.PrepareContext(ctx, "INSERT INTO users (id, name, display_name) VALUES ($1, $2, $3)")
+	// ユーザーとパスキーはまとめて登録する
+	tx, err := r.db.BeginTx(ctx, nil)
 	if err != nil {
 		logger.Error(ctx, "Database Error", logger.WithError(err))
 		return err
 	}
-	defer stmt.Close()
+	defer tx.Rollback()
 
-	res, err := stmt.ExecContext(ctx, user.ID, user.Name, user.DisplayName)
+	// users table
+	stmt, err := tx.PrepareContext(ctx, "INSERT INTO users (id, name, display_name, email) VALUES ($1, $2, $3, $4)")
 	if err != nil {
 		logger.Error(ctx, "Database Error", logger.WithError(err))
 		return err
 	}
+	defer stmt.Close()
 
-	row, err := res.RowsAffected()
+	res, err := stmt.ExecContext(ctx, user.ID, user.Name, user.DisplayName, sql.NullString{String: user.Email, Valid: user.Email != ""})
 	if err != nil {
 		logger.Error(ctx, "Database Error", logger.WithError(err))
 		return err
 	}
 
-	logger.Debug(ctx, fmt.Sprintf("Last Insert user id: %v", row))
-
-	// credentials table
-	jsonData, err := json.Marshal(user.Credentials[0])
+	row, err := res.RowsAffected()
 	if err != nil {
 		logger.Error(ctx, "Database Error", logger.WithError(err))
 		return err
 	}
 
-	stmt, err = r.db.PrepareContext(ctx, "INSERT INTO credentials (user_id, metadata) VALUES ($1, $2)")
-	if err != nil {
-		logger.Error(ctx, "Database Error", logger.WithError(err))
-		return err
-	}
-	defer stmt.Close()
+	logger.Debug(ctx, fmt.Sprintf("Last Insert user id: %v", row))
 
-	res, err = stmt.ExecContext(ctx, user.ID, jsonData)
-	if err != nil {
-		logger.Error(ctx, "Database Error", logger.WithError(err))
-		return err
+	// credentials table
+	for i := range user.Credentials {
+		if err := addCredential(ctx, tx, user.ID, &user.Credentials[i]); err != nil {
+			return err
+		}
 	}
 
-	row, err = res.RowsAffected()
-	if err != nil {
+	if err := tx.Commit(); err != nil {
 		logger.Error(ctx, "Database Error", logger.WithError(err))
 		return err
 	}
 
-	logger.Debug(ctx, fmt.Sprintf("Last Insert session id: %v", row))
-
 	return nil
 }
 
 func (r *userRepository) FindByUsername(ctx context.Context, username string) (*model.User, error) {
-	stmt, err := r.db.PrepareContext(ctx, "SELECT id, name, display_name FROM users WHERE name = $1")
+	stmt, err := r.db.PrepareContext(ctx, "SELECT id, name, display_name, email, email_verified_at IS NOT NULL FROM users WHERE name = $1")
 	if err != nil {
 		logger.Error(ctx, "Database Error", logger.WithError(err))
 		return nil, err
@@ -115,7 +132,9 @@ func (r *userRepository) FindByUsername(ctx context.Context, username string) (*
 	defer stmt.Close()
 
 	var user model.User
-	if err = stmt.QueryRowContext(ctx, username).Scan(&user.ID, &user.Name, &user.DisplayName); err != nil {
+	var email sql.NullString
+	var emailVerified bool
+	if err = stmt.QueryRowContext(ctx, username).Scan(&user.ID, &user.Name, &user.DisplayName, &email, &emailVerified); err != nil {
 
 		//Not found
 		if err == sql.ErrNoRows {
@@ -126,44 +145,14 @@ func (r *userRepository) FindByUsername(ctx context.Context, username string) (*
 		return nil, err
 	}
 	logger.Info(ctx, fmt.Sprintf("Exists username: %s,  id: %v  ", username, user.ID))
+	user.Email = email.String
+	user.EmailVerified = emailVerified
 
 	// credentials table select
-	stmt, err = r.db.PrepareContext(ctx, "SELECT metadata FROM credentials WHERE user_id = $1")
-	if err != nil {
-		logger.Error(ctx, "Database Error", logger.WithError(err))
-		return nil, err
-	}
-	defer stmt.Close()
-
-	rows, err := stmt.QueryContext(ctx, user.ID)
+	credentials, err := r.findWebAuthnCredentials(ctx, user.ID)
 	if err != nil {
-		logger.Error(ctx, "Database Error", logger.WithError(err))
-		return nil, err
-	}
-	defer rows.Close()
-
-	var credentials []webauthn.Credential
-	for rows.Next() {
-		var metadata []byte
-		if err := rows.Scan(&metadata); err != nil {
-			logger.Error(ctx, "Database Error", logger.WithError(err))
-			return nil, err
-		}
-
-		var credential webauthn.Credential
-		if err := json.Unmarshal(metadata, &credential); err != nil {
-			logger.Error(ctx, "JSON Unmarshal Error", logger.WithError(err))
-			continue // Skip this credential but continue with others
-		}
-
-		credentials = append(credentials, credential)
-	}
-
-	if err := rows.Err(); err != nil { // ADDED: check for iteration errors
-		logger.Error(ctx, "Database Rows Error", logger.WithError(err))
 		return nil, err
 	}
-
 	user.Credentials = credentials
 
 	logger.Info(ctx, fmt.Sprintf("Repo: Found user %s with %d credentials", username, len(credentials)))
@@ -174,7 +163,7 @@ func (r *userRepository) FindByUsername(ctx context.Context, username string) (*
 func (r *userRepository) FindById(ctx context.Context, id string) (*model.User, error) {
 	logger.Info(ctx, fmt.Sprintf("Repo: FindById %s", id))
 
-	stmt, err := r.db.PrepareContext(ctx, "SELECT id, name, display_name FROM users WHERE id = $1")
+	stmt, err := r.db.PrepareContext(ctx, "SELECT id, name, display_name, email, email_verified_at IS NOT NULL FROM users WHERE id = $1")
 	if err != nil {
 		logger.Error(ctx, "Database Error", logger.WithError(err))
 		return nil, err
@@ -182,7 +171,9 @@ func (r *userRepository) FindById(ctx context.Context, id string) (*model.User,
 	defer stmt.Close()
 
 	var user model.User
-	if err = stmt.QueryRowContext(ctx, id).Scan(&user.ID, &user.Name, &user.DisplayName); err != nil {
+	var email sql.NullString
+	var emailVerified bool
+	if err = stmt.QueryRowContext(ctx, id).Scan(&user.ID, &user.Name, &user.DisplayName, &email, &emailVerified); err != nil {
 
 		//Not found
 		if err == sql.ErrNoRows {
@@ -193,48 +184,114 @@ func (r *userRepository) FindById(ctx context.Context, id string) (*model.User,
 		return nil, err
 	}
 	logger.Info(ctx, fmt.Sprintf("Exists username: %s,  id: %v  ", id, user.ID))
+	user.Email = email.String
+	user.EmailVerified = emailVerified
 
 	// credentials table select
-	stmt, err = r.db.PrepareContext(ctx, "SELECT metadata FROM credentials WHERE user_id = $1")
+	credentials, err := r.findWebAuthnCredentials(ctx, user.ID)
 	if err != nil {
-		logger.Error(ctx, "Database Error", logger.WithError(err))
 		return nil, err
 	}
-	defer stmt.Close()
+	user.Credentials = credentials
+
+	logger.Info(ctx, fmt.Sprintf("Repo: Found user %s with %d credentials", user.Name, len(credentials)))
 
-	rows, err := stmt.QueryContext(ctx, user.ID)
+	return &user, nil
+}
+
+func (r *userRepository) FindByEmail(ctx context.Context, email string) (*model.User, error) {
+	stmt, err := r.db.PrepareContext(ctx, "SELECT id FROM users WHERE email = $1 AND email_verified_at IS NOT NULL")
 	if err != nil {
 		logger.Error(ctx, "Database Error", logger.WithError(err))
 		return nil, err
 	}
-	defer rows.Close()
+	defer stmt.Close()
 
-	var credentials []webauthn.Credential
-	for rows.Next() {
-		var metadata []byte
-		if err := rows.Scan(&metadata); err != nil {
-			logger.Error(ctx, "Database Error", logger.WithError(err))
-			return nil, err
+	var id string
+	if err = stmt.QueryRowContext(ctx, email).Scan(&id); err != nil {
+		//Not found
+		if err == sql.ErrNoRows {
+			return nil, nil
 		}
+		logger.Error(ctx, "Database Error", logger.WithError(err))
+		return nil, err
+	}
+
+	return r.FindById(ctx, id)
+}
 
-		var credential webauthn.Credential
-		if err := json.Unmarshal(metadata, &credential); err != nil {
-			logger.Error(ctx, "JSON Unmarshal Error", logger.WithError(err))
-			continue // Skip this credential but continue with others
+func (r *userRepository) VerifyEmail(ctx context.Context, id string, email string) error {
+	stmt, err := r.db.PrepareContext(ctx, "UPDATE users SET email = $1, email_verified_at = now() WHERE id = $2")
+	if err != nil {
+		logger.Error(ctx, "Database Error", logger.WithError(err))
+		return err
+	}
+	defer stmt.Close()
+
+	if _, err := stmt.ExecContext(ctx, email, id); err != nil {
+		// 確認済みアドレスの一意インデックスに同時の確認が当たった場合
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" && pgErr.ConstraintName == "users_verified_email_idx" {
+			logger.Info(ctx, "email already verified by another user")
+			return ErrEmailTaken
 		}
+		logger.Error(ctx, "Database Error", logger.WithError(err))
+		return err
+	}
+
+	return nil
+}
 
-		credentials = append(credentials, credential)
+func (r *userRepository) Rename(ctx context.Context, id string, username string) error {
+	stmt, err := r.db.PrepareContext(ctx, "UPDATE users SET name = $1 WHERE id = $2")
+	if err != nil {
+		logger.Error(ctx, "Database Error", logger.WithError(err))
+		return err
 	}
+	defer stmt.Close()
 
-	if err := rows.Err(); err != nil { // ADDED: check for iteration errors
-		logger.Error(ctx, "Database Rows Error", logger.WithError(err))
-		return nil, err
+	if _, err := stmt.ExecContext(ctx, username, id); err != nil {
+		// 確認後に同じ名前が登録された場合
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" && pgErr.ConstraintName == "users_name_key" {
+			logger.Info(ctx, "username already taken")
+			return ErrUsernameTaken
+		}
+		logger.Error(ctx, "Database Error", logger.WithError(err))
+		return err
 	}
 
-	user.Credentials = credentials
+	return nil
+}
 
-	logger.Info(ctx, fmt.Sprintf("Repo: Found user %s with %d credentials", user.Name, len(credentials)))
+func (r *userRepository) Delete(ctx context.Context, id string) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		logger.Error(ctx, "Database Error", logger.WithError(err))
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, query := range []string{
+		"DELETE FROM credential_clone_events WHERE user_id = $1",
+		"DELETE FROM recovery_codes WHERE user_id = $1",
+		"DELETE FROM password_credentials WHERE user_id = $1",
+		"DELETE FROM totp_credentials WHERE user_id = $1",
+		"DELETE FROM enrollment_tokens WHERE user_id = $1",
+		"DELETE FROM credentials WHERE user_id = $1",
+		"DELETE FROM users WHERE id = $1",
+	} {
+		if _, err := tx.ExecContext(ctx, query, id); err != nil {
+			logger.Error(ctx, "Database Error", logger.WithError(err))
+			return err
+		}
+	}
 
-	return &user, nil
+	if err := tx.Commit(); err != nil {
+		logger.Error(ctx, "Database Error", logger.WithError(err))
+		return err
+	}
+	logger.Debug(ctx, fmt.Sprintf("Deleted user %s", id))
 
+	return nil
 }
@@ -0,0 +1,84 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/kobayashiyabako16g/passkey-auth-example/internal/contexts"
+	"github.com/kobayashiyabako16g/passkey-auth-example/internal/ui/handler/request"
+	"github.com/kobayashiyabako16g/passkey-auth-example/internal/usecase"
+	dtos "github.com/kobayashiyabako16g/passkey-auth-example/internal/usecase/dto/account"
+	"github.com/kobayashiyabako16g/passkey-auth-example/pkg/logger"
+)
+
+type Account interface {
+	ChangeUsername(w http.ResponseWriter, r *http.Request)
+	DeleteAccount(w http.ResponseWriter, r *http.Request)
+}
+
+type account struct {
+	usecase usecase.Account
+}
+
+func NewAccount(usecase usecase.Account) Account {
+	return &account{usecase}
+}
+
+func (h *account) ChangeUsername(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	logger.Info(ctx, "change username ----------------------")
+
+	// 認証済みのユーザー (RequireAuth で設定)
+	user := contexts.GetUser(ctx)
+	if user == nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req request.ChangeUsername
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		logger.Info(ctx, "can't decode change username request", logger.WithError(err))
+		http.Error(w, "Bad Requset", http.StatusBadRequest)
+		return
+	}
+
+	err := h.usecase.ChangeUsername(ctx, dtos.ChangeUsernameRequest{
+		User:     user,
+		Username: req.Username,
+	})
+	if err != nil {
+		switch err {
+		case dtos.ErrInvalidUsername:
+			http.Error(w, "Bad Requset", http.StatusBadRequest)
+		case dtos.ErrUserExists:
+			http.Error(w, "Username already exists", http.StatusConflict)
+		default:
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "success"})
+}
+
+func (h *account) DeleteAccount(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	logger.Info(ctx, "delete account ----------------------")
+
+	// 認証済みのユーザー (RequireAuth で設定)
+	user := contexts.GetUser(ctx)
+	if user == nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	if err := h.usecase.DeleteAccount(ctx, dtos.DeleteAccountRequest{User: user}); err != nil {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	clearCookie(w, sessionCookieName)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "success"})
+}
@@ -0,0 +1,222 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/kobayashiyabako16g/passkey-auth-example/internal/ui/handler/request"
+	"github.com/kobayashiyabako16g/passkey-auth-example/internal/ui/handler/response"
+	"github.com/kobayashiyabako16g/passkey-auth-example/internal/usecase"
+	dtos "github.com/kobayashiyabako16g/passkey-auth-example/internal/usecase/dto/admin"
+	"github.com/kobayashiyabako16g/passkey-auth-example/pkg/logger"
+)
+
+type Admin interface {
+	ListCredentials(w http.ResponseWriter, r *http.Request)
+	ClearQuarantine(w http.ResponseWriter, r *http.Request)
+	RegisterClient(w http.ResponseWriter, r *http.Request)
+	ListAuditEvents(w http.ResponseWriter, r *http.Request)
+	CreateUser(w http.ResponseWriter, r *http.Request)
+	IssueEnrollmentLink(w http.ResponseWriter, r *http.Request)
+}
+
+type admin struct {
+	usecase usecase.Admin
+}
+
+func NewAdmin(usecase usecase.Admin) Admin {
+	return &admin{usecase}
+}
+
+func (h *admin) ListCredentials(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	userID := r.PathValue("userID")
+	if _, err := uuid.Parse(userID); err != nil {
+		http.Error(w, "Not Found", http.StatusNotFound)
+		return
+	}
+
+	result, err := h.usecase.ListCredentials(ctx, dtos.ListCredentialsRequest{UserID: userID})
+	if err != nil {
+		switch err {
+		case dtos.ErrUserNotFound:
+			http.Error(w, "Not Found", http.StatusNotFound)
+		default:
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response.NewCredentials(result.Credentials)); err != nil {
+		logger.Error(ctx, "Failed to write response", logger.WithError(err))
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+}
+
+func (h *admin) ClearQuarantine(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	userID := r.PathValue("userID")
+	id := r.PathValue("id")
+	if _, err := uuid.Parse(userID); err != nil {
+		http.Error(w, "Not Found", http.StatusNotFound)
+		return
+	}
+	if _, err := uuid.Parse(id); err != nil {
+		http.Error(w, "Not Found", http.StatusNotFound)
+		return
+	}
+
+	err := h.usecase.ClearQuarantine(ctx, dtos.ClearQuarantineRequest{UserID: userID, ID: id})
+	if err != nil {
+		switch err {
+		case dtos.ErrCredentialNotFound:
+			http.Error(w, "Not Found", http.StatusNotFound)
+		default:
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "success"})
+}
+
+func (h *admin) RegisterClient(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var req request.RegisterClient
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		logger.Info(ctx, "can't decode client data", logger.WithError(err))
+		http.Error(w, "Bad Requset", http.StatusBadRequest)
+		return
+	}
+
+	result, err := h.usecase.RegisterClient(ctx, dtos.RegisterClientRequest{
+		Name:           req.Name,
+		RedirectURIs:   req.RedirectURIs,
+		Public:         req.Public,
+		ResourceServer: req.ResourceServer,
+	})
+	if err != nil {
+		switch err {
+		case dtos.ErrInvalidClient:
+			http.Error(w, "Bad Requset", http.StatusBadRequest)
+		default:
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(response.NewClient(result.Client, result.Secret)); err != nil {
+		logger.Error(ctx, "Failed to write response", logger.WithError(err))
+		return
+	}
+}
+
+func (h *admin) ListAuditEvents(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	userID := r.PathValue("userID")
+	if _, err := uuid.Parse(userID); err != nil {
+		http.Error(w, "Not Found", http.StatusNotFound)
+		return
+	}
+
+	result, err := h.usecase.ListAuditEvents(ctx, dtos.ListAuditEventsRequest{UserID: userID})
+	if err != nil {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response.NewAuditEvents(result.Events)); err != nil {
+		logger.Error(ctx, "Failed to write response", logger.WithError(err))
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+}
+
+// CreateUser provisions a user and returns the link that lets them enroll a passkey.
+func (h *admin) CreateUser(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var req request.CreateUser
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		logger.Info(ctx, "can't decode user data", logger.WithError(err))
+		http.Error(w, "Bad Requset", http.StatusBadRequest)
+		return
+	}
+
+	result, err := h.usecase.CreateUser(ctx, dtos.CreateUserRequest{
+		Username:    req.Username,
+		DisplayName: req.DisplayName,
+		Email:       req.Email,
+		IP:          clientIP(r),
+		UserAgent:   r.UserAgent(),
+	})
+	if err != nil {
+		switch err {
+		case dtos.ErrInvalidUser:
+			http.Error(w, "Bad Requset", http.StatusBadRequest)
+		case dtos.ErrUserExists:
+			http.Error(w, "Username already exists", http.StatusConflict)
+		case dtos.ErrEmailExists:
+			http.Error(w, "Email already exists", http.StatusConflict)
+		default:
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	// 登録リンクはこのレスポンスでしか取得できない
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(response.NewProvisionedUser(result.User, result.EnrollmentURL, result.ExpiresAt)); err != nil {
+		logger.Error(ctx, "Failed to write response", logger.WithError(err))
+		return
+	}
+}
+
+func (h *admin) IssueEnrollmentLink(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	userID := r.PathValue("userID")
+	if _, err := uuid.Parse(userID); err != nil {
+		http.Error(w, "Not Found", http.StatusNotFound)
+		return
+	}
+
+	result, err := h.usecase.IssueEnrollmentLink(ctx, dtos.IssueEnrollmentLinkRequest{
+		UserID:    userID,
+		IP:        clientIP(r),
+		UserAgent: r.UserAgent(),
+	})
+	if err != nil {
+		switch err {
+		case dtos.ErrUserNotFound:
+			http.Error(w, "Not Found", http.StatusNotFound)
+		case dtos.ErrUserEnrolled:
+			http.Error(w, "User already enrolled", http.StatusConflict)
+		default:
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(response.EnrollmentLink{URL: result.EnrollmentURL, ExpiresAt: result.ExpiresAt}); err != nil {
+		logger.Error(ctx, "Failed to write response", logger.WithError(err))
+		return
+	}
+}
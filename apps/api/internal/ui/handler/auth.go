@@ -2,10 +2,12 @@ package handler
 
 import (
 	"encoding/json"
+	"io"
 	"net/http"
 
-	"github.com/kobayashiyabako16g/passkey-auth-example/internal/domain/model"
+	"github.com/kobayashiyabako16g/passkey-auth-example/internal/contexts"
 	"github.com/kobayashiyabako16g/passkey-auth-example/internal/ui/handler/request"
+	"github.com/kobayashiyabako16g/passkey-auth-example/internal/ui/handler/response"
 	"github.com/kobayashiyabako16g/passkey-auth-example/internal/usecase"
 	dtos "github.com/kobayashiyabako16g/passkey-auth-example/internal/usecase/dto/auth"
 	"github.com/kobayashiyabako16g/passkey-auth-example/pkg/logger"
@@ -16,6 +18,8 @@ type Auth interface {
 	FinishRegistration(w http.ResponseWriter, r *http.Request)
 	BeginLogin(w http.ResponseWriter, r *http.Request)
 	FinishLogin(w http.ResponseWriter, r *http.Request)
+	BeginReauth(w http.ResponseWriter, r *http.Request)
+	FinishReauth(w http.ResponseWriter, r *http.Request)
 }
 
 type auth struct {
@@ -26,18 +30,6 @@ func NewAuth(usecase usecase.Auth) Auth {
 	return &auth{usecase}
 }
 
-func (s *auth) setSessionCookie(w *http.ResponseWriter, session *model.Session) {
-	http.SetCookie(*w, &http.Cookie{
-		Name:     "session",
-		Value:    session.ID,
-		Path:     "/",
-		HttpOnly: true,
-		SameSite: http.SameSiteNoneMode, // Required for cross-origin requests
-		Secure:   true,                  // Set to true in production with HTTPS
-		Expires:  session.ExpiresAt,
-	})
-}
-
 func (h *auth) BeginRegistration(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	logger.Info(ctx, "begin registration ----------------------")
@@ -48,19 +40,27 @@ func (h *auth) BeginRegistration(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Bad Requset", http.StatusBadRequest)
 		return
 	}
-	if req.Username == "" {
+	if req.Username == "" && req.EnrollmentToken == "" {
 		logger.Info(ctx, "username is empty")
 		http.Error(w, "Bad Requset", http.StatusBadRequest)
 		return
 	}
 
 	result, err := h.usecase.BeginRegistration(ctx, dtos.BeginRegistrationRequest{
-		Username: req.Username,
+		Username:        req.Username,
+		Email:           req.Email,
+		EnrollmentToken: req.EnrollmentToken,
 	})
 	if err != nil {
 		switch err {
 		case dtos.ErrUserExists:
 			http.Error(w, "Username already exists", http.StatusConflict)
+		case dtos.ErrEnrollmentNotFound:
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		case dtos.ErrEmailExists:
+			http.Error(w, "Email already exists", http.StatusConflict)
+		case dtos.ErrInvalidEmail:
+			http.Error(w, "Bad Requset", http.StatusBadRequest)
 		default:
 			logger.Error(ctx, "Failed to begin registration", logger.WithError(err))
 			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
@@ -69,7 +69,7 @@ func (h *auth) BeginRegistration(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// クッキー生成
-	h.setSessionCookie(&w, result.Session)
+	setCeremonyCookie(w, result.Ceremony)
 
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(result.Cred); err != nil {
@@ -83,54 +83,52 @@ func (h *auth) FinishRegistration(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	logger.Info(ctx, "finish registration ----------------------")
 
-	// セッション確認
-	cookie, err := r.Cookie("session")
-	if err != nil {
-		logger.Info(ctx, "Handler: session cookie is not found")
-		http.Error(w, "Bad Requset", http.StatusBadRequest)
-		return
-	}
-	if cookie.Value == "" {
-		logger.Info(ctx, "Handler: session cookie is empty")
+	// セレモニー確認
+	ceremonyID, ok := ceremonyCookie(r)
+	if !ok {
+		logger.Info(ctx, "Handler: ceremony cookie is not found")
 		http.Error(w, "Bad Requset", http.StatusBadRequest)
 		return
 	}
 
-	err = h.usecase.FinishRegistration(ctx, dtos.FinishRegistrationRequest{
-		Session: cookie.Value,
-		Request: r,
+	result, err := h.usecase.FinishRegistration(ctx, dtos.FinishRegistrationRequest{
+		Ceremony:  ceremonyID,
+		IP:        clientIP(r),
+		UserAgent: r.UserAgent(),
+		Request:   r,
 	})
+	// clean up ceremony cookie
+	clearCookie(w, ceremonyCookieName)
 	if err != nil {
 		switch err {
 		case dtos.ErrUserExists:
 			http.Error(w, "Bad Requset", http.StatusBadRequest)
-		case dtos.ErrFinishRegistration:
+		case dtos.ErrSessionNotFound, dtos.ErrFinishRegistration:
 			http.Error(w, "Bad Requset", http.StatusBadRequest)
+		case dtos.ErrEnrollmentNotFound:
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
 		default:
 			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 		}
-		// clean up sid cookie
-		http.SetCookie(w, &http.Cookie{
-			Name:  "sid",
-			Value: "",
-		})
 		return
 	}
 
-	http.SetCookie(w, &http.Cookie{
-		Name:  "sid",
-		Value: "",
-	})
+	// リカバリーコードはこのレスポンスでしか表示できない
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{"status": "success"})
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(map[string]any{
+		"status":        "success",
+		"recoveryCodes": result.RecoveryCodes,
+	})
 }
 
 func (h *auth) BeginLogin(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	logger.Info(ctx, "begin Login ----------------------")
 
+	// username は任意 (空なら Conditional UI でのログイン)
 	var req request.User
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
 		logger.Info(ctx, "can't decode user data", logger.WithError(err))
 		http.Error(w, "Bad Requset", http.StatusBadRequest)
 		return
@@ -138,11 +136,10 @@ func (h *auth) BeginLogin(w http.ResponseWriter, r *http.Request) {
 
 	var login dtos.BeginLoginRequest
 	login.Username = req.Username
-	// セッション確認
-	cookie, err := r.Cookie("session")
-	if err == nil {
-		logger.Info(ctx, "session cookie is not found")
-		login.Session = cookie.Value
+	login.Email = req.Email
+	// 再認証中のセレモニーがあれば引き継ぐ
+	if ceremonyID, ok := ceremonyCookie(r); ok {
+		login.Ceremony = ceremonyID
 	}
 
 	// usecase
@@ -151,13 +148,15 @@ func (h *auth) BeginLogin(w http.ResponseWriter, r *http.Request) {
 		switch err {
 		case dtos.ErrUserNotFound:
 			http.Error(w, "Bad Requset", http.StatusBadRequest)
+		case dtos.ErrCloneDetected:
+			http.Error(w, "Forbidden", http.StatusForbidden)
 		default:
 			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 		}
 		return
 	}
 
-	h.setSessionCookie(&w, result.Session)
+	setCeremonyCookie(w, result.Ceremony)
 
 	// option返却
 	w.Header().Set("Content-Type", "application/json")
@@ -172,33 +171,131 @@ func (h *auth) FinishLogin(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	logger.Info(ctx, "Finish login ----------------------")
 
-	// セッション確認
-	cookie, err := r.Cookie("session")
-	if err != nil {
-		logger.Info(ctx, "session cookie is not found")
-		http.Error(w, "Bad Requset", http.StatusBadRequest)
-		return
-	}
-	if cookie.Value == "" {
-		logger.Info(ctx, "session cookie is empty")
+	// セレモニー確認
+	ceremonyID, ok := ceremonyCookie(r)
+	if !ok {
+		logger.Info(ctx, "ceremony cookie is not found")
 		http.Error(w, "Bad Requset", http.StatusBadRequest)
 		return
 	}
+	sessionID, _ := sessionCookie(r)
 
 	// usecase
-	err = h.usecase.FinishLogin(ctx, dtos.FinishLoginRequest{
-		Session: cookie.Value,
-		Request: r,
+	result, err := h.usecase.FinishLogin(ctx, dtos.FinishLoginRequest{
+		Ceremony:  ceremonyID,
+		Session:   sessionID,
+		IP:        clientIP(r),
+		UserAgent: r.UserAgent(),
+		// ?tokens=true でアクセストークンとリフレッシュトークンも発行する
+		IssueTokens: r.URL.Query().Get("tokens") == "true",
+		Request:     r,
 	})
 	if err != nil {
 		switch err {
 		case dtos.ErrSessionNotFound:
 			http.Error(w, "Bad Requset", http.StatusBadRequest)
+		case dtos.ErrAssertionFailed:
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		case dtos.ErrCloneDetected:
+			clearCookie(w, ceremonyCookieName)
+			http.Error(w, "Forbidden", http.StatusForbidden)
+		case dtos.ErrStepUpRequired:
+			// クライアントは別のパスキーで再度ログインする
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusUnauthorized)
+			json.NewEncoder(w).Encode(map[string]string{"error": "step_up_required"})
 		default:
 			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 		}
 		return
 	}
+
+	clearCookie(w, ceremonyCookieName)
+	setSessionCookie(w, result.Session)
+
 	w.Header().Set("Content-Type", "application/json")
+	if result.Session.SecondFactorRequired {
+		// クライアントは /auth/totp/verify で TOTP のコードを送る
+		json.NewEncoder(w).Encode(map[string]string{"status": "second_factor_required"})
+		return
+	}
+	if result.Tokens != nil {
+		w.Header().Set("Cache-Control", "no-store")
+		json.NewEncoder(w).Encode(response.NewToken(result.Tokens))
+		return
+	}
 	json.NewEncoder(w).Encode(map[string]string{"status": "success"})
 }
+
+func (h *auth) BeginReauth(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	logger.Info(ctx, "Begin reauth ----------------------")
+
+	// 認証済みのユーザー (RequireAuth で設定)
+	user := contexts.GetUser(ctx)
+	if user == nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	result, err := h.usecase.BeginReauth(ctx, dtos.BeginReauthRequest{User: user})
+	if err != nil {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	setCeremonyCookie(w, result.Ceremony)
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(result.Cred); err != nil {
+		logger.Error(ctx, "Failed to write response", logger.WithError(err))
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+}
+
+func (h *auth) FinishReauth(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	logger.Info(ctx, "Finish reauth ----------------------")
+
+	// 認証済みのユーザーとセッション (RequireAuth で設定)
+	user := contexts.GetUser(ctx)
+	current := contexts.GetSession(ctx)
+	if user == nil || current == nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	ceremonyID, ok := ceremonyCookie(r)
+	if !ok {
+		logger.Info(ctx, "ceremony cookie is not found")
+		http.Error(w, "Bad Requset", http.StatusBadRequest)
+		return
+	}
+
+	result, err := h.usecase.FinishReauth(ctx, dtos.FinishReauthRequest{
+		User:     user,
+		Session:  current,
+		Ceremony: ceremonyID,
+		Request:  r,
+	})
+	clearCookie(w, ceremonyCookieName)
+	if err != nil {
+		switch err {
+		case dtos.ErrSessionNotFound, dtos.ErrReauthFailed:
+			http.Error(w, "Bad Requset", http.StatusBadRequest)
+		case dtos.ErrCloneDetected:
+			http.Error(w, "Forbidden", http.StatusForbidden)
+		default:
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	setSessionCookie(w, result.Session)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"status":   "success",
+		"authTime": result.Session.AuthTime,
+	})
+}
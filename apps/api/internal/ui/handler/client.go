@@ -0,0 +1,21 @@
+package handler
+
+import (
+	"net"
+	"net/http"
+
+	"github.com/kobayashiyabako16g/passkey-auth-example/internal/contexts"
+)
+
+// clientIP returns the address of the client, as resolved by middleware.RealIPMiddleware
+// from the X-Forwarded-For of trusted proxies.
+func clientIP(r *http.Request) string {
+	if ip := contexts.GetClientIP(r.Context()); ip != "" {
+		return ip
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,76 @@
+package handler
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/kobayashiyabako16g/passkey-auth-example/internal/domain/model"
+)
+
+const (
+	// sessionCookieName carries the ID of an authenticated session.
+	sessionCookieName = "session"
+	// ceremonyCookieName carries the ID of a WebAuthn ceremony in progress.
+	ceremonyCookieName = "ceremony"
+	// qrLoginCookieName carries the ID of a cross-device sign-in request on the new browser.
+	qrLoginCookieName = "qr_login"
+)
+
+func setSessionCookie(w http.ResponseWriter, session *model.Session) {
+	setCookie(w, sessionCookieName, session.ID, session.ExpiresAt)
+}
+
+func setCeremonyCookie(w http.ResponseWriter, ceremony *model.Ceremony) {
+	setCookie(w, ceremonyCookieName, ceremony.ID, ceremony.ExpiresAt)
+}
+
+func setQRLoginCookie(w http.ResponseWriter, login *model.QRLogin) {
+	setCookie(w, qrLoginCookieName, login.ID, login.ExpiresAt)
+}
+
+func clearCookie(w http.ResponseWriter, name string) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     name,
+		Value:    "",
+		Path:     "/",
+		HttpOnly: true,
+		SameSite: http.SameSiteNoneMode,
+		Secure:   true,
+		MaxAge:   -1,
+	})
+}
+
+func setCookie(w http.ResponseWriter, name string, value string, expires time.Time) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     "/",
+		HttpOnly: true,
+		SameSite: http.SameSiteNoneMode, // Required for cross-origin requests
+		Secure:   true,                  // Set to true in production with HTTPS
+		Expires:  expires,
+	})
+}
+
+// sessionCookie returns the value of the session cookie.
+func sessionCookie(r *http.Request) (string, bool) {
+	return cookieValue(r, sessionCookieName)
+}
+
+// ceremonyCookie returns the value of the ceremony cookie.
+func ceremonyCookie(r *http.Request) (string, bool) {
+	return cookieValue(r, ceremonyCookieName)
+}
+
+// qrLoginCookie returns the value of the qr_login cookie.
+func qrLoginCookie(r *http.Request) (string, bool) {
+	return cookieValue(r, qrLoginCookieName)
+}
+
+func cookieValue(r *http.Request, name string) (string, bool) {
+	cookie, err := r.Cookie(name)
+	if err != nil || cookie.Value == "" {
+		return "", false
+	}
+	return cookie.Value, true
+}
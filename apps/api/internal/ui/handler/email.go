@@ -0,0 +1,155 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/kobayashiyabako16g/passkey-auth-example/internal/contexts"
+	"github.com/kobayashiyabako16g/passkey-auth-example/internal/ui/handler/request"
+	"github.com/kobayashiyabako16g/passkey-auth-example/internal/usecase"
+	dtos "github.com/kobayashiyabako16g/passkey-auth-example/internal/usecase/dto/email"
+	"github.com/kobayashiyabako16g/passkey-auth-example/pkg/logger"
+)
+
+type Email interface {
+	BeginChange(w http.ResponseWriter, r *http.Request)
+	FinishChange(w http.ResponseWriter, r *http.Request)
+	Verify(w http.ResponseWriter, r *http.Request)
+}
+
+type email struct {
+	usecase usecase.Email
+}
+
+func NewEmail(usecase usecase.Email) Email {
+	return &email{usecase}
+}
+
+// BeginChange starts the passkey assertion that confirms a new email address.
+func (h *email) BeginChange(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	logger.Info(ctx, "begin change email ----------------------")
+
+	// 認証済みのユーザー (RequireAuth で設定)
+	user := contexts.GetUser(ctx)
+	if user == nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req request.ChangeEmail
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		logger.Info(ctx, "can't decode email", logger.WithError(err))
+		http.Error(w, "Bad Requset", http.StatusBadRequest)
+		return
+	}
+
+	result, err := h.usecase.BeginChange(ctx, dtos.BeginChangeRequest{User: user, Email: req.Email})
+	if err != nil {
+		switch err {
+		case dtos.ErrInvalidEmail:
+			http.Error(w, "Bad Requset", http.StatusBadRequest)
+		case dtos.ErrEmailExists:
+			http.Error(w, "Email already exists", http.StatusConflict)
+		default:
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	setCeremonyCookie(w, result.Ceremony)
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(result.Cred); err != nil {
+		logger.Error(ctx, "Failed to write response", logger.WithError(err))
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+}
+
+// FinishChange verifies the assertion and mails a verification link to the new address.
+func (h *email) FinishChange(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	logger.Info(ctx, "finish change email ----------------------")
+
+	// 認証済みのユーザー (RequireAuth で設定)
+	user := contexts.GetUser(ctx)
+	if user == nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	ceremonyID, ok := ceremonyCookie(r)
+	if !ok {
+		logger.Info(ctx, "ceremony cookie is not found")
+		http.Error(w, "Bad Requset", http.StatusBadRequest)
+		return
+	}
+
+	result, err := h.usecase.FinishChange(ctx, dtos.FinishChangeRequest{
+		User:      user,
+		Ceremony:  ceremonyID,
+		IP:        clientIP(r),
+		UserAgent: r.UserAgent(),
+		Request:   r,
+	})
+	clearCookie(w, ceremonyCookieName)
+	if err != nil {
+		switch err {
+		case dtos.ErrSessionNotFound, dtos.ErrAssertionFailed:
+			http.Error(w, "Bad Requset", http.StatusBadRequest)
+		case dtos.ErrCloneDetected:
+			http.Error(w, "Forbidden", http.StatusForbidden)
+		default:
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]string{
+		"status": "verification_sent",
+		"email":  result.Email,
+	})
+}
+
+// Verify sets the address of a verification link as the user's email.
+func (h *email) Verify(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	logger.Info(ctx, "verify email ----------------------")
+
+	var req request.VerifyEmail
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		logger.Info(ctx, "can't decode verification", logger.WithError(err))
+		http.Error(w, "Bad Requset", http.StatusBadRequest)
+		return
+	}
+	if req.Token == "" {
+		http.Error(w, "Bad Requset", http.StatusBadRequest)
+		return
+	}
+
+	result, err := h.usecase.Verify(ctx, dtos.VerifyRequest{
+		Token:     req.Token,
+		IP:        clientIP(r),
+		UserAgent: r.UserAgent(),
+	})
+	if err != nil {
+		switch err {
+		case dtos.ErrInvalidToken:
+			http.Error(w, "Bad Requset", http.StatusBadRequest)
+		case dtos.ErrEmailExists:
+			http.Error(w, "Email already exists", http.StatusConflict)
+		default:
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"status": "success",
+		"email":  result.Email,
+	})
+}
@@ -0,0 +1,111 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/kobayashiyabako16g/passkey-auth-example/internal/ui/handler/request"
+	"github.com/kobayashiyabako16g/passkey-auth-example/internal/usecase"
+	dtos "github.com/kobayashiyabako16g/passkey-auth-example/internal/usecase/dto/magiclink"
+	"github.com/kobayashiyabako16g/passkey-auth-example/pkg/logger"
+)
+
+type MagicLink interface {
+	Send(w http.ResponseWriter, r *http.Request)
+	Login(w http.ResponseWriter, r *http.Request)
+}
+
+type magicLink struct {
+	usecase usecase.MagicLink
+}
+
+func NewMagicLink(usecase usecase.MagicLink) MagicLink {
+	return &magicLink{usecase}
+}
+
+// Send answers 202 whether or not the address belongs to a user.
+func (h *magicLink) Send(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	logger.Info(ctx, "send magic link ----------------------")
+
+	var req request.SendMagicLink
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		logger.Info(ctx, "can't decode magic link request", logger.WithError(err))
+		http.Error(w, "Bad Requset", http.StatusBadRequest)
+		return
+	}
+
+	err := h.usecase.Send(ctx, dtos.SendRequest{
+		Email:     req.Email,
+		IP:        clientIP(r),
+		UserAgent: r.UserAgent(),
+	})
+	if err != nil {
+		switch err {
+		case dtos.ErrDisabled:
+			http.Error(w, "Not Found", http.StatusNotFound)
+		case dtos.ErrInvalidEmail:
+			http.Error(w, "Bad Requset", http.StatusBadRequest)
+		case dtos.ErrRateLimited:
+			http.Error(w, "Too Many Requests", http.StatusTooManyRequests)
+		default:
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]string{"status": "sent"})
+}
+
+// Login signs in with the token of a magic link. The response asks the client
+// to upgrade with POST /passkey/credentials/start?mediation=conditional.
+func (h *magicLink) Login(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	logger.Info(ctx, "magic link login ----------------------")
+
+	var req request.MagicLinkLogin
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		logger.Info(ctx, "can't decode magic link login", logger.WithError(err))
+		http.Error(w, "Bad Requset", http.StatusBadRequest)
+		return
+	}
+	if req.Token == "" {
+		http.Error(w, "Bad Requset", http.StatusBadRequest)
+		return
+	}
+	sessionID, _ := sessionCookie(r)
+
+	result, err := h.usecase.Login(ctx, dtos.LoginRequest{
+		Token:     req.Token,
+		Session:   sessionID,
+		IP:        clientIP(r),
+		UserAgent: r.UserAgent(),
+	})
+	if err != nil {
+		switch err {
+		case dtos.ErrDisabled:
+			http.Error(w, "Not Found", http.StatusNotFound)
+		case dtos.ErrInvalidToken:
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		default:
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	setSessionCookie(w, result.Session)
+
+	w.Header().Set("Content-Type", "application/json")
+	if result.Session.SecondFactorRequired {
+		// アップグレードは /auth/totp/verify の後で行う
+		json.NewEncoder(w).Encode(map[string]string{"status": "second_factor_required"})
+		return
+	}
+	// パスキーに対応していない端末では登録をスキップしてそのまま使える
+	json.NewEncoder(w).Encode(map[string]string{
+		"status":  "success",
+		"upgrade": "conditional",
+	})
+}
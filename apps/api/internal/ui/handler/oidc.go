@@ -0,0 +1,366 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/kobayashiyabako16g/passkey-auth-example/internal/contexts"
+	"github.com/kobayashiyabako16g/passkey-auth-example/internal/ui/handler/request"
+	"github.com/kobayashiyabako16g/passkey-auth-example/internal/ui/handler/response"
+	"github.com/kobayashiyabako16g/passkey-auth-example/internal/usecase"
+	dtos "github.com/kobayashiyabako16g/passkey-auth-example/internal/usecase/dto/oidc"
+	"github.com/kobayashiyabako16g/passkey-auth-example/pkg/logger"
+)
+
+type OIDC interface {
+	Discovery(w http.ResponseWriter, r *http.Request)
+	Authorize(w http.ResponseWriter, r *http.Request)
+	CompleteAuthorization(w http.ResponseWriter, r *http.Request)
+	Token(w http.ResponseWriter, r *http.Request)
+	UserInfo(w http.ResponseWriter, r *http.Request)
+	Introspect(w http.ResponseWriter, r *http.Request)
+	Revoke(w http.ResponseWriter, r *http.Request)
+	DeviceAuthorization(w http.ResponseWriter, r *http.Request)
+	DeviceInfo(w http.ResponseWriter, r *http.Request)
+	ApproveDevice(w http.ResponseWriter, r *http.Request)
+}
+
+type oidc struct {
+	usecase usecase.OIDC
+}
+
+func NewOIDC(usecase usecase.OIDC) OIDC {
+	return &oidc{usecase}
+}
+
+func (h *oidc) Discovery(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response.NewDiscovery(h.usecase.Discovery(ctx))); err != nil {
+		logger.Error(ctx, "Failed to write response", logger.WithError(err))
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+}
+
+func (h *oidc) Authorize(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	logger.Info(ctx, "authorize ----------------------")
+
+	q := r.URL.Query()
+	sessionID, _ := sessionCookie(r)
+	result, err := h.usecase.Authorize(ctx, dtos.AuthorizeRequest{
+		Session:             sessionID,
+		ClientID:            q.Get("client_id"),
+		RedirectURI:         q.Get("redirect_uri"),
+		ResponseType:        q.Get("response_type"),
+		Scope:               q.Get("scope"),
+		State:               q.Get("state"),
+		Nonce:               q.Get("nonce"),
+		CodeChallenge:       q.Get("code_challenge"),
+		CodeChallengeMethod: q.Get("code_challenge_method"),
+		Prompt:              q.Get("prompt"),
+		MaxAge:              q.Get("max_age"),
+	})
+	if err != nil {
+		switch err {
+		case dtos.ErrInvalidClient:
+			// リダイレクト先が信頼できないのでエラーをそのまま表示する
+			http.Error(w, "Unknown client or redirect_uri", http.StatusBadRequest)
+		default:
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	http.Redirect(w, r, result.RedirectTo, http.StatusFound)
+}
+
+func (h *oidc) CompleteAuthorization(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	logger.Info(ctx, "complete authorization ----------------------")
+
+	// 認証済みのユーザーとセッション (RequireAuth で設定)
+	user := contexts.GetUser(ctx)
+	current := contexts.GetSession(ctx)
+	if user == nil || current == nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req request.CompleteAuthorization
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		logger.Info(ctx, "can't decode authorization request", logger.WithError(err))
+		http.Error(w, "Bad Requset", http.StatusBadRequest)
+		return
+	}
+
+	result, err := h.usecase.CompleteAuthorization(ctx, dtos.CompleteAuthorizationRequest{
+		User:    user,
+		Session: current,
+		Request: req.Request,
+	})
+	if err != nil {
+		switch err {
+		case dtos.ErrRequestNotFound:
+			http.Error(w, "Not Found", http.StatusNotFound)
+		case dtos.ErrLoginRequired:
+			// クライアントはパスキーで再度ログインする
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusUnauthorized)
+			json.NewEncoder(w).Encode(map[string]string{"error": "login_required"})
+		default:
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"redirectTo": result.RedirectTo})
+}
+
+func (h *oidc) Token(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	logger.Info(ctx, "token ----------------------")
+
+	if err := r.ParseForm(); err != nil {
+		writeOAuthError(w, dtos.ErrInvalidRequest, false)
+		return
+	}
+
+	clientID, clientSecret, basic := clientCredentials(r)
+	result, err := h.usecase.Token(ctx, dtos.TokenRequest{
+		GrantType:    r.PostForm.Get("grant_type"),
+		Code:         r.PostForm.Get("code"),
+		DeviceCode:   r.PostForm.Get("device_code"),
+		RedirectURI:  r.PostForm.Get("redirect_uri"),
+		CodeVerifier: r.PostForm.Get("code_verifier"),
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+	})
+	if err != nil {
+		writeOAuthError(w, err, basic)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if err := json.NewEncoder(w).Encode(response.NewOIDCToken(result)); err != nil {
+		logger.Error(ctx, "Failed to write response", logger.WithError(err))
+		return
+	}
+}
+
+func (h *oidc) UserInfo(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	accessToken, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || accessToken == "" {
+		w.Header().Set("WWW-Authenticate", `Bearer`)
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	result, err := h.usecase.UserInfo(ctx, dtos.UserInfoRequest{AccessToken: accessToken})
+	if err != nil {
+		switch err {
+		case dtos.ErrInvalidToken:
+			w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		case dtos.ErrInsufficientScope:
+			w.Header().Set("WWW-Authenticate", `Bearer error="insufficient_scope", scope="openid"`)
+			http.Error(w, "Forbidden", http.StatusForbidden)
+		default:
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response.NewUserInfo(result.User, result.Scope)); err != nil {
+		logger.Error(ctx, "Failed to write response", logger.WithError(err))
+		return
+	}
+}
+
+func (h *oidc) Introspect(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	if err := r.ParseForm(); err != nil {
+		writeOAuthError(w, dtos.ErrInvalidRequest, false)
+		return
+	}
+	clientID, clientSecret, basic := clientCredentials(r)
+
+	result, err := h.usecase.Introspect(ctx, dtos.IntrospectRequest{
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		Token:        r.PostForm.Get("token"),
+	})
+	if err != nil {
+		writeOAuthError(w, err, basic)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if err := json.NewEncoder(w).Encode(response.NewIntrospection(result.Session)); err != nil {
+		logger.Error(ctx, "Failed to write response", logger.WithError(err))
+		return
+	}
+}
+
+func (h *oidc) Revoke(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	if err := r.ParseForm(); err != nil {
+		writeOAuthError(w, dtos.ErrInvalidRequest, false)
+		return
+	}
+	clientID, clientSecret, basic := clientCredentials(r)
+
+	err := h.usecase.Revoke(ctx, dtos.RevokeRequest{
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		Token:        r.PostForm.Get("token"),
+	})
+	if err != nil {
+		writeOAuthError(w, err, basic)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func (h *oidc) DeviceAuthorization(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	logger.Info(ctx, "device authorization ----------------------")
+
+	if err := r.ParseForm(); err != nil {
+		writeOAuthError(w, dtos.ErrInvalidRequest, false)
+		return
+	}
+	clientID, clientSecret, basic := clientCredentials(r)
+
+	result, err := h.usecase.DeviceAuthorization(ctx, dtos.DeviceAuthorizationRequest{
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		Scope:        r.PostForm.Get("scope"),
+	})
+	if err != nil {
+		writeOAuthError(w, err, basic)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if err := json.NewEncoder(w).Encode(response.NewDeviceAuthorization(result)); err != nil {
+		logger.Error(ctx, "Failed to write response", logger.WithError(err))
+		return
+	}
+}
+
+func (h *oidc) DeviceInfo(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	result, err := h.usecase.DeviceInfo(ctx, dtos.DeviceInfoRequest{UserCode: r.URL.Query().Get("user_code")})
+	if err != nil {
+		switch err {
+		case dtos.ErrDeviceNotFound:
+			http.Error(w, "Not Found", http.StatusNotFound)
+		default:
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response.NewDeviceInfo(result)); err != nil {
+		logger.Error(ctx, "Failed to write response", logger.WithError(err))
+		return
+	}
+}
+
+func (h *oidc) ApproveDevice(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	logger.Info(ctx, "approve device ----------------------")
+
+	// 認証済みのユーザーとセッション (RequireAuth で設定)
+	user := contexts.GetUser(ctx)
+	current := contexts.GetSession(ctx)
+	if user == nil || current == nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req request.ApproveDevice
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		logger.Info(ctx, "can't decode approve device request", logger.WithError(err))
+		http.Error(w, "Bad Requset", http.StatusBadRequest)
+		return
+	}
+
+	err := h.usecase.ApproveDevice(ctx, dtos.ApproveDeviceRequest{
+		User:     user,
+		Session:  current,
+		UserCode: req.UserCode,
+		Approve:  req.Approve,
+	})
+	if err != nil {
+		switch err {
+		case dtos.ErrDeviceNotFound:
+			http.Error(w, "Not Found", http.StatusNotFound)
+		case dtos.ErrLoginRequired:
+			// クライアントはパスキーで再度ログインする
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusUnauthorized)
+			json.NewEncoder(w).Encode(map[string]string{"error": "login_required"})
+		default:
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// clientCredentials reads client_secret_basic or client_secret_post credentials.
+// Requests from public clients only carry client_id.
+func clientCredentials(r *http.Request) (clientID string, clientSecret string, basic bool) {
+	clientID, clientSecret, basic = r.BasicAuth()
+	if basic {
+		// RFC 6749 2.3.1: Basic 認証の前にフォームエンコードされている
+		clientID, _ = url.QueryUnescape(clientID)
+		clientSecret, _ = url.QueryUnescape(clientSecret)
+		return clientID, clientSecret, true
+	}
+	return r.PostForm.Get("client_id"), r.PostForm.Get("client_secret"), false
+}
+
+// writeOAuthError writes an OAuth 2.0 error response (RFC 6749 5.2).
+func writeOAuthError(w http.ResponseWriter, err error, basic bool) {
+	var oauthErr *dtos.Error
+	if !errors.As(err, &oauthErr) {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	status := http.StatusBadRequest
+	if oauthErr == dtos.ErrInvalidClient {
+		status = http.StatusUnauthorized
+		if basic {
+			w.Header().Set("WWW-Authenticate", `Basic realm="oauth"`)
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(response.OAuthError{
+		Error:            oauthErr.Code,
+		ErrorDescription: oauthErr.Description,
+	})
+}
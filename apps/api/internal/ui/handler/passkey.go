@@ -0,0 +1,213 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/kobayashiyabako16g/passkey-auth-example/internal/contexts"
+	"github.com/kobayashiyabako16g/passkey-auth-example/internal/ui/handler/request"
+	"github.com/kobayashiyabako16g/passkey-auth-example/internal/ui/handler/response"
+	"github.com/kobayashiyabako16g/passkey-auth-example/internal/usecase"
+	dtos "github.com/kobayashiyabako16g/passkey-auth-example/internal/usecase/dto/passkey"
+	"github.com/kobayashiyabako16g/passkey-auth-example/pkg/logger"
+)
+
+type Passkey interface {
+	BeginAddCredential(w http.ResponseWriter, r *http.Request)
+	FinishAddCredential(w http.ResponseWriter, r *http.Request)
+	ListCredentials(w http.ResponseWriter, r *http.Request)
+	RenameCredential(w http.ResponseWriter, r *http.Request)
+	DeleteCredential(w http.ResponseWriter, r *http.Request)
+}
+
+type passkey struct {
+	usecase usecase.Passkey
+}
+
+func NewPasskey(usecase usecase.Passkey) Passkey {
+	return &passkey{usecase}
+}
+
+func (h *passkey) BeginAddCredential(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	logger.Info(ctx, "begin add credential ----------------------")
+
+	// 認証済みのユーザー (RequireEnrollment で設定)
+	user := contexts.GetUser(ctx)
+	if user == nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	result, err := h.usecase.BeginAddCredential(ctx, dtos.BeginAddCredentialRequest{
+		User: user,
+		// ?mediation=conditional でパスワードログイン後のアップグレードを開始する
+		Conditional: r.URL.Query().Get("mediation") == "conditional",
+	})
+	if err != nil {
+		logger.Error(ctx, "Failed to begin add credential", logger.WithError(err))
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	setCeremonyCookie(w, result.Ceremony)
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(result.Cred); err != nil {
+		logger.Error(ctx, "Failed to write response", logger.WithError(err))
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+}
+
+func (h *passkey) FinishAddCredential(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	logger.Info(ctx, "finish add credential ----------------------")
+
+	// 認証済みのユーザーとセッション (RequireEnrollment で設定)
+	user := contexts.GetUser(ctx)
+	current := contexts.GetSession(ctx)
+	if user == nil || current == nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	ceremonyID, _ := ceremonyCookie(r)
+
+	result, err := h.usecase.FinishAddCredential(ctx, dtos.FinishAddCredentialRequest{
+		User:      user,
+		Session:   current,
+		Ceremony:  ceremonyID,
+		IP:        clientIP(r),
+		UserAgent: r.UserAgent(),
+		Request:   r,
+	})
+	clearCookie(w, ceremonyCookieName)
+	if err != nil {
+		switch err {
+		case dtos.ErrSessionNotFound, dtos.ErrFinishRegistration:
+			http.Error(w, "Bad Requset", http.StatusBadRequest)
+		default:
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	if result.Session != nil {
+		setSessionCookie(w, result.Session)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if result.SecondFactorRequired {
+		// クライアントは /auth/totp/verify で TOTP のコードを送る
+		json.NewEncoder(w).Encode(map[string]string{"status": "second_factor_required"})
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]string{"status": "success"})
+}
+
+func (h *passkey) ListCredentials(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	// 認証済みのユーザー (RequireAuth で設定)
+	user := contexts.GetUser(ctx)
+	if user == nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	result, err := h.usecase.ListCredentials(ctx, dtos.ListCredentialsRequest{
+		User: user,
+	})
+	if err != nil {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response.NewCredentials(result.Credentials)); err != nil {
+		logger.Error(ctx, "Failed to write response", logger.WithError(err))
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+}
+
+func (h *passkey) RenameCredential(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	// 認証済みのユーザー (RequireAuth で設定)
+	user := contexts.GetUser(ctx)
+	if user == nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	id := r.PathValue("id")
+	if _, err := uuid.Parse(id); err != nil {
+		http.Error(w, "Not Found", http.StatusNotFound)
+		return
+	}
+
+	var req request.RenameCredential
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		logger.Info(ctx, "can't decode credential data", logger.WithError(err))
+		http.Error(w, "Bad Requset", http.StatusBadRequest)
+		return
+	}
+
+	err := h.usecase.RenameCredential(ctx, dtos.RenameCredentialRequest{
+		User: user,
+		ID:   id,
+		Name: req.Name,
+	})
+	if err != nil {
+		switch err {
+		case dtos.ErrInvalidName:
+			http.Error(w, "Bad Requset", http.StatusBadRequest)
+		case dtos.ErrCredentialNotFound:
+			http.Error(w, "Not Found", http.StatusNotFound)
+		default:
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "success"})
+}
+
+func (h *passkey) DeleteCredential(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	// 認証済みのユーザー (RequireAuth で設定)
+	user := contexts.GetUser(ctx)
+	if user == nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	id := r.PathValue("id")
+	if _, err := uuid.Parse(id); err != nil {
+		http.Error(w, "Not Found", http.StatusNotFound)
+		return
+	}
+
+	err := h.usecase.DeleteCredential(ctx, dtos.DeleteCredentialRequest{
+		User: user,
+		ID:   id,
+	})
+	if err != nil {
+		switch err {
+		case dtos.ErrCredentialNotFound:
+			http.Error(w, "Not Found", http.StatusNotFound)
+		case dtos.ErrLastCredential:
+			http.Error(w, "Can't delete the last passkey", http.StatusConflict)
+		default:
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "success"})
+}
@@ -0,0 +1,79 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/kobayashiyabako16g/passkey-auth-example/internal/ui/handler/request"
+	"github.com/kobayashiyabako16g/passkey-auth-example/internal/usecase"
+	dtos "github.com/kobayashiyabako16g/passkey-auth-example/internal/usecase/dto/password"
+	"github.com/kobayashiyabako16g/passkey-auth-example/pkg/logger"
+)
+
+type Password interface {
+	Login(w http.ResponseWriter, r *http.Request)
+}
+
+type password struct {
+	usecase usecase.Password
+}
+
+func NewPassword(usecase usecase.Password) Password {
+	return &password{usecase}
+}
+
+// Login signs in an account migrated with a password. The response asks the client
+// to upgrade with POST /passkey/credentials/start?mediation=conditional.
+func (h *password) Login(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	logger.Info(ctx, "password login ----------------------")
+
+	var req request.PasswordLogin
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		logger.Info(ctx, "can't decode password login", logger.WithError(err))
+		http.Error(w, "Bad Requset", http.StatusBadRequest)
+		return
+	}
+	if req.Username == "" || req.Password == "" {
+		http.Error(w, "Bad Requset", http.StatusBadRequest)
+		return
+	}
+	sessionID, _ := sessionCookie(r)
+
+	result, err := h.usecase.Login(ctx, dtos.LoginRequest{
+		Username:  req.Username,
+		Password:  req.Password,
+		Session:   sessionID,
+		IP:        clientIP(r),
+		UserAgent: r.UserAgent(),
+	})
+	if err != nil {
+		switch err {
+		case dtos.ErrInvalidCredentials:
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		case dtos.ErrTooManyAttempts:
+			http.Error(w, "Too Many Requests", http.StatusTooManyRequests)
+		case dtos.ErrPasswordRetired:
+			// クライアントはパスキーでログインする
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusUnauthorized)
+			json.NewEncoder(w).Encode(map[string]string{"error": "passkey_required"})
+		default:
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	setSessionCookie(w, result.Session)
+
+	w.Header().Set("Content-Type", "application/json")
+	if result.Session.SecondFactorRequired {
+		// アップグレードは /auth/totp/verify の後で行う
+		json.NewEncoder(w).Encode(map[string]string{"status": "second_factor_required"})
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]string{
+		"status":  "success",
+		"upgrade": "conditional",
+	})
+}
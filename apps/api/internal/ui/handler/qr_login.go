@@ -0,0 +1,192 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/kobayashiyabako16g/passkey-auth-example/internal/contexts"
+	"github.com/kobayashiyabako16g/passkey-auth-example/internal/ui/handler/response"
+	"github.com/kobayashiyabako16g/passkey-auth-example/internal/usecase"
+	dtos "github.com/kobayashiyabako16g/passkey-auth-example/internal/usecase/dto/qrlogin"
+	"github.com/kobayashiyabako16g/passkey-auth-example/pkg/logger"
+)
+
+type QRLogin interface {
+	Start(w http.ResponseWriter, r *http.Request)
+	Wait(w http.ResponseWriter, r *http.Request)
+	Info(w http.ResponseWriter, r *http.Request)
+	BeginApprove(w http.ResponseWriter, r *http.Request)
+	FinishApprove(w http.ResponseWriter, r *http.Request)
+}
+
+type qrLogin struct {
+	usecase usecase.QRLogin
+}
+
+func NewQRLogin(usecase usecase.QRLogin) QRLogin {
+	return &qrLogin{usecase}
+}
+
+// Start is called by the new browser, which shows the code as a QR code.
+func (h *qrLogin) Start(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	logger.Info(ctx, "start qr login ----------------------")
+
+	result, err := h.usecase.Start(ctx, dtos.StartRequest{
+		IP:        clientIP(r),
+		UserAgent: r.UserAgent(),
+	})
+	if err != nil {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	setQRLoginCookie(w, result.Login)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if err := json.NewEncoder(w).Encode(response.QRLoginStart{
+		Code:       result.Code,
+		ApproveURL: result.ApproveURL,
+		ExpiresIn:  result.ExpiresIn,
+	}); err != nil {
+		logger.Error(ctx, "Failed to write response", logger.WithError(err))
+		return
+	}
+}
+
+// Wait long-polls for the approval. The new browser calls it again while the status is pending.
+func (h *qrLogin) Wait(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	id, ok := qrLoginCookie(r)
+	if !ok {
+		logger.Info(ctx, "qr login cookie is not found")
+		http.Error(w, "Bad Requset", http.StatusBadRequest)
+		return
+	}
+	sessionID, _ := sessionCookie(r)
+
+	result, err := h.usecase.Wait(ctx, dtos.WaitRequest{ID: id, Session: sessionID})
+	if err != nil {
+		switch err {
+		case dtos.ErrLoginNotFound:
+			// 期限切れ。ブラウザは最初からやり直す
+			clearCookie(w, qrLoginCookieName)
+			http.Error(w, "Not Found", http.StatusNotFound)
+		default:
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if result.Session == nil {
+		json.NewEncoder(w).Encode(map[string]string{"status": "pending"})
+		return
+	}
+	clearCookie(w, qrLoginCookieName)
+	setSessionCookie(w, result.Session)
+	json.NewEncoder(w).Encode(map[string]string{"status": "approved"})
+}
+
+func (h *qrLogin) Info(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	result, err := h.usecase.Info(ctx, dtos.InfoRequest{Code: r.PathValue("code")})
+	if err != nil {
+		switch err {
+		case dtos.ErrLoginNotFound:
+			http.Error(w, "Not Found", http.StatusNotFound)
+		default:
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response.NewQRLogin(result.Login, result.Code)); err != nil {
+		logger.Error(ctx, "Failed to write response", logger.WithError(err))
+		return
+	}
+}
+
+func (h *qrLogin) BeginApprove(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	logger.Info(ctx, "begin approve qr login ----------------------")
+
+	// 認証済みのユーザー (RequireAuth で設定)
+	user := contexts.GetUser(ctx)
+	if user == nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	result, err := h.usecase.BeginApprove(ctx, dtos.BeginApproveRequest{
+		User: user,
+		Code: r.PathValue("code"),
+	})
+	if err != nil {
+		switch err {
+		case dtos.ErrLoginNotFound:
+			http.Error(w, "Not Found", http.StatusNotFound)
+		default:
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	setCeremonyCookie(w, result.Ceremony)
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(result.Cred); err != nil {
+		logger.Error(ctx, "Failed to write response", logger.WithError(err))
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+}
+
+func (h *qrLogin) FinishApprove(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	logger.Info(ctx, "finish approve qr login ----------------------")
+
+	// 認証済みのユーザー (RequireAuth で設定)
+	user := contexts.GetUser(ctx)
+	if user == nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	ceremonyID, ok := ceremonyCookie(r)
+	if !ok {
+		logger.Info(ctx, "ceremony cookie is not found")
+		http.Error(w, "Bad Requset", http.StatusBadRequest)
+		return
+	}
+
+	err := h.usecase.FinishApprove(ctx, dtos.FinishApproveRequest{
+		User:     user,
+		Code:     r.PathValue("code"),
+		Ceremony: ceremonyID,
+		Request:  r,
+	})
+	if err != nil {
+		switch err {
+		case dtos.ErrSessionNotFound, dtos.ErrAssertionFailed:
+			http.Error(w, "Bad Requset", http.StatusBadRequest)
+		case dtos.ErrLoginNotFound:
+			http.Error(w, "Not Found", http.StatusNotFound)
+		case dtos.ErrCloneDetected:
+			clearCookie(w, ceremonyCookieName)
+			http.Error(w, "Forbidden", http.StatusForbidden)
+		default:
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	clearCookie(w, ceremonyCookieName)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "success"})
+}
@@ -0,0 +1,115 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/kobayashiyabako16g/passkey-auth-example/internal/contexts"
+	"github.com/kobayashiyabako16g/passkey-auth-example/internal/ui/handler/request"
+	"github.com/kobayashiyabako16g/passkey-auth-example/internal/usecase"
+	dtos "github.com/kobayashiyabako16g/passkey-auth-example/internal/usecase/dto/recovery"
+	"github.com/kobayashiyabako16g/passkey-auth-example/pkg/logger"
+)
+
+type Recovery interface {
+	GenerateCodes(w http.ResponseWriter, r *http.Request)
+	Status(w http.ResponseWriter, r *http.Request)
+	Login(w http.ResponseWriter, r *http.Request)
+}
+
+type recovery struct {
+	usecase usecase.Recovery
+}
+
+func NewRecovery(usecase usecase.Recovery) Recovery {
+	return &recovery{usecase}
+}
+
+// GenerateCodes replaces the recovery codes of the user with a new set.
+func (h *recovery) GenerateCodes(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	logger.Info(ctx, "generate recovery codes ----------------------")
+
+	// 認証済みのユーザー (RequireAuth で設定)
+	user := contexts.GetUser(ctx)
+	if user == nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	result, err := h.usecase.Generate(ctx, dtos.GenerateRequest{
+		User:      user,
+		IP:        clientIP(r),
+		UserAgent: r.UserAgent(),
+	})
+	if err != nil {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(map[string][]string{"recoveryCodes": result.Codes})
+}
+
+func (h *recovery) Status(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	// 認証済みのユーザー (RequireAuth で設定)
+	user := contexts.GetUser(ctx)
+	if user == nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	result, err := h.usecase.Status(ctx, dtos.StatusRequest{User: user})
+	if err != nil {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]int{"remaining": result.Remaining})
+}
+
+// Login signs in with a recovery code. The session only allows registering a new passkey.
+func (h *recovery) Login(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	logger.Info(ctx, "recovery login ----------------------")
+
+	var req request.RecoveryLogin
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		logger.Info(ctx, "can't decode recovery login", logger.WithError(err))
+		http.Error(w, "Bad Requset", http.StatusBadRequest)
+		return
+	}
+	if req.Username == "" || req.Code == "" {
+		http.Error(w, "Bad Requset", http.StatusBadRequest)
+		return
+	}
+	sessionID, _ := sessionCookie(r)
+
+	result, err := h.usecase.Login(ctx, dtos.LoginRequest{
+		Username:  req.Username,
+		Code:      req.Code,
+		Session:   sessionID,
+		IP:        clientIP(r),
+		UserAgent: r.UserAgent(),
+	})
+	if err != nil {
+		switch err {
+		case dtos.ErrInvalidCode:
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		case dtos.ErrTooManyAttempts:
+			http.Error(w, "Too Many Requests", http.StatusTooManyRequests)
+		default:
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	setSessionCookie(w, result.Session)
+	// クライアントは続けて /passkey/credentials/start で新しいパスキーを登録する
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "enrollment_required"})
+}
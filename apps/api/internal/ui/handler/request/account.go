@@ -0,0 +1,5 @@
+package request
+
+type ChangeUsername struct {
+	Username string `json:"username"`
+}
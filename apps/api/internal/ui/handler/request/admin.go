@@ -0,0 +1,14 @@
+package request
+
+type RegisterClient struct {
+	Name           string   `json:"name"`
+	RedirectURIs   []string `json:"redirectUris"`
+	Public         bool     `json:"public"`
+	ResourceServer bool     `json:"resourceServer"`
+}
+
+type CreateUser struct {
+	Username    string `json:"username"`
+	DisplayName string `json:"displayName"`
+	Email       string `json:"email"`
+}
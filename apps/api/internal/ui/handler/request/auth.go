@@ -2,6 +2,9 @@ package request
 
 type User struct {
 	Username string `json:"username"`
+	Email    string `json:"email"`
+	// EnrollmentToken is the token of a link issued by an administrator. It replaces Username.
+	EnrollmentToken string `json:"enrollmentToken"`
 }
 
 type FinishUserRegister struct {
@@ -0,0 +1,9 @@
+package request
+
+type ChangeEmail struct {
+	Email string `json:"email"`
+}
+
+type VerifyEmail struct {
+	Token string `json:"token"`
+}
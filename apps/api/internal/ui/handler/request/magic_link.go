@@ -0,0 +1,9 @@
+package request
+
+type SendMagicLink struct {
+	Email string `json:"email"`
+}
+
+type MagicLinkLogin struct {
+	Token string `json:"token"`
+}
@@ -0,0 +1,10 @@
+package request
+
+type CompleteAuthorization struct {
+	Request string `json:"request"`
+}
+
+type ApproveDevice struct {
+	UserCode string `json:"userCode"`
+	Approve  bool   `json:"approve"`
+}
@@ -0,0 +1,5 @@
+package request
+
+type RenameCredential struct {
+	Name string `json:"name"`
+}
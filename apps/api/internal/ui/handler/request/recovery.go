@@ -0,0 +1,6 @@
+package request
+
+type RecoveryLogin struct {
+	Username string `json:"username"`
+	Code     string `json:"code"`
+}
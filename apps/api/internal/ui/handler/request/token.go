@@ -0,0 +1,5 @@
+package request
+
+type Refresh struct {
+	RefreshToken string `json:"refreshToken"`
+}
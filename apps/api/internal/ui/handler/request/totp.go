@@ -0,0 +1,15 @@
+package request
+
+type FinishTOTPEnroll struct {
+	Code   string `json:"code"`
+	Policy string `json:"policy"`
+}
+
+type VerifyTOTP struct {
+	Code string `json:"code"`
+}
+
+type TOTPLogin struct {
+	Username string `json:"username"`
+	Code     string `json:"code"`
+}
@@ -0,0 +1,52 @@
+package response
+
+import (
+	"time"
+
+	"github.com/kobayashiyabako16g/passkey-auth-example/internal/domain/model"
+)
+
+type Client struct {
+	ID             string    `json:"clientId"`
+	Secret         string    `json:"clientSecret,omitempty"`
+	Name           string    `json:"name"`
+	RedirectURIs   []string  `json:"redirectUris"`
+	Public         bool      `json:"public"`
+	ResourceServer bool      `json:"resourceServer"`
+	CreatedAt      time.Time `json:"createdAt"`
+}
+
+func NewClient(c *model.OAuthClient, secret string) Client {
+	return Client{
+		ID:             c.ID,
+		Secret:         secret,
+		Name:           c.Name,
+		RedirectURIs:   c.RedirectURIs,
+		Public:         c.Public(),
+		ResourceServer: c.ResourceServer,
+		CreatedAt:      c.CreatedAt,
+	}
+}
+
+type EnrollmentLink struct {
+	URL       string    `json:"enrollmentUrl"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+type ProvisionedUser struct {
+	ID          string `json:"id"`
+	Username    string `json:"username"`
+	DisplayName string `json:"displayName"`
+	Email       string `json:"email,omitempty"`
+	EnrollmentLink
+}
+
+func NewProvisionedUser(u *model.User, link string, expiresAt time.Time) ProvisionedUser {
+	return ProvisionedUser{
+		ID:             u.ID,
+		Username:       u.Name,
+		DisplayName:    u.DisplayName,
+		Email:          u.Email,
+		EnrollmentLink: EnrollmentLink{URL: link, ExpiresAt: expiresAt},
+	}
+}
@@ -0,0 +1,29 @@
+package response
+
+import (
+	"time"
+
+	"github.com/kobayashiyabako16g/passkey-auth-example/internal/domain/model"
+)
+
+type AuditEvent struct {
+	ID        string    `json:"id"`
+	Event     string    `json:"event"`
+	IP        string    `json:"ip"`
+	UserAgent string    `json:"userAgent"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+func NewAuditEvents(events []model.AuditEvent) []AuditEvent {
+	res := make([]AuditEvent, 0, len(events))
+	for _, e := range events {
+		res = append(res, AuditEvent{
+			ID:        e.ID,
+			Event:     string(e.Event),
+			IP:        e.IP,
+			UserAgent: e.UserAgent,
+			CreatedAt: e.CreatedAt,
+		})
+	}
+	return res
+}
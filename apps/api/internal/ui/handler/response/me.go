@@ -0,0 +1,47 @@
+package response
+
+import (
+	"time"
+
+	"github.com/kobayashiyabako16g/passkey-auth-example/internal/domain/model"
+)
+
+type Me struct {
+	User         User        `json:"user"`
+	Credential   *Credential `json:"credential"`
+	AuthTime     time.Time   `json:"authTime"`
+	UserVerified bool        `json:"userVerified"`
+	ExpiresAt    time.Time   `json:"expiresAt"`
+	// IdleExpiresAt moves forward on every authenticated request.
+	IdleExpiresAt time.Time `json:"idleExpiresAt"`
+}
+
+type User struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	DisplayName string `json:"displayName"`
+	Email       string `json:"email,omitempty"`
+	// EmailVerified is false until the link sent to Email is opened.
+	EmailVerified bool `json:"emailVerified"`
+}
+
+func NewMe(user *model.User, session *model.Session, credential *model.Credential) Me {
+	me := Me{
+		User: User{
+			ID:            user.ID,
+			Name:          user.Name,
+			DisplayName:   user.DisplayName,
+			Email:         user.Email,
+			EmailVerified: user.EmailVerified,
+		},
+		AuthTime:      session.AuthTime,
+		UserVerified:  session.UserVerified,
+		ExpiresAt:     session.ExpiresAt,
+		IdleExpiresAt: session.IdleExpiresAt,
+	}
+	if credential != nil {
+		c := NewCredential(*credential)
+		me.Credential = &c
+	}
+	return me
+}
@@ -0,0 +1,159 @@
+package response
+
+import (
+	"slices"
+
+	"github.com/kobayashiyabako16g/passkey-auth-example/internal/domain/model"
+	dtos "github.com/kobayashiyabako16g/passkey-auth-example/internal/usecase/dto/oidc"
+)
+
+// OpenID Connect responses use the member names of the specifications.
+
+type OIDCToken struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int64  `json:"expires_in"`
+	IDToken     string `json:"id_token"`
+	Scope       string `json:"scope"`
+}
+
+func NewOIDCToken(t *dtos.TokenResponse) OIDCToken {
+	return OIDCToken{
+		AccessToken: t.AccessToken,
+		TokenType:   "Bearer",
+		ExpiresIn:   t.ExpiresIn,
+		IDToken:     t.IDToken,
+		Scope:       t.Scope,
+	}
+}
+
+type OAuthError struct {
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description,omitempty"`
+}
+
+type UserInfo struct {
+	Subject           string `json:"sub"`
+	Name              string `json:"name,omitempty"`
+	PreferredUsername string `json:"preferred_username,omitempty"`
+}
+
+func NewUserInfo(user *model.User, scope []string) UserInfo {
+	info := UserInfo{Subject: user.ID}
+	if slices.Contains(scope, "profile") {
+		info.Name = user.DisplayName
+		info.PreferredUsername = user.Name
+	}
+	return info
+}
+
+// Introspection is the RFC 7662 response for a session ID.
+type Introspection struct {
+	Active    bool     `json:"active"`
+	TokenType string   `json:"token_type,omitempty"`
+	Subject   string   `json:"sub,omitempty"`
+	Username  string   `json:"username,omitempty"`
+	AuthTime  int64    `json:"auth_time,omitempty"`
+	IssuedAt  int64    `json:"iat,omitempty"`
+	ExpiresAt int64    `json:"exp,omitempty"`
+	AMR       []string `json:"amr,omitempty"`
+}
+
+func NewIntrospection(session *model.Session) Introspection {
+	if session == nil {
+		return Introspection{Active: false}
+	}
+	// セッションは絶対タイムアウトとアイドルタイムアウトの早い方で終わる
+	expiresAt := session.ExpiresAt
+	if session.IdleExpiresAt.Before(expiresAt) {
+		expiresAt = session.IdleExpiresAt
+	}
+	return Introspection{
+		Active:    true,
+		TokenType: "session",
+		Subject:   session.UserID,
+		Username:  session.Username,
+		AuthTime:  session.AuthTime.Unix(),
+		IssuedAt:  session.CreatedAt.Unix(),
+		ExpiresAt: expiresAt.Unix(),
+		AMR:       session.AMR,
+	}
+}
+
+type Discovery struct {
+	Issuer                            string   `json:"issuer"`
+	AuthorizationEndpoint             string   `json:"authorization_endpoint"`
+	TokenEndpoint                     string   `json:"token_endpoint"`
+	UserInfoEndpoint                  string   `json:"userinfo_endpoint"`
+	JWKSURI                           string   `json:"jwks_uri"`
+	IntrospectionEndpoint             string   `json:"introspection_endpoint"`
+	RevocationEndpoint                string   `json:"revocation_endpoint"`
+	DeviceAuthorizationEndpoint       string   `json:"device_authorization_endpoint"`
+	ResponseTypesSupported            []string `json:"response_types_supported"`
+	GrantTypesSupported               []string `json:"grant_types_supported"`
+	SubjectTypesSupported             []string `json:"subject_types_supported"`
+	IDTokenSigningAlgValuesSupported  []string `json:"id_token_signing_alg_values_supported"`
+	ScopesSupported                   []string `json:"scopes_supported"`
+	ClaimsSupported                   []string `json:"claims_supported"`
+	TokenEndpointAuthMethodsSupported []string `json:"token_endpoint_auth_methods_supported"`
+	CodeChallengeMethodsSupported     []string `json:"code_challenge_methods_supported"`
+	AuthorizationResponseIssParameter bool     `json:"authorization_response_iss_parameter_supported"`
+}
+
+func NewDiscovery(d *dtos.DiscoveryResponse) Discovery {
+	return Discovery{
+		Issuer:                            d.Issuer,
+		AuthorizationEndpoint:             d.AuthorizationEndpoint,
+		TokenEndpoint:                     d.TokenEndpoint,
+		UserInfoEndpoint:                  d.UserInfoEndpoint,
+		JWKSURI:                           d.JWKSURI,
+		IntrospectionEndpoint:             d.IntrospectionEndpoint,
+		RevocationEndpoint:                d.RevocationEndpoint,
+		DeviceAuthorizationEndpoint:       d.DeviceAuthorizationEndpoint,
+		ResponseTypesSupported:            []string{"code"},
+		GrantTypesSupported:               d.GrantTypesSupported,
+		SubjectTypesSupported:             []string{"public"},
+		IDTokenSigningAlgValuesSupported:  d.IDTokenSigningAlgValuesSupported,
+		ScopesSupported:                   d.ScopesSupported,
+		ClaimsSupported:                   []string{"sub", "iss", "aud", "exp", "iat", "auth_time", "nonce", "amr", "name", "preferred_username"},
+		TokenEndpointAuthMethodsSupported: d.TokenEndpointAuthMethodsSupported,
+		CodeChallengeMethodsSupported:     []string{"S256"},
+		AuthorizationResponseIssParameter: true,
+	}
+}
+
+// DeviceAuthorization is the device authorization response (RFC 8628 3.2).
+type DeviceAuthorization struct {
+	DeviceCode              string `json:"device_code"`
+	UserCode                string `json:"user_code"`
+	VerificationURI         string `json:"verification_uri"`
+	VerificationURIComplete string `json:"verification_uri_complete"`
+	ExpiresIn               int64  `json:"expires_in"`
+	Interval                int64  `json:"interval"`
+}
+
+func NewDeviceAuthorization(d *dtos.DeviceAuthorizationResponse) DeviceAuthorization {
+	return DeviceAuthorization{
+		DeviceCode:              d.DeviceCode,
+		UserCode:                d.UserCode,
+		VerificationURI:         d.VerificationURI,
+		VerificationURIComplete: d.VerificationURIComplete,
+		ExpiresIn:               d.ExpiresIn,
+		Interval:                d.Interval,
+	}
+}
+
+// DeviceInfo describes a pending device grant on the verification page.
+type DeviceInfo struct {
+	UserCode   string   `json:"userCode"`
+	ClientName string   `json:"clientName"`
+	Scope      []string `json:"scope"`
+}
+
+func NewDeviceInfo(d *dtos.DeviceInfoResponse) DeviceInfo {
+	return DeviceInfo{
+		UserCode:   d.UserCode,
+		ClientName: d.ClientName,
+		Scope:      d.Scope,
+	}
+}
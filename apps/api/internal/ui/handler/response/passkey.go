@@ -0,0 +1,65 @@
+package response
+
+import (
+	"time"
+
+	"github.com/kobayashiyabako16g/passkey-auth-example/internal/domain/model"
+)
+
+type Credential struct {
+	ID             string       `json:"id"`
+	Name           string       `json:"name"`
+	CreatedAt      time.Time    `json:"createdAt"`
+	LastUsedAt     *time.Time   `json:"lastUsedAt"`
+	Transports     []string     `json:"transports"`
+	AAGUID         string       `json:"aaguid"`
+	BackupEligible bool         `json:"backupEligible"`
+	BackupState    bool         `json:"backupState"`
+	CloneWarning   bool         `json:"cloneWarning"`
+	Quarantined    bool         `json:"quarantined"`
+	QuarantinedAt  *time.Time   `json:"quarantinedAt"`
+	CloneEvents    []CloneEvent `json:"cloneEvents"`
+}
+
+type CloneEvent struct {
+	SignCount uint32    `json:"signCount"`
+	Policy    string    `json:"policy"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+func NewCredential(c model.Credential) Credential {
+	return Credential{
+		ID:             c.ID,
+		Name:           c.Name,
+		CreatedAt:      c.CreatedAt,
+		LastUsedAt:     c.LastUsedAt,
+		Transports:     c.Transports(),
+		AAGUID:         c.AAGUID(),
+		BackupEligible: c.Credential.Flags.BackupEligible,
+		BackupState:    c.Credential.Flags.BackupState,
+		CloneWarning:   c.Credential.Authenticator.CloneWarning,
+		Quarantined:    c.Quarantined(),
+		QuarantinedAt:  c.QuarantinedAt,
+		CloneEvents:    newCloneEvents(c.CloneEvents),
+	}
+}
+
+func newCloneEvents(events []model.CloneEvent) []CloneEvent {
+	res := make([]CloneEvent, 0, len(events))
+	for _, e := range events {
+		res = append(res, CloneEvent{
+			SignCount: e.SignCount,
+			Policy:    string(e.Policy),
+			CreatedAt: e.CreatedAt,
+		})
+	}
+	return res
+}
+
+func NewCredentials(credentials []model.Credential) []Credential {
+	res := make([]Credential, 0, len(credentials))
+	for _, c := range credentials {
+		res = append(res, NewCredential(c))
+	}
+	return res
+}
@@ -0,0 +1,38 @@
+package response
+
+import (
+	"time"
+
+	"github.com/kobayashiyabako16g/passkey-auth-example/internal/domain/model"
+)
+
+type QRLoginStart struct {
+	Code       string `json:"code"`
+	ApproveURL string `json:"approveUrl"`
+	ExpiresIn  int64  `json:"expiresIn"`
+}
+
+// QRLogin describes the browser asking to sign in to the user approving it.
+type QRLogin struct {
+	Code      string    `json:"code"`
+	CreatedAt time.Time `json:"createdAt"`
+	ExpiresAt time.Time `json:"expiresAt"`
+	IP        string    `json:"ip"`
+	UserAgent string    `json:"userAgent"`
+	Browser   string    `json:"browser"`
+	OS        string    `json:"os"`
+	Device    string    `json:"device"`
+}
+
+func NewQRLogin(login *model.QRLogin, code string) QRLogin {
+	return QRLogin{
+		Code:      code,
+		CreatedAt: login.CreatedAt,
+		ExpiresAt: login.ExpiresAt,
+		IP:        login.IP,
+		UserAgent: login.UserAgent,
+		Browser:   login.Device.Browser,
+		OS:        login.Device.OS,
+		Device:    login.Device.Device,
+	}
+}
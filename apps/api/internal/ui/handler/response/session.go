@@ -0,0 +1,52 @@
+package response
+
+import (
+	"time"
+
+	"github.com/kobayashiyabako16g/passkey-auth-example/internal/domain/model"
+)
+
+type Session struct {
+	ID         string             `json:"id"`
+	Current    bool               `json:"current"`
+	CreatedAt  time.Time          `json:"createdAt"`
+	LastSeenAt time.Time          `json:"lastSeenAt"`
+	ExpiresAt  time.Time          `json:"expiresAt"`
+	IP         string             `json:"ip"`
+	UserAgent  string             `json:"userAgent"`
+	Browser    string             `json:"browser"`
+	OS         string             `json:"os"`
+	Device     string             `json:"device"`
+	Credential *SessionCredential `json:"credential"`
+}
+
+type SessionCredential struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+func NewSessions(sessions []model.Session, current string, credentialNames map[string]string) []Session {
+	res := make([]Session, 0, len(sessions))
+	for _, s := range sessions {
+		item := Session{
+			ID:         s.PublicID(),
+			Current:    s.PublicID() == current,
+			CreatedAt:  s.CreatedAt,
+			LastSeenAt: s.LastSeenAt,
+			ExpiresAt:  s.ExpiresAt,
+			IP:         s.IP,
+			UserAgent:  s.UserAgent,
+			Browser:    s.Device.Browser,
+			OS:         s.Device.OS,
+			Device:     s.Device.Device,
+		}
+		if s.CredentialID != "" {
+			item.Credential = &SessionCredential{
+				ID:   s.CredentialID,
+				Name: credentialNames[s.CredentialID],
+			}
+		}
+		res = append(res, item)
+	}
+	return res
+}
@@ -0,0 +1,19 @@
+package response
+
+import dtos "github.com/kobayashiyabako16g/passkey-auth-example/internal/usecase/dto/token"
+
+type Token struct {
+	AccessToken  string `json:"accessToken"`
+	TokenType    string `json:"tokenType"`
+	ExpiresIn    int64  `json:"expiresIn"`
+	RefreshToken string `json:"refreshToken"`
+}
+
+func NewToken(t *dtos.TokenResponse) Token {
+	return Token{
+		AccessToken:  t.AccessToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    t.ExpiresIn,
+		RefreshToken: t.RefreshToken,
+	}
+}
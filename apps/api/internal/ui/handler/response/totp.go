@@ -0,0 +1,12 @@
+package response
+
+type TOTPEnrollment struct {
+	Secret string `json:"secret"`
+	// URI is shown as a QR code for authenticator apps.
+	URI string `json:"uri"`
+}
+
+type TOTPStatus struct {
+	Enabled bool   `json:"enabled"`
+	Policy  string `json:"policy,omitempty"`
+}
@@ -0,0 +1,223 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/kobayashiyabako16g/passkey-auth-example/internal/contexts"
+	"github.com/kobayashiyabako16g/passkey-auth-example/internal/ui/handler/response"
+	"github.com/kobayashiyabako16g/passkey-auth-example/internal/usecase"
+	dtos "github.com/kobayashiyabako16g/passkey-auth-example/internal/usecase/dto/session"
+	"github.com/kobayashiyabako16g/passkey-auth-example/pkg/logger"
+)
+
+type Session interface {
+	Logout(w http.ResponseWriter, r *http.Request)
+	LogoutAll(w http.ResponseWriter, r *http.Request)
+	ListSessions(w http.ResponseWriter, r *http.Request)
+	RevokeSession(w http.ResponseWriter, r *http.Request)
+	Me(w http.ResponseWriter, r *http.Request)
+	Verify(w http.ResponseWriter, r *http.Request)
+}
+
+type session struct {
+	usecase usecase.Session
+	// loginURL is where Verify redirects unauthenticated requests when asked to.
+	loginURL string
+	// allowedHosts are the hosts that the login page may return to.
+	allowedHosts []string
+}
+
+func NewSession(usecase usecase.Session, loginURL string, allowedHosts []string) Session {
+	return &session{usecase, loginURL, allowedHosts}
+}
+
+func (h *session) Logout(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	logger.Info(ctx, "logout ----------------------")
+
+	sessionID, _ := sessionCookie(r)
+	if err := h.usecase.Logout(ctx, dtos.LogoutRequest{Session: sessionID}); err != nil {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	clearCookie(w, sessionCookieName)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "success"})
+}
+
+func (h *session) LogoutAll(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	logger.Info(ctx, "logout all ----------------------")
+
+	// 認証済みのセッション (RequireAuth で設定)
+	current := contexts.GetSession(ctx)
+	if current == nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	if err := h.usecase.LogoutAll(ctx, dtos.LogoutAllRequest{Session: current}); err != nil {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	clearCookie(w, sessionCookieName)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "success"})
+}
+
+func (h *session) ListSessions(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	// 認証済みのセッション (RequireAuth で設定)
+	current := contexts.GetSession(ctx)
+	if current == nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	result, err := h.usecase.ListSessions(ctx, dtos.ListSessionsRequest{Session: current})
+	if err != nil {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response.NewSessions(result.Sessions, result.Current, result.CredentialNames)); err != nil {
+		logger.Error(ctx, "Failed to write response", logger.WithError(err))
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+}
+
+func (h *session) RevokeSession(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	// 認証済みのセッション (RequireAuth で設定)
+	current := contexts.GetSession(ctx)
+	if current == nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	result, err := h.usecase.RevokeSession(ctx, dtos.RevokeSessionRequest{
+		Session: current,
+		ID:      r.PathValue("id"),
+	})
+	if err != nil {
+		switch err {
+		case dtos.ErrSessionNotFound:
+			http.Error(w, "Not Found", http.StatusNotFound)
+		default:
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	if result.Current {
+		clearCookie(w, sessionCookieName)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "success"})
+}
+
+func (h *session) Me(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	// 認証済みのユーザーとセッション (RequireAuth で設定)
+	user := contexts.GetUser(ctx)
+	current := contexts.GetSession(ctx)
+	if user == nil || current == nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	result, err := h.usecase.Me(ctx, dtos.MeRequest{User: user, Session: current})
+	if err != nil {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response.NewMe(result.User, result.Session, result.Credential)); err != nil {
+		logger.Error(ctx, "Failed to write response", logger.WithError(err))
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+}
+
+// Verify is the endpoint for Caddy forward_auth and nginx auth_request.
+// It answers 200 with the user in X-Auth-* headers, or 401. With ?redirect=true
+// it redirects to the login page instead, passing the original URL as rd.
+func (h *session) Verify(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	w.Header().Set("Cache-Control", "no-store")
+
+	sessionID, _ := sessionCookie(r)
+	result, err := h.usecase.Verify(ctx, dtos.VerifyRequest{Session: sessionID})
+	if err != nil {
+		switch err {
+		case dtos.ErrUnauthorized:
+			if r.URL.Query().Get("redirect") == "true" {
+				http.Redirect(w, r, h.loginRedirect(r), http.StatusFound)
+				return
+			}
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		default:
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("X-Auth-User", result.User.Name)
+	w.Header().Set("X-Auth-User-Id", result.User.ID)
+	w.Header().Set("X-Auth-Session", result.Session.PublicID())
+	w.Header().Set("X-Auth-Time", result.Session.AuthTime.UTC().Format(time.RFC3339))
+	w.WriteHeader(http.StatusOK)
+}
+
+// loginRedirect builds the login URL with the URL the proxy was asked for.
+// The URL is left out unless it's on an allowed host, so the login page can't be
+// turned into an open redirect with forged headers.
+func (h *session) loginRedirect(r *http.Request) string {
+	loginURL, err := url.Parse(h.loginURL)
+	if err != nil {
+		return h.loginURL
+	}
+
+	// Caddy と nginx はそれぞれ元のリクエストをヘッダーで渡す
+	host := r.Header.Get("X-Forwarded-Host")
+	uri := r.Header.Get("X-Forwarded-Uri")
+	if uri == "" {
+		uri = r.Header.Get("X-Original-URI")
+	}
+	if host != "" {
+		proto := r.Header.Get("X-Forwarded-Proto")
+		if proto == "" {
+			proto = "https"
+		}
+		// ヘッダーを連結した結果を解析し直し、ホストが書き換えられていないか確かめる
+		rd, err := url.Parse(proto + "://" + host + uri)
+		if err != nil || (rd.Scheme != "https" && rd.Scheme != "http") || rd.User != nil ||
+			!strings.EqualFold(rd.Host, host) || !h.allowedHost(rd.Hostname()) {
+			logger.Info(r.Context(), "ignore redirect to a host that isn't allowed", "host", host)
+			return loginURL.String()
+		}
+		query := loginURL.Query()
+		query.Set("rd", rd.String())
+		loginURL.RawQuery = query.Encode()
+	}
+	return loginURL.String()
+}
+
+func (h *session) allowedHost(host string) bool {
+	return slices.ContainsFunc(h.allowedHosts, func(allowed string) bool {
+		return strings.EqualFold(allowed, host)
+	})
+}
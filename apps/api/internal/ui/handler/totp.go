@@ -0,0 +1,223 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/kobayashiyabako16g/passkey-auth-example/internal/contexts"
+	"github.com/kobayashiyabako16g/passkey-auth-example/internal/domain/model"
+	"github.com/kobayashiyabako16g/passkey-auth-example/internal/ui/handler/request"
+	"github.com/kobayashiyabako16g/passkey-auth-example/internal/ui/handler/response"
+	"github.com/kobayashiyabako16g/passkey-auth-example/internal/usecase"
+	dtos "github.com/kobayashiyabako16g/passkey-auth-example/internal/usecase/dto/totp"
+	"github.com/kobayashiyabako16g/passkey-auth-example/pkg/logger"
+)
+
+type TOTP interface {
+	BeginEnroll(w http.ResponseWriter, r *http.Request)
+	FinishEnroll(w http.ResponseWriter, r *http.Request)
+	Status(w http.ResponseWriter, r *http.Request)
+	Disable(w http.ResponseWriter, r *http.Request)
+	Verify(w http.ResponseWriter, r *http.Request)
+	Login(w http.ResponseWriter, r *http.Request)
+}
+
+type totp struct {
+	usecase usecase.TOTP
+}
+
+func NewTOTP(usecase usecase.TOTP) TOTP {
+	return &totp{usecase}
+}
+
+func (h *totp) BeginEnroll(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	logger.Info(ctx, "begin totp enroll ----------------------")
+
+	// 認証済みのユーザー (RequireAuth で設定)
+	user := contexts.GetUser(ctx)
+	if user == nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	result, err := h.usecase.BeginEnroll(ctx, dtos.BeginEnrollRequest{User: user})
+	if err != nil {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(response.TOTPEnrollment{Secret: result.Secret, URI: result.URI})
+}
+
+// FinishEnroll confirms the secret with a code from the app and sets the policy.
+func (h *totp) FinishEnroll(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	logger.Info(ctx, "finish totp enroll ----------------------")
+
+	// 認証済みのユーザー (RequireAuth で設定)
+	user := contexts.GetUser(ctx)
+	if user == nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req request.FinishTOTPEnroll
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		logger.Info(ctx, "can't decode totp enrollment", logger.WithError(err))
+		http.Error(w, "Bad Requset", http.StatusBadRequest)
+		return
+	}
+
+	err := h.usecase.FinishEnroll(ctx, dtos.FinishEnrollRequest{
+		User:      user,
+		Code:      req.Code,
+		Policy:    model.TOTPPolicy(req.Policy),
+		IP:        clientIP(r),
+		UserAgent: r.UserAgent(),
+	})
+	if err != nil {
+		switch err {
+		case dtos.ErrInvalidPolicy, dtos.ErrEnrollmentNotFound, dtos.ErrInvalidCode:
+			http.Error(w, "Bad Requset", http.StatusBadRequest)
+		default:
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "success"})
+}
+
+func (h *totp) Status(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	// 認証済みのユーザー (RequireAuth で設定)
+	user := contexts.GetUser(ctx)
+	if user == nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	result, err := h.usecase.Status(ctx, dtos.StatusRequest{User: user})
+	if err != nil {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response.TOTPStatus{Enabled: result.Enabled, Policy: string(result.Policy)})
+}
+
+func (h *totp) Disable(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	logger.Info(ctx, "disable totp ----------------------")
+
+	// 認証済みのユーザー (RequireAuth で設定)
+	user := contexts.GetUser(ctx)
+	if user == nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	err := h.usecase.Disable(ctx, dtos.DisableRequest{
+		User:      user,
+		IP:        clientIP(r),
+		UserAgent: r.UserAgent(),
+	})
+	if err != nil {
+		switch err {
+		case dtos.ErrNotEnabled:
+			http.Error(w, "Not Found", http.StatusNotFound)
+		default:
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Verify completes a login that answered second_factor_required.
+func (h *totp) Verify(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	logger.Info(ctx, "verify totp ----------------------")
+
+	sessionID, ok := sessionCookie(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req request.VerifyTOTP
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		logger.Info(ctx, "can't decode totp code", logger.WithError(err))
+		http.Error(w, "Bad Requset", http.StatusBadRequest)
+		return
+	}
+
+	result, err := h.usecase.Verify(ctx, dtos.VerifyRequest{
+		Session:   sessionID,
+		Code:      req.Code,
+		IP:        clientIP(r),
+		UserAgent: r.UserAgent(),
+	})
+	if err != nil {
+		h.writeCodeError(w, err)
+		return
+	}
+
+	setSessionCookie(w, result.Session)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "success"})
+}
+
+// Login signs in with a code when the account uses TOTP for recovery.
+// The session only allows registering a new passkey.
+func (h *totp) Login(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	logger.Info(ctx, "totp login ----------------------")
+
+	var req request.TOTPLogin
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		logger.Info(ctx, "can't decode totp login", logger.WithError(err))
+		http.Error(w, "Bad Requset", http.StatusBadRequest)
+		return
+	}
+	if req.Username == "" || req.Code == "" {
+		http.Error(w, "Bad Requset", http.StatusBadRequest)
+		return
+	}
+	sessionID, _ := sessionCookie(r)
+
+	result, err := h.usecase.Login(ctx, dtos.LoginRequest{
+		Username:  req.Username,
+		Code:      req.Code,
+		Session:   sessionID,
+		IP:        clientIP(r),
+		UserAgent: r.UserAgent(),
+	})
+	if err != nil {
+		h.writeCodeError(w, err)
+		return
+	}
+
+	setSessionCookie(w, result.Session)
+	// クライアントは続けて /passkey/credentials/start で新しいパスキーを登録する
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "enrollment_required"})
+}
+
+func (h *totp) writeCodeError(w http.ResponseWriter, err error) {
+	switch err {
+	case dtos.ErrSessionNotFound, dtos.ErrNotEnabled, dtos.ErrInvalidCode:
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+	case dtos.ErrTooManyAttempts:
+		http.Error(w, "Too Many Requests", http.StatusTooManyRequests)
+	default:
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,34 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/kobayashiyabako16g/passkey-auth-example/pkg/jws"
+	"github.com/kobayashiyabako16g/passkey-auth-example/pkg/logger"
+)
+
+type WellKnown interface {
+	JWKS(w http.ResponseWriter, r *http.Request)
+}
+
+type wellKnown struct {
+	keys *jws.KeyManager
+}
+
+func NewWellKnown(keys *jws.KeyManager) WellKnown {
+	return &wellKnown{keys}
+}
+
+func (h *wellKnown) JWKS(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	w.Header().Set("Content-Type", "application/json")
+	// 検証側が署名に使われる前に次の鍵を取得できるよう SIGNING_KEY_PUBLISH_AHEAD より短くする
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	if err := json.NewEncoder(w).Encode(h.keys.JWKS()); err != nil {
+		logger.Error(ctx, "Failed to write response", logger.WithError(err))
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+}
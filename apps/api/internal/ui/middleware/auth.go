@@ -0,0 +1,89 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/kobayashiyabako16g/passkey-auth-example/internal/contexts"
+	"github.com/kobayashiyabako16g/passkey-auth-example/internal/domain/repository"
+	"github.com/kobayashiyabako16g/passkey-auth-example/pkg/logger"
+)
+
+// sessionCookieName must match the cookie issued by the login handler.
+const sessionCookieName = "session"
+
+// RequireAuth allows requests carrying an authenticated session cookie.
+// The session and its user are stored in the request context.
+func RequireAuth(sr repository.Session, ur repository.User) func(http.Handler) http.Handler {
+	return requireSession(sr, ur, false)
+}
+
+// RequireEnrollment is RequireAuth that also allows the session of a recovery code,
+// which may only register a new passkey.
+func RequireEnrollment(sr repository.Session, ur repository.User) func(http.Handler) http.Handler {
+	return requireSession(sr, ur, true)
+}
+
+func requireSession(sr repository.Session, ur repository.User, allowEnrollment bool) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := r.Context()
+
+			cookie, err := r.Cookie(sessionCookieName)
+			if err != nil || cookie.Value == "" {
+				logger.Info(ctx, "session cookie is not found")
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+
+			session, err := sr.Get(ctx, cookie.Value)
+			if err != nil {
+				logger.Error(ctx, "can't get session", logger.WithError(err))
+				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+				return
+			}
+			if session != nil && session.SecondFactorRequired {
+				// クライアントは /auth/totp/verify で TOTP のコードを送る
+				logger.Info(ctx, "session must verify the second factor first")
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusUnauthorized)
+				json.NewEncoder(w).Encode(map[string]string{"error": "second_factor_required"})
+				return
+			}
+			if session != nil && session.EnrollmentRequired && !allowEnrollment {
+				// クライアントは新しいパスキーを登録する
+				logger.Info(ctx, "session must enroll a passkey first")
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusForbidden)
+				json.NewEncoder(w).Encode(map[string]string{"error": "enrollment_required"})
+				return
+			}
+			if session == nil || !(session.Authenticated || session.EnrollmentRequired) || session.UserID == "" {
+				logger.Info(ctx, "session is not authenticated")
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+			if err := sr.Touch(ctx, session); err != nil {
+				logger.Error(ctx, "can't touch session", logger.WithError(err))
+				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+				return
+			}
+
+			user, err := ur.FindById(ctx, session.UserID)
+			if err != nil {
+				logger.Error(ctx, "can't get user", logger.WithError(err))
+				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+				return
+			}
+			if user == nil {
+				logger.Info(ctx, "user not found")
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+
+			ctx = contexts.SetSession(ctx, session)
+			ctx = contexts.SetUser(ctx, user)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
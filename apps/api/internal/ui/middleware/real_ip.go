@@ -0,0 +1,58 @@
+package middleware
+
+import (
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+
+	"github.com/kobayashiyabako16g/passkey-auth-example/internal/contexts"
+)
+
+// RealIPMiddleware resolves the client address. X-Forwarded-For is only read when the request
+// comes from a trusted proxy, and then from the right, because a proxy like Caddy appends to
+// the header the client sent: the first entry not added by a trusted proxy is the client.
+func RealIPMiddleware(next http.Handler, trustedProxies []netip.Prefix) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ip := realIP(r, trustedProxies)
+		next.ServeHTTP(w, r.WithContext(contexts.SetClientIP(r.Context(), ip)))
+	})
+}
+
+func realIP(r *http.Request, trustedProxies []netip.Prefix) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	ip := host
+	addr, err := netip.ParseAddr(host)
+	if err != nil || !trusted(addr, trustedProxies) {
+		return ip
+	}
+
+	var entries []string
+	for _, value := range r.Header.Values("X-Forwarded-For") {
+		entries = append(entries, strings.Split(value, ",")...)
+	}
+	for i := len(entries) - 1; i >= 0; i-- {
+		addr, err := netip.ParseAddr(strings.TrimSpace(entries[i]))
+		if err != nil {
+			break
+		}
+		ip = addr.Unmap().String()
+		if !trusted(addr, trustedProxies) {
+			break
+		}
+	}
+	return ip
+}
+
+func trusted(addr netip.Addr, trustedProxies []netip.Prefix) bool {
+	addr = addr.Unmap()
+	for _, prefix := range trustedProxies {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,41 @@
+package middleware
+
+import (
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+)
+
+func TestRealIP(t *testing.T) {
+	trustedProxies := []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")}
+
+	tests := []struct {
+		name           string
+		remoteAddr     string
+		forwardedFor   []string
+		trustedProxies []netip.Prefix
+		want           string
+	}{
+		{"untrusted peer", "203.0.113.7:1234", []string{"198.51.100.1"}, trustedProxies, "203.0.113.7"},
+		{"no trusted proxies", "10.0.0.1:1234", []string{"198.51.100.1"}, nil, "10.0.0.1"},
+		{"trusted proxy without header", "10.0.0.1:1234", nil, trustedProxies, "10.0.0.1"},
+		{"trusted proxy", "10.0.0.1:1234", []string{"198.51.100.1"}, trustedProxies, "198.51.100.1"},
+		{"spoofed entry before the client", "10.0.0.1:1234", []string{"192.0.2.66, 198.51.100.1"}, trustedProxies, "198.51.100.1"},
+		{"chain of trusted proxies", "10.0.0.1:1234", []string{"198.51.100.1, 10.0.0.2"}, trustedProxies, "198.51.100.1"},
+		{"several header lines", "10.0.0.1:1234", []string{"192.0.2.66", "198.51.100.1"}, trustedProxies, "198.51.100.1"},
+		{"only trusted entries", "10.0.0.1:1234", []string{"10.0.0.3, 10.0.0.2"}, trustedProxies, "10.0.0.3"},
+		{"garbage before the client", "10.0.0.1:1234", []string{"not-an-ip, 198.51.100.1"}, trustedProxies, "198.51.100.1"},
+		{"garbage from the proxy", "10.0.0.1:1234", []string{"198.51.100.1, not-an-ip"}, trustedProxies, "10.0.0.1"},
+		{"ipv4-mapped proxy", "[::ffff:10.0.0.1]:1234", []string{"198.51.100.1"}, trustedProxies, "198.51.100.1"},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.RemoteAddr = tt.remoteAddr
+		for _, value := range tt.forwardedFor {
+			r.Header.Add("X-Forwarded-For", value)
+		}
+		if got := realIP(r, tt.trustedProxies); got != tt.want {
+			t.Errorf("%s: realIP = %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,41 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/kobayashiyabako16g/passkey-auth-example/internal/contexts"
+	"github.com/kobayashiyabako16g/passkey-auth-example/pkg/logger"
+)
+
+// RequireRecentAuth allows requests whose session authenticated with user verification
+// within maxAge. It must run after RequireAuth.
+// Otherwise it answers 401 with {"error":"reauth_required"}, and the client runs
+// the re-authentication ceremony before retrying.
+func RequireRecentAuth(maxAge time.Duration) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := r.Context()
+
+			session := contexts.GetSession(ctx)
+			if session == nil {
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+
+			if !session.UserVerified || time.Since(session.AuthTime) > maxAge {
+				logger.Info(ctx, "re-authentication required", "user_id", session.UserID)
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusUnauthorized)
+				json.NewEncoder(w).Encode(map[string]any{
+					"error":  "reauth_required",
+					"maxAge": int64(maxAge.Seconds()),
+				})
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
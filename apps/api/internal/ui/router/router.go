@@ -7,16 +7,93 @@ import (
 )
 
 type Router struct {
-	ah handler.Auth
+	ah                handler.Auth
+	ph                handler.Passkey
+	sh                handler.Session
+	adh               handler.Admin
+	th                handler.Token
+	wh                handler.WellKnown
+	oh                handler.OIDC
+	qh                handler.QRLogin
+	ach               handler.Account
+	rh                handler.Recovery
+	mh                handler.MagicLink
+	eh                handler.Email
+	pwh               handler.Password
+	toh               handler.TOTP
+	requireAuth       func(http.Handler) http.Handler
+	requireEnrollment func(http.Handler) http.Handler
+	requireRecentAuth func(http.Handler) http.Handler
+	requireAdmin      func(http.Handler) http.Handler
 }
 
-func NewRouter(ah handler.Auth) Router {
-	return Router{ah}
+func NewRouter(ah handler.Auth, ph handler.Passkey, sh handler.Session, adh handler.Admin, th handler.Token, wh handler.WellKnown, oh handler.OIDC, qh handler.QRLogin, ach handler.Account, rh handler.Recovery, mh handler.MagicLink, eh handler.Email, pwh handler.Password, toh handler.TOTP, requireAuth func(http.Handler) http.Handler, requireEnrollment func(http.Handler) http.Handler, requireRecentAuth func(http.Handler) http.Handler, requireAdmin func(http.Handler) http.Handler) Router {
+	return Router{ah, ph, sh, adh, th, wh, oh, qh, ach, rh, mh, eh, pwh, toh, requireAuth, requireEnrollment, requireRecentAuth, requireAdmin}
 }
 
 func (r *Router) HandleRequest(mux *http.ServeMux) {
+	mux.Handle("GET /.well-known/jwks.json", http.HandlerFunc(r.wh.JWKS))
+
+	// OpenID Connect
+	mux.Handle("GET /.well-known/openid-configuration", http.HandlerFunc(r.oh.Discovery))
+	mux.Handle("GET /oauth/authorize", http.HandlerFunc(r.oh.Authorize))
+	mux.Handle("POST /oauth/authorize/complete", r.requireAuth(http.HandlerFunc(r.oh.CompleteAuthorization)))
+	mux.Handle("POST /oauth/token", http.HandlerFunc(r.oh.Token))
+	mux.Handle("GET /oauth/userinfo", http.HandlerFunc(r.oh.UserInfo))
+	mux.Handle("POST /oauth/userinfo", http.HandlerFunc(r.oh.UserInfo))
+	mux.Handle("POST /oauth/introspect", http.HandlerFunc(r.oh.Introspect))
+	mux.Handle("POST /oauth/revoke", http.HandlerFunc(r.oh.Revoke))
+	mux.Handle("POST /oauth/device_authorization", http.HandlerFunc(r.oh.DeviceAuthorization))
+	mux.Handle("GET /oauth/device", r.requireAuth(http.HandlerFunc(r.oh.DeviceInfo)))
+	mux.Handle("POST /oauth/device/approve", r.requireAuth(http.HandlerFunc(r.oh.ApproveDevice)))
 	mux.Handle("POST /passkey/register/start", http.HandlerFunc(r.ah.BeginRegistration))
 	mux.Handle("POST /passkey/register/finish", http.HandlerFunc(r.ah.FinishRegistration))
 	mux.Handle("POST /passkey/login/start", http.HandlerFunc(r.ah.BeginLogin))
 	mux.Handle("POST /passkey/login/finish", http.HandlerFunc(r.ah.FinishLogin))
+	mux.Handle("POST /auth/logout", http.HandlerFunc(r.sh.Logout))
+	mux.Handle("GET /auth/verify", http.HandlerFunc(r.sh.Verify))
+	mux.Handle("POST /auth/token/refresh", http.HandlerFunc(r.th.Refresh))
+	mux.Handle("POST /auth/qr/start", http.HandlerFunc(r.qh.Start))
+	mux.Handle("GET /auth/qr/wait", http.HandlerFunc(r.qh.Wait))
+	mux.Handle("POST /auth/recovery/login", http.HandlerFunc(r.rh.Login))
+	mux.Handle("POST /auth/magic-link", http.HandlerFunc(r.mh.Send))
+	mux.Handle("POST /auth/magic-link/login", http.HandlerFunc(r.mh.Login))
+	mux.Handle("POST /auth/email/verify", http.HandlerFunc(r.eh.Verify))
+	mux.Handle("POST /auth/password/login", http.HandlerFunc(r.pwh.Login))
+	mux.Handle("POST /auth/totp/verify", http.HandlerFunc(r.toh.Verify))
+	mux.Handle("POST /auth/totp/login", http.HandlerFunc(r.toh.Login))
+
+	// signed-in user
+	mux.Handle("POST /passkey/credentials/start", r.requireEnrollment(http.HandlerFunc(r.ph.BeginAddCredential)))
+	mux.Handle("POST /passkey/credentials/finish", r.requireEnrollment(http.HandlerFunc(r.ph.FinishAddCredential)))
+	mux.Handle("GET /passkey/credentials", r.requireAuth(http.HandlerFunc(r.ph.ListCredentials)))
+	mux.Handle("PATCH /passkey/credentials/{id}", r.requireAuth(http.HandlerFunc(r.ph.RenameCredential)))
+	mux.Handle("DELETE /passkey/credentials/{id}", r.requireAuth(r.requireRecentAuth(http.HandlerFunc(r.ph.DeleteCredential))))
+	mux.Handle("GET /auth/me", r.requireAuth(http.HandlerFunc(r.sh.Me)))
+	mux.Handle("PATCH /auth/me/username", r.requireAuth(r.requireRecentAuth(http.HandlerFunc(r.ach.ChangeUsername))))
+	mux.Handle("DELETE /auth/me", r.requireAuth(r.requireRecentAuth(http.HandlerFunc(r.ach.DeleteAccount))))
+	mux.Handle("POST /auth/reauth/start", r.requireAuth(http.HandlerFunc(r.ah.BeginReauth)))
+	mux.Handle("POST /auth/reauth/finish", r.requireAuth(http.HandlerFunc(r.ah.FinishReauth)))
+	mux.Handle("POST /auth/me/email/start", r.requireAuth(http.HandlerFunc(r.eh.BeginChange)))
+	mux.Handle("POST /auth/me/email/finish", r.requireAuth(http.HandlerFunc(r.eh.FinishChange)))
+	mux.Handle("GET /auth/totp", r.requireAuth(http.HandlerFunc(r.toh.Status)))
+	mux.Handle("POST /auth/totp/start", r.requireAuth(r.requireRecentAuth(http.HandlerFunc(r.toh.BeginEnroll))))
+	mux.Handle("POST /auth/totp/finish", r.requireAuth(r.requireRecentAuth(http.HandlerFunc(r.toh.FinishEnroll))))
+	mux.Handle("DELETE /auth/totp", r.requireAuth(r.requireRecentAuth(http.HandlerFunc(r.toh.Disable))))
+	mux.Handle("GET /auth/recovery-codes", r.requireAuth(http.HandlerFunc(r.rh.Status)))
+	mux.Handle("POST /auth/recovery-codes", r.requireAuth(r.requireRecentAuth(http.HandlerFunc(r.rh.GenerateCodes))))
+	mux.Handle("POST /auth/logout/all", r.requireAuth(http.HandlerFunc(r.sh.LogoutAll)))
+	mux.Handle("GET /auth/sessions", r.requireAuth(http.HandlerFunc(r.sh.ListSessions)))
+	mux.Handle("DELETE /auth/sessions/{id}", r.requireAuth(http.HandlerFunc(r.sh.RevokeSession)))
+	mux.Handle("GET /auth/qr/{code}", r.requireAuth(http.HandlerFunc(r.qh.Info)))
+	mux.Handle("POST /auth/qr/{code}/approve/start", r.requireAuth(http.HandlerFunc(r.qh.BeginApprove)))
+	mux.Handle("POST /auth/qr/{code}/approve/finish", r.requireAuth(http.HandlerFunc(r.qh.FinishApprove)))
+
+	// admin
+	mux.Handle("POST /admin/users", r.requireAdmin(http.HandlerFunc(r.adh.CreateUser)))
+	mux.Handle("POST /admin/users/{userID}/enrollment", r.requireAdmin(http.HandlerFunc(r.adh.IssueEnrollmentLink)))
+	mux.Handle("GET /admin/users/{userID}/credentials", r.requireAdmin(http.HandlerFunc(r.adh.ListCredentials)))
+	mux.Handle("DELETE /admin/users/{userID}/credentials/{id}/quarantine", r.requireAdmin(http.HandlerFunc(r.adh.ClearQuarantine)))
+	mux.Handle("GET /admin/users/{userID}/audit", r.requireAdmin(http.HandlerFunc(r.adh.ListAuditEvents)))
+	mux.Handle("POST /admin/oauth/clients", r.requireAdmin(http.HandlerFunc(r.adh.RegisterClient)))
 }
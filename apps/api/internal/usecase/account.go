@@ -0,0 +1,99 @@
+package usecase
+
+import (
+	"context"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/kobayashiyabako16g/passkey-auth-example/internal/domain/repository"
+	dtos "github.com/kobayashiyabako16g/passkey-auth-example/internal/usecase/dto/account"
+	"github.com/kobayashiyabako16g/passkey-auth-example/pkg/logger"
+)
+
+// Account changes or deletes the account of the signed-in user.
+// The routes require a recent re-authentication.
+type Account interface {
+	ChangeUsername(ctx context.Context, dto dtos.ChangeUsernameRequest) error
+	DeleteAccount(ctx context.Context, dto dtos.DeleteAccountRequest) error
+}
+
+// maxUsernameLength is the maximum number of characters of a username.
+const maxUsernameLength = 64
+
+type account struct {
+	sr repository.Session
+	ur repository.User
+	rr repository.RefreshToken
+}
+
+func NewAccount(sr repository.Session, ur repository.User, rr repository.RefreshToken) Account {
+	return &account{sr, ur, rr}
+}
+
+func (a *account) ChangeUsername(ctx context.Context, dto dtos.ChangeUsernameRequest) error {
+	user := dto.User
+
+	username := strings.TrimSpace(dto.Username)
+	if username == "" || utf8.RuneCountInString(username) > maxUsernameLength {
+		logger.Info(ctx, "invalid username")
+		return dtos.ErrInvalidUsername
+	}
+	if username == user.Name {
+		return nil
+	}
+
+	exists, err := a.ur.ExistsByUsername(ctx, username)
+	if err != nil {
+		logger.Error(ctx, "can't get user", logger.WithError(err))
+		return err
+	}
+	if exists {
+		return dtos.ErrUserExists
+	}
+
+	if err := a.ur.Rename(ctx, user.ID, username); err != nil {
+		if err == repository.ErrUsernameTaken {
+			return dtos.ErrUserExists
+		}
+		logger.Error(ctx, "can't rename user", logger.WithError(err))
+		return err
+	}
+
+	// セッションに保存したユーザー名も更新する (/auth/verify が返す)
+	sessions, err := a.sr.ListByUserID(ctx, user.ID)
+	if err != nil {
+		logger.Error(ctx, "can't list sessions", logger.WithError(err))
+		return err
+	}
+	for i := range sessions {
+		sessions[i].Username = username
+		if err := a.sr.Save(ctx, &sessions[i]); err != nil {
+			logger.Error(ctx, "can't save session", logger.WithError(err))
+			return err
+		}
+	}
+
+	logger.Info(ctx, "Changed username", "user_id", user.ID)
+	return nil
+}
+
+// DeleteAccount deletes the user and signs them out everywhere.
+func (a *account) DeleteAccount(ctx context.Context, dto dtos.DeleteAccountRequest) error {
+	user := dto.User
+
+	if err := a.ur.Delete(ctx, user.ID); err != nil {
+		logger.Error(ctx, "can't delete user", logger.WithError(err))
+		return err
+	}
+	if err := a.sr.DeleteAllByUserID(ctx, user.ID); err != nil {
+		logger.Error(ctx, "can't delete sessions", logger.WithError(err))
+		return err
+	}
+	if err := a.rr.RevokeAllByUserID(ctx, user.ID); err != nil {
+		logger.Error(ctx, "can't revoke refresh tokens", logger.WithError(err))
+		return err
+	}
+
+	logger.Info(ctx, "Deleted account", "user_id", user.ID)
+	return nil
+}
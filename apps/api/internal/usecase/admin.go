@@ -0,0 +1,232 @@
+package usecase
+
+import (
+	"context"
+	"net/url"
+	"strings"
+
+	"github.com/kobayashiyabako16g/passkey-auth-example/internal/domain/model"
+	"github.com/kobayashiyabako16g/passkey-auth-example/internal/domain/repository"
+	dtos "github.com/kobayashiyabako16g/passkey-auth-example/internal/usecase/dto/admin"
+	"github.com/kobayashiyabako16g/passkey-auth-example/pkg/logger"
+	"github.com/kobayashiyabako16g/passkey-auth-example/pkg/random"
+)
+
+// Admin provides operations for administrators.
+type Admin interface {
+	ListCredentials(ctx context.Context, dto dtos.ListCredentialsRequest) (*dtos.ListCredentialsResponse, error)
+	ClearQuarantine(ctx context.Context, dto dtos.ClearQuarantineRequest) error
+	RegisterClient(ctx context.Context, dto dtos.RegisterClientRequest) (*dtos.RegisterClientResponse, error)
+	ListAuditEvents(ctx context.Context, dto dtos.ListAuditEventsRequest) (*dtos.ListAuditEventsResponse, error)
+	// CreateUser provisions a user without credentials and returns a link to enroll a passkey.
+	CreateUser(ctx context.Context, dto dtos.CreateUserRequest) (*dtos.CreateUserResponse, error)
+	// IssueEnrollmentLink replaces the link of a provisioned user who hasn't enrolled yet.
+	IssueEnrollmentLink(ctx context.Context, dto dtos.IssueEnrollmentLinkRequest) (*dtos.IssueEnrollmentLinkResponse, error)
+}
+
+// auditEventsLimit is the number of events returned by ListAuditEvents.
+const auditEventsLimit = 100
+
+type admin struct {
+	ur          repository.User
+	clients     repository.OAuthClient
+	audit       repository.Audit
+	enrollments *EnrollmentLinks
+}
+
+func NewAdmin(ur repository.User, clients repository.OAuthClient, audit repository.Audit, enrollments *EnrollmentLinks) Admin {
+	return &admin{ur, clients, audit, enrollments}
+}
+
+func (a *admin) ListCredentials(ctx context.Context, dto dtos.ListCredentialsRequest) (*dtos.ListCredentialsResponse, error) {
+	user, err := a.ur.FindById(ctx, dto.UserID)
+	if err != nil {
+		logger.Error(ctx, "can't get user", logger.WithError(err))
+		return nil, err
+	}
+	if user == nil {
+		return nil, dtos.ErrUserNotFound
+	}
+
+	credentials, err := a.ur.ListCredentials(ctx, user.ID)
+	if err != nil {
+		logger.Error(ctx, "can't list credentials", logger.WithError(err))
+		return nil, err
+	}
+
+	return &dtos.ListCredentialsResponse{Credentials: credentials}, nil
+}
+
+func (a *admin) ClearQuarantine(ctx context.Context, dto dtos.ClearQuarantineRequest) error {
+	credential, err := a.ur.FindCredential(ctx, dto.UserID, dto.ID)
+	if err != nil {
+		logger.Error(ctx, "can't get credential", logger.WithError(err))
+		return err
+	}
+	if credential == nil {
+		return dtos.ErrCredentialNotFound
+	}
+
+	if err := a.ur.ClearQuarantine(ctx, credential.UserID, credential.ID); err != nil {
+		logger.Error(ctx, "can't clear quarantine", logger.WithError(err))
+		return err
+	}
+
+	logger.Info(ctx, "Cleared credential quarantine", "user_id", credential.UserID, "credential_id", credential.ID)
+	return nil
+}
+
+// ListAuditEvents returns the latest audit events of a user, also after the account was deleted.
+func (a *admin) ListAuditEvents(ctx context.Context, dto dtos.ListAuditEventsRequest) (*dtos.ListAuditEventsResponse, error) {
+	events, err := a.audit.ListByUserID(ctx, dto.UserID, auditEventsLimit)
+	if err != nil {
+		logger.Error(ctx, "can't list audit events", logger.WithError(err))
+		return nil, err
+	}
+	return &dtos.ListAuditEventsResponse{Events: events}, nil
+}
+
+func (a *admin) CreateUser(ctx context.Context, dto dtos.CreateUserRequest) (*dtos.CreateUserResponse, error) {
+	username := strings.TrimSpace(dto.Username)
+	if username == "" {
+		return nil, dtos.ErrInvalidUser
+	}
+	displayName := strings.TrimSpace(dto.DisplayName)
+	if displayName == "" {
+		displayName = username
+	}
+
+	exists, err := a.ur.ExistsByUsername(ctx, username)
+	if err != nil {
+		logger.Error(ctx, "can't get user", logger.WithError(err))
+		return nil, err
+	}
+	if exists {
+		return nil, dtos.ErrUserExists
+	}
+
+	// メールアドレスは任意 (登録後に確認メールを送る)
+	var email string
+	if dto.Email != "" {
+		normalized, ok := model.NormalizeEmail(dto.Email)
+		if !ok {
+			return nil, dtos.ErrInvalidUser
+		}
+		owner, err := a.ur.FindByEmail(ctx, normalized)
+		if err != nil {
+			logger.Error(ctx, "can't get user", logger.WithError(err))
+			return nil, err
+		}
+		if owner != nil {
+			return nil, dtos.ErrEmailExists
+		}
+		email = normalized
+	}
+
+	user := &model.User{
+		Name:        username,
+		DisplayName: displayName,
+		Email:       email,
+	}
+	if err := user.GenerateID(); err != nil {
+		return nil, err
+	}
+	if err := a.ur.Create(ctx, user); err != nil {
+		logger.Error(ctx, "can't create user", logger.WithError(err))
+		return nil, err
+	}
+
+	link, token, err := a.enrollments.Issue(ctx, user.ID, dto.IP, dto.UserAgent)
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Info(ctx, "Provisioned user", "user_id", user.ID)
+	return &dtos.CreateUserResponse{User: user, EnrollmentURL: link, ExpiresAt: token.ExpiresAt}, nil
+}
+
+func (a *admin) IssueEnrollmentLink(ctx context.Context, dto dtos.IssueEnrollmentLinkRequest) (*dtos.IssueEnrollmentLinkResponse, error) {
+	user, err := a.ur.FindById(ctx, dto.UserID)
+	if err != nil {
+		logger.Error(ctx, "can't get user", logger.WithError(err))
+		return nil, err
+	}
+	if user == nil {
+		return nil, dtos.ErrUserNotFound
+	}
+	if len(user.Credentials) > 0 {
+		return nil, dtos.ErrUserEnrolled
+	}
+
+	link, token, err := a.enrollments.Issue(ctx, user.ID, dto.IP, dto.UserAgent)
+	if err != nil {
+		return nil, err
+	}
+	return &dtos.IssueEnrollmentLinkResponse{EnrollmentURL: link, ExpiresAt: token.ExpiresAt}, nil
+}
+
+// RegisterClient registers an OpenID Connect client.
+func (a *admin) RegisterClient(ctx context.Context, dto dtos.RegisterClientRequest) (*dtos.RegisterClientResponse, error) {
+	name := strings.TrimSpace(dto.Name)
+	if name == "" {
+		return nil, dtos.ErrInvalidClient
+	}
+	// リソースサーバーはユーザーをサインインさせないので、リダイレクト URI を持たずシークレットで認証する
+	if dto.ResourceServer {
+		if dto.Public || len(dto.RedirectURIs) > 0 {
+			return nil, dtos.ErrInvalidClient
+		}
+	} else if len(dto.RedirectURIs) == 0 {
+		return nil, dtos.ErrInvalidClient
+	}
+	for _, uri := range dto.RedirectURIs {
+		if !validRedirectURI(uri) {
+			logger.Info(ctx, "invalid redirect uri", "redirect_uri", uri)
+			return nil, dtos.ErrInvalidClient
+		}
+	}
+
+	id, err := random.Token(16)
+	if err != nil {
+		return nil, err
+	}
+	client := &model.OAuthClient{
+		ID:             id,
+		Name:           name,
+		RedirectURIs:   append([]string{}, dto.RedirectURIs...),
+		ResourceServer: dto.ResourceServer,
+	}
+
+	var secret string
+	if !dto.Public {
+		secret, err = random.Token(32)
+		if err != nil {
+			return nil, err
+		}
+		client.SecretHash = model.HashClientSecret(secret)
+	}
+
+	if err := a.clients.Create(ctx, client); err != nil {
+		logger.Error(ctx, "can't create client", logger.WithError(err))
+		return nil, err
+	}
+
+	logger.Info(ctx, "Registered client", "client_id", client.ID, "public", client.Public(), "resource_server", client.ResourceServer)
+	return &dtos.RegisterClientResponse{Client: client, Secret: secret}, nil
+}
+
+// validRedirectURI accepts absolute https URIs without a fragment, and http for localhost.
+func validRedirectURI(uri string) bool {
+	u, err := url.Parse(uri)
+	if err != nil || u.Host == "" || u.Fragment != "" {
+		return false
+	}
+	switch u.Scheme {
+	case "https":
+		return true
+	case "http":
+		return u.Hostname() == "localhost" || u.Hostname() == "127.0.0.1"
+	default:
+		return false
+	}
+}
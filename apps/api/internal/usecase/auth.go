@@ -3,6 +3,7 @@ package usecase
 import (
 	"context"
 	"fmt"
+	"net/http"
 
 	"github.com/go-webauthn/webauthn/protocol"
 	"github.com/go-webauthn/webauthn/webauthn"
@@ -14,26 +15,49 @@ import (
 
 type Auth interface {
 	BeginRegistration(ctx context.Context, dto dtos.BeginRegistrationRequest) (*dtos.BeginRegistrationResponse, error)
-	FinishRegistration(ctx context.Context, dto dtos.FinishRegistrationRequest) error
+	FinishRegistration(ctx context.Context, dto dtos.FinishRegistrationRequest) (*dtos.FinishRegistrationResponse, error)
 	BeginLogin(ctx context.Context, dto dtos.BeginLoginRequest) (*dtos.BeginLoginResponse, error)
-	FinishLogin(ctx context.Context, dto dtos.FinishLoginRequest) error
+	FinishLogin(ctx context.Context, dto dtos.FinishLoginRequest) (*dtos.FinishLoginResponse, error)
+	// BeginReauth and FinishReauth refresh the authentication time of the current session
+	// with a user-verified assertion of one of the user's own credentials.
+	BeginReauth(ctx context.Context, dto dtos.BeginReauthRequest) (*dtos.BeginReauthResponse, error)
+	FinishReauth(ctx context.Context, dto dtos.FinishReauthRequest) (*dtos.FinishReauthResponse, error)
 }
 
 type auth struct {
-	sr       repository.Session
-	ur       repository.User
-	webAuthn *webauthn.WebAuthn
+	sr          repository.Session
+	cr          repository.Ceremony
+	ur          repository.User
+	tr          repository.TOTP
+	webAuthn    *webauthn.WebAuthn
+	clonePolicy model.ClonePolicy
+	tokens      *TokenIssuer
+	recovery    *RecoveryCodeIssuer
+	emails      *EmailVerifier
+	enrollments *EnrollmentLinks
 }
 
-func NewAuth(sr repository.Session, ur repository.User, webAuthn *webauthn.WebAuthn) Auth {
+func NewAuth(sr repository.Session, cr repository.Ceremony, ur repository.User, tr repository.TOTP, webAuthn *webauthn.WebAuthn, clonePolicy model.ClonePolicy, tokens *TokenIssuer, recovery *RecoveryCodeIssuer, emails *EmailVerifier, enrollments *EnrollmentLinks) Auth {
 	return &auth{
-		sr:       sr,
-		ur:       ur,
-		webAuthn: webAuthn,
+		sr:          sr,
+		cr:          cr,
+		ur:          ur,
+		tr:          tr,
+		webAuthn:    webAuthn,
+		clonePolicy: clonePolicy,
+		tokens:      tokens,
+		recovery:    recovery,
+		emails:      emails,
+		enrollments: enrollments,
 	}
 }
 
 func (a *auth) BeginRegistration(ctx context.Context, dto dtos.BeginRegistrationRequest) (*dtos.BeginRegistrationResponse, error) {
+	// 管理者が作成したユーザーは登録リンクから登録する
+	if dto.EnrollmentToken != "" {
+		return a.beginEnrollment(ctx, dto.EnrollmentToken)
+	}
+
 	// ユーザー確認
 	exists, err := a.ur.ExistsByUsername(ctx, dto.Username)
 	if err != nil {
@@ -45,6 +69,24 @@ func (a *auth) BeginRegistration(ctx context.Context, dto dtos.BeginRegistration
 		return nil, dtos.ErrUserExists
 	}
 
+	// メールアドレスは任意
+	var email string
+	if dto.Email != "" {
+		normalized, ok := model.NormalizeEmail(dto.Email)
+		if !ok {
+			return nil, dtos.ErrInvalidEmail
+		}
+		owner, err := a.ur.FindByEmail(ctx, normalized)
+		if err != nil {
+			logger.Error(ctx, "can't get user", logger.WithError(err))
+			return nil, err
+		}
+		if owner != nil {
+			return nil, dtos.ErrEmailExists
+		}
+		email = normalized
+	}
+
 	// ユーザ作成
 	var user model.User
 	if err = user.GenerateID(); err != nil {
@@ -53,9 +95,41 @@ func (a *auth) BeginRegistration(ctx context.Context, dto dtos.BeginRegistration
 	}
 	user.Name = dto.Username
 	user.DisplayName = dto.Username
+	user.Email = email
+
+	return a.beginRegistration(ctx, &user, "")
+}
+
+// beginEnrollment starts the registration of the first passkey of a provisioned user.
+func (a *auth) beginEnrollment(ctx context.Context, raw string) (*dtos.BeginRegistrationResponse, error) {
+	enrollment, err := a.enrollments.Find(ctx, raw)
+	if err != nil {
+		return nil, err
+	}
+	if enrollment == nil {
+		logger.Info(ctx, "enrollment token not found")
+		return nil, dtos.ErrEnrollmentNotFound
+	}
 
+	user, err := a.ur.FindById(ctx, enrollment.UserID)
+	if err != nil {
+		logger.Error(ctx, "can't get user", logger.WithError(err))
+		return nil, err
+	}
+	if user == nil {
+		return nil, dtos.ErrEnrollmentNotFound
+	}
+	if len(user.Credentials) > 0 {
+		logger.Info(ctx, "user already has credentials", "user_id", user.ID)
+		return nil, dtos.ErrUserExists
+	}
+
+	return a.beginRegistration(ctx, user, enrollment.ID)
+}
+
+func (a *auth) beginRegistration(ctx context.Context, user *model.User, enrollmentID string) (*dtos.BeginRegistrationResponse, error) {
 	// チャレンジ生成
-	options, sessionData, err := a.webAuthn.BeginMediatedRegistration(&user,
+	options, sessionData, err := a.webAuthn.BeginMediatedRegistration(user,
 		protocol.MediationDefault,
 		webauthn.WithResidentKeyRequirement(protocol.ResidentKeyRequirementRequired),
 		webauthn.WithExclusions(webauthn.Credentials(user.WebAuthnCredentials()).CredentialDescriptors()),
@@ -65,70 +139,223 @@ func (a *auth) BeginRegistration(ctx context.Context, dto dtos.BeginRegistration
 		return nil, err
 	}
 
-	// セッション作成
-	session, err := a.sr.Create(ctx, user.ID)
+	// セレモニー作成
+	ceremony, err := a.cr.Create(ctx)
 	if err != nil {
-		logger.Error(ctx, "Failed to create session", logger.WithError(err))
+		logger.Error(ctx, "Failed to create ceremony", logger.WithError(err))
 		return nil, err
 	}
 
-	session.Username = dto.Username
-	session.RegistrationData = sessionData
+	ceremony.UserID = user.ID
+	ceremony.Username = user.Name
+	ceremony.Email = user.Email
+	ceremony.EnrollmentID = enrollmentID
+	ceremony.RegistrationData = sessionData
 
 	// Store に保存
-	err = a.sr.Save(ctx, session)
+	err = a.cr.Save(ctx, ceremony)
 	if err != nil {
 		logger.Error(ctx, "Failed to store challenge", logger.WithError(err))
 		return nil, err
 	}
-	return &dtos.BeginRegistrationResponse{Cred: options, Session: session}, nil
+	return &dtos.BeginRegistrationResponse{Cred: options, Ceremony: ceremony}, nil
 }
 
-func (a *auth) FinishRegistration(ctx context.Context, dto dtos.FinishRegistrationRequest) error {
-	session, err := a.sr.Get(ctx, dto.Session)
+func (a *auth) FinishRegistration(ctx context.Context, dto dtos.FinishRegistrationRequest) (*dtos.FinishRegistrationResponse, error) {
+	ceremony, err := a.cr.Consume(ctx, dto.Ceremony)
 	if err != nil {
-		logger.Error(ctx, "can't get session", logger.WithError(err))
-		return err
+		logger.Error(ctx, "can't get ceremony", logger.WithError(err))
+		return nil, err
 	}
-	if session == nil || session.RegistrationData == nil {
-		logger.Info(ctx, "session is nil")
-		return dtos.ErrSessionNotFound
+	if ceremony == nil || ceremony.RegistrationData == nil {
+		logger.Info(ctx, "ceremony is nil")
+		return nil, dtos.ErrSessionNotFound
 	}
 
+	var user *model.User
+	if ceremony.EnrollmentID != "" {
+		user, err = a.finishEnrollment(ctx, ceremony, dto)
+	} else {
+		user, err = a.finishRegistration(ctx, ceremony, dto)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	codes, err := a.recovery.Issue(ctx, user.ID, dto.IP, dto.UserAgent)
+	if err != nil {
+		return nil, err
+	}
+	// 登録時のアドレスは確認されるまで使われない
+	if user.Email != "" && !user.EmailVerified {
+		if err := a.emails.Send(ctx, user, user.Email, dto.IP, dto.UserAgent); err != nil {
+			return nil, err
+		}
+	}
+
+	return &dtos.FinishRegistrationResponse{RecoveryCodes: codes}, nil
+}
+
+// finishRegistration creates the user with their first passkey.
+func (a *auth) finishRegistration(ctx context.Context, ceremony *model.Ceremony, dto dtos.FinishRegistrationRequest) (*model.User, error) {
 	// ユーザー確認
-	exists, err := a.ur.ExistsByUsername(ctx, session.Username)
+	exists, err := a.ur.ExistsByUsername(ctx, ceremony.Username)
 	if err != nil {
 		logger.Error(ctx, "can't get user", logger.WithError(err))
-		return err
+		return nil, err
 	}
 	if exists {
-		logger.Info(ctx, fmt.Sprintf("Exists User name: %s", session.Username))
-		return dtos.ErrUserExists
+		logger.Info(ctx, fmt.Sprintf("Exists User name: %s", ceremony.Username))
+		return nil, dtos.ErrUserExists
 	}
 
 	var user model.User
-	user.ID = dto.Session
-	user.Name = session.Username
-	user.DisplayName = session.Username
+	user.ID = ceremony.UserID
+	user.Name = ceremony.Username
+	user.DisplayName = ceremony.Username
+	user.Email = ceremony.Email
+
+	credential, err := a.webAuthn.FinishRegistration(&user, *ceremony.RegistrationData, dto.Request)
+	if err != nil {
+		logger.Error(ctx, "can't finish registration", logger.WithError(err))
+		return nil, dtos.ErrFinishRegistration
+	}
+
+	user.AddCredential(*credential)
+	if err := a.ur.Create(ctx, &user); err != nil {
+		logger.Error(ctx, "can't create user", logger.WithError(err))
+		return nil, err
+	}
+	return &user, nil
+}
+
+// finishEnrollment adds the first passkey to a provisioned user and spends the enrollment link.
+func (a *auth) finishEnrollment(ctx context.Context, ceremony *model.Ceremony, dto dtos.FinishRegistrationRequest) (*model.User, error) {
+	user, err := a.ur.FindById(ctx, ceremony.UserID)
+	if err != nil {
+		logger.Error(ctx, "can't get user", logger.WithError(err))
+		return nil, err
+	}
+	if user == nil {
+		return nil, dtos.ErrEnrollmentNotFound
+	}
+	if len(user.Credentials) > 0 {
+		logger.Info(ctx, "user already has credentials", "user_id", user.ID)
+		return nil, dtos.ErrUserExists
+	}
 
-	credential, err := a.webAuthn.FinishRegistration(&user, *session.RegistrationData, dto.Request)
+	credential, err := a.webAuthn.FinishRegistration(user, *ceremony.RegistrationData, dto.Request)
 	if err != nil {
 		logger.Error(ctx, "can't finish registration", logger.WithError(err))
-		return dtos.ErrFinishRegistration
+		return nil, dtos.ErrFinishRegistration
 	}
 
+	// リンクはパスキーを保存してから使用済みにする。保存に失敗してもリンクは残る
+	if err := a.ur.AddCredential(ctx, user.ID, credential); err != nil {
+		logger.Error(ctx, "can't add credential", logger.WithError(err))
+		return nil, err
+	}
+
+	// リンクは一度だけ使える。同時に使われた場合は後の方のパスキーを取り消す
+	ok, err := a.enrollments.Use(ctx, ceremony.EnrollmentID, user.ID, dto.IP, dto.UserAgent)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		logger.Info(ctx, "enrollment token already used or expired", "user_id", user.ID)
+		if err := a.removeCredential(ctx, user.ID, credential); err != nil {
+			return nil, err
+		}
+		return nil, dtos.ErrEnrollmentNotFound
+	}
 	user.AddCredential(*credential)
-	a.ur.Create(ctx, &user)
-	// Delete the session data
-	a.sr.Delete(ctx, session)
 
+	logger.Info(ctx, "Enrolled provisioned user", "user_id", user.ID)
+	return user, nil
+}
+
+// removeCredential deletes a credential that was stored before the registration failed.
+func (a *auth) removeCredential(ctx context.Context, userID string, credential *webauthn.Credential) error {
+	stored, err := a.ur.FindCredentialByCredentialID(ctx, userID, credential.ID)
+	if err != nil {
+		logger.Error(ctx, "can't get credential", logger.WithError(err))
+		return err
+	}
+	if stored == nil {
+		return nil
+	}
+	if err := a.ur.DeleteCredential(ctx, userID, stored.ID); err != nil {
+		logger.Error(ctx, "can't delete credential", logger.WithError(err))
+		return err
+	}
 	return nil
 }
 
 func (a *auth) BeginLogin(ctx context.Context, dto dtos.BeginLoginRequest) (*dtos.BeginLoginResponse, error) {
 
-	// ユーザー確認
-	user, err := a.ur.FindByUsername(ctx, dto.Username)
+	// セレモニー確認
+	ceremony, err := a.cr.Get(ctx, dto.Ceremony)
+	if err != nil {
+		logger.Error(ctx, "can't get ceremony", logger.WithError(err))
+		return nil, err
+	}
+	if ceremony != nil && ceremony.StepUpUserID != "" {
+		return a.beginStepUpLogin(ctx, ceremony)
+	}
+
+	// ユーザー名もメールアドレスもなければ Conditional UI (autofill) で開始し、ユーザーは userHandle から解決する
+	mediation := protocol.MediationConditional
+	var username string
+	if dto.Username != "" || dto.Email != "" {
+		user, err := a.findLoginUser(ctx, dto)
+		if err != nil {
+			return nil, err
+		}
+		logger.Info(ctx, fmt.Sprintf("user credential: %v", len(user.Credentials)))
+		username = user.Name
+		mediation = protocol.MediationDefault
+	}
+
+	// webauthn
+	options, sessionData, err := a.webAuthn.BeginDiscoverableMediatedLogin(mediation)
+	if err != nil {
+		logger.Error(ctx, "can't begin login", logger.WithError(err))
+		return nil, err
+	}
+
+	ceremony, err = a.cr.Create(ctx)
+	if err != nil {
+		logger.Error(ctx, "can't create ceremony", logger.WithError(err))
+		return nil, err
+	}
+
+	ceremony.Username = username
+	ceremony.AuthenticationData = sessionData
+
+	if err := a.cr.Save(ctx, ceremony); err != nil {
+		logger.Error(ctx, "can't save ceremony", logger.WithError(err))
+		return nil, err
+	}
+
+	return &dtos.BeginLoginResponse{
+		Cred:     options,
+		Ceremony: ceremony,
+	}, nil
+}
+
+// findLoginUser finds the user by username, or else by verified email address.
+func (a *auth) findLoginUser(ctx context.Context, dto dtos.BeginLoginRequest) (*model.User, error) {
+	var user *model.User
+	var err error
+	if dto.Username != "" {
+		user, err = a.ur.FindByUsername(ctx, dto.Username)
+	} else {
+		email, ok := model.NormalizeEmail(dto.Email)
+		if !ok {
+			return nil, dtos.ErrUserNotFound
+		}
+		user, err = a.ur.FindByEmail(ctx, email)
+	}
 	if err != nil {
 		logger.Error(ctx, "can't get user", logger.WithError(err))
 		return nil, err
@@ -137,88 +364,314 @@ func (a *auth) BeginLogin(ctx context.Context, dto dtos.BeginLoginRequest) (*dto
 		logger.Error(ctx, "user not found")
 		return nil, dtos.ErrUserNotFound
 	}
-	logger.Info(ctx, fmt.Sprintf("user credential: %v", len(user.Credentials)))
+	return user, nil
+}
 
-	// webauthn
-	options, sessionData, err := a.webAuthn.BeginDiscoverableMediatedLogin(protocol.MediationDefault)
+// beginStepUpLogin starts a login restricted to the credentials left after a clone warning.
+func (a *auth) beginStepUpLogin(ctx context.Context, ceremony *model.Ceremony) (*dtos.BeginLoginResponse, error) {
+	user, err := a.ur.FindById(ctx, ceremony.StepUpUserID)
+	if err != nil {
+		logger.Error(ctx, "can't get user", logger.WithError(err))
+		return nil, err
+	}
+	if user == nil || len(user.Credentials) == 0 {
+		logger.Info(ctx, "no credential left for step-up")
+		return nil, dtos.ErrCloneDetected
+	}
+
+	options, sessionData, err := a.webAuthn.BeginLogin(user)
 	if err != nil {
 		logger.Error(ctx, "can't begin login", logger.WithError(err))
 		return nil, err
 	}
 
-	// Session確認
-	session, err := a.sr.Get(ctx, dto.Session)
+	ceremony.AuthenticationData = sessionData
+	if err := a.cr.Save(ctx, ceremony); err != nil {
+		logger.Error(ctx, "can't save ceremony", logger.WithError(err))
+		return nil, err
+	}
+
+	return &dtos.BeginLoginResponse{
+		Cred:     options,
+		Ceremony: ceremony,
+	}, nil
+}
+
+func (a *auth) FinishLogin(ctx context.Context, dto dtos.FinishLoginRequest) (*dtos.FinishLoginResponse, error) {
+
+	// セレモニー確認 (同時に完了しても一度だけ使える)
+	ceremony, err := a.cr.Consume(ctx, dto.Ceremony)
 	if err != nil {
-		logger.Error(ctx, "can't get session", logger.WithError(err))
+		logger.Error(ctx, "can't get ceremony", logger.WithError(err))
 		return nil, err
 	}
-	if session == nil {
-		session, err = a.sr.Create(ctx, user.ID)
+	if ceremony == nil || ceremony.AuthenticationData == nil {
+		logger.Error(ctx, "usecase: ceremony not found")
+		return nil, dtos.ErrSessionNotFound
+	}
+
+	user, validatedCredential, err := a.finishAssertion(ctx, ceremony, dto.Request)
+	if err != nil {
+		return nil, err
+	}
+
+	err = user.ValidateCredential(validatedCredential)
+	if err != nil {
+		logger.Info(ctx, "can't update credential", logger.WithError(err))
+		return nil, dtos.ErrAssertionFailed
+	}
+
+	// サインカウントはポリシーがログインを許可した後にだけ保存する
+	if validatedCredential.Authenticator.CloneWarning {
+		if err := a.handleCloneWarning(ctx, ceremony, user, validatedCredential); err != nil {
+			return nil, err
+		}
+	}
+	user.UpdateCredential(validatedCredential)
+	if err := a.ur.UpdateCredential(ctx, user.ID, validatedCredential); err != nil {
+		logger.Error(ctx, "can't save credential", logger.WithError(err))
+		return nil, err
+	}
+
+	// success: 以前のセッションを破棄し、新しい ID のセッションを発行する
+	if err := a.discardSession(ctx, dto.Session); err != nil {
+		return nil, err
+	}
+
+	credential, err := a.ur.FindCredentialByCredentialID(ctx, user.ID, validatedCredential.ID)
+	if err != nil {
+		logger.Error(ctx, "can't get credential", logger.WithError(err))
+		return nil, err
+	}
+	info := model.SessionInfo{
+		UserVerified: validatedCredential.Flags.UserVerified,
+		AMR:          model.AMR(validatedCredential.Flags.BackupEligible),
+		IP:           dto.IP,
+		UserAgent:    dto.UserAgent,
+	}
+	if credential != nil {
+		info.CredentialID = credential.ID
+	}
+	info.SecondFactorRequired, err = requiresSecondFactor(ctx, a.tr, user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	session, err := a.sr.Create(ctx, user, info)
+	if err != nil {
+		logger.Error(ctx, "can't create session", logger.WithError(err))
+		return nil, err
+	}
+
+	res := &dtos.FinishLoginResponse{Session: session}
+	// 二要素目が必要なログインにはトークンを発行しない
+	if dto.IssueTokens && !session.SecondFactorRequired {
+		res.Tokens, err = a.tokens.Issue(ctx, session)
 		if err != nil {
-			logger.Error(ctx, "can't create session", logger.WithError(err))
 			return nil, err
 		}
 	}
 
-	session.Username = dto.Username
-	session.AuthenticationData = sessionData
+	return res, nil
+}
+
+func (a *auth) BeginReauth(ctx context.Context, dto dtos.BeginReauthRequest) (*dtos.BeginReauthResponse, error) {
+	user := dto.User
 
-	if err := a.sr.Save(ctx, session); err != nil {
-		logger.Error(ctx, "can't save session", logger.WithError(err))
+	// ログイン中のユーザーのクレデンシャルだけを許可する
+	options, sessionData, err := a.webAuthn.BeginLogin(user,
+		webauthn.WithUserVerification(protocol.VerificationRequired))
+	if err != nil {
+		logger.Error(ctx, "can't begin login", logger.WithError(err))
 		return nil, err
 	}
 
-	return &dtos.BeginLoginResponse{
-		Cred:    options,
-		Session: session,
-	}, nil
+	ceremony, err := a.cr.Create(ctx)
+	if err != nil {
+		logger.Error(ctx, "can't create ceremony", logger.WithError(err))
+		return nil, err
+	}
+	ceremony.UserID = user.ID
+	ceremony.AuthenticationData = sessionData
+	if err := a.cr.Save(ctx, ceremony); err != nil {
+		logger.Error(ctx, "can't save ceremony", logger.WithError(err))
+		return nil, err
+	}
+
+	return &dtos.BeginReauthResponse{Cred: options, Ceremony: ceremony}, nil
 }
 
-func (a *auth) FinishLogin(ctx context.Context, dto dtos.FinishLoginRequest) error {
+func (a *auth) FinishReauth(ctx context.Context, dto dtos.FinishReauthRequest) (*dtos.FinishReauthResponse, error) {
+	user := dto.User
+	session := dto.Session
 
-	// Session確認
-	session, err := a.sr.Get(ctx, dto.Session)
+	ceremony, err := a.cr.Consume(ctx, dto.Ceremony)
+	if err != nil {
+		logger.Error(ctx, "can't get ceremony", logger.WithError(err))
+		return nil, err
+	}
+	if ceremony == nil || ceremony.AuthenticationData == nil || ceremony.UserID != user.ID {
+		logger.Info(ctx, "authentication data is nil")
+		return nil, dtos.ErrSessionNotFound
+	}
+
+	validatedCredential, err := a.webAuthn.FinishLogin(user, *ceremony.AuthenticationData, dto.Request)
+	if err != nil {
+		logger.Info(ctx, "can't finish re-authentication", logger.WithError(err))
+		return nil, dtos.ErrReauthFailed
+	}
+
+	if validatedCredential.Authenticator.CloneWarning {
+		if err := rejectClone(ctx, a.ur, user.ID, validatedCredential); err != nil {
+			return nil, err
+		}
+		return nil, dtos.ErrCloneDetected
+	}
+	user.UpdateCredential(validatedCredential)
+	if err := a.ur.UpdateCredential(ctx, user.ID, validatedCredential); err != nil {
+		logger.Error(ctx, "can't save credential", logger.WithError(err))
+		return nil, err
+	}
+
+	credential, err := a.ur.FindCredentialByCredentialID(ctx, user.ID, validatedCredential.ID)
+	if err != nil {
+		logger.Error(ctx, "can't get credential", logger.WithError(err))
+		return nil, err
+	}
+
+	// 新しい認証時刻のセッションは ID を変えて発行し直す
+	info := session.Info()
+	info.UserVerified = validatedCredential.Flags.UserVerified
+	info.AMR = model.AMR(validatedCredential.Flags.BackupEligible)
+	if credential != nil {
+		info.CredentialID = credential.ID
+	}
+	rotated, err := rotateSession(ctx, a.sr, user, session, info)
+	if err != nil {
+		return nil, err
+	}
+	if err := a.tokens.MoveSession(ctx, session, rotated); err != nil {
+		return nil, err
+	}
+
+	logger.Info(ctx, "Re-authenticated session", "user_id", user.ID)
+	return &dtos.FinishReauthResponse{Session: rotated}, nil
+}
+
+// rejectClone records a clone warning in ceremonies that don't offer step-up.
+// They reject the assertion afterwards; the credential stays usable.
+func rejectClone(ctx context.Context, ur repository.User, userID string, credential *webauthn.Credential) error {
+	logger.Warn(ctx, "clone warning on a signed-in user", "user_id", userID)
+	if err := ur.RecordCloneEvent(ctx, userID, credential, model.ClonePolicyReject); err != nil {
+		logger.Error(ctx, "can't record clone event", logger.WithError(err))
+		return err
+	}
+	return nil
+}
+
+// discardSession deletes the session the client held before a new one is issued.
+func (a *auth) discardSession(ctx context.Context, id string) error {
+	session, err := a.sr.Get(ctx, id)
 	if err != nil {
 		logger.Error(ctx, "can't get session", logger.WithError(err))
 		return err
 	}
-	if session == nil || session.AuthenticationData == nil {
-		logger.Error(ctx, "usecase: session not found")
-		return dtos.ErrSessionNotFound
+	if session == nil {
+		return nil
+	}
+	if err := a.sr.Delete(ctx, session); err != nil {
+		logger.Error(ctx, "can't delete session", logger.WithError(err))
+		return err
 	}
+	return nil
+}
 
+// finishAssertion verifies the assertion against the user the ceremony was started for.
+// A rejected assertion or an unknown user is ErrAssertionFailed; database errors are returned as is.
+func (a *auth) finishAssertion(ctx context.Context, ceremony *model.Ceremony, r *http.Request) (*model.User, *webauthn.Credential, error) {
+	if ceremony.StepUpUserID != "" {
+		user, err := a.ur.FindById(ctx, ceremony.StepUpUserID)
+		if err != nil {
+			logger.Error(ctx, "can't get user", logger.WithError(err))
+			return nil, nil, err
+		}
+		if user == nil {
+			logger.Info(ctx, "step-up user not found")
+			return nil, nil, dtos.ErrAssertionFailed
+		}
+		credential, err := a.webAuthn.FinishLogin(user, *ceremony.AuthenticationData, r)
+		if err != nil {
+			logger.Info(ctx, "can't finish login", logger.WithError(err))
+			return nil, nil, dtos.ErrAssertionFailed
+		}
+		return user, credential, nil
+	}
+
+	// ユーザーの検索に失敗した DB エラーは検証の失敗と区別する
+	var lookupErr error
 	validatedUser, validatedCredential, err := a.webAuthn.FinishPasskeyLogin(
 		func(rawID []byte, userHandle []byte) (webauthn.User, error) {
 			user, err := a.ur.FindById(ctx, string(userHandle))
-			return user, err
+			if err != nil {
+				lookupErr = err
+				return nil, err
+			}
+			if user == nil {
+				return nil, dtos.ErrUserNotFound
+			}
+			return user, nil
 		},
-		*session.AuthenticationData, dto.Request)
+		*ceremony.AuthenticationData, r)
+	if lookupErr != nil {
+		logger.Error(ctx, "can't get user", logger.WithError(lookupErr))
+		return nil, nil, lookupErr
+	}
 	if err != nil {
-		logger.Error(ctx, "can't finish login", logger.WithError(err))
-		return err
+		logger.Info(ctx, "can't finish login", logger.WithError(err))
+		return nil, nil, dtos.ErrAssertionFailed
 	}
 
 	user, ok := validatedUser.(*model.User)
 	if !ok {
 		logger.Error(ctx, "can't convert validatedUser to User")
-		return dtos.ErrUserNotFound
+		return nil, nil, dtos.ErrAssertionFailed
 	}
+	return user, validatedCredential, nil
+}
 
-	err = user.ValidateCredential(validatedCredential)
-	if err != nil {
-		logger.Error(ctx, "can't update credential", logger.WithError(err))
+// handleCloneWarning records a clone event and applies the configured policy.
+// A nil error means the login may continue.
+func (a *auth) handleCloneWarning(ctx context.Context, ceremony *model.Ceremony, user *model.User, credential *webauthn.Credential) error {
+	logger.Warn(ctx, fmt.Sprintf("clone warning: user %s, policy %s", user.ID, a.clonePolicy))
+
+	if err := a.ur.RecordCloneEvent(ctx, user.ID, credential, a.clonePolicy); err != nil {
+		logger.Error(ctx, "can't record clone event", logger.WithError(err))
 		return err
 	}
-	user.UpdateCredential(validatedCredential)
 
-	// success
-	session.Authenticated = true
-	session.AuthenticationData = nil
+	switch a.clonePolicy {
+	case model.ClonePolicyFlag:
+		return nil
+	case model.ClonePolicyReject:
+		// このアサーションだけを拒否する
+		return dtos.ErrCloneDetected
+	}
 
-	if err := a.sr.Save(ctx, session); err != nil {
-		logger.Error(ctx, "can't save session", logger.WithError(err))
+	if err := a.ur.QuarantineCredential(ctx, user.ID, credential.ID); err != nil {
+		logger.Error(ctx, "can't quarantine credential", logger.WithError(err))
 		return err
 	}
 
-	return nil
+	// ステップアップ中の二度目の警告も拒否する
+	if ceremony.StepUpUserID != "" {
+		return dtos.ErrCloneDetected
+	}
+
+	ceremony.StepUpUserID = user.ID
+	ceremony.AuthenticationData = nil
+	if err := a.cr.Save(ctx, ceremony); err != nil {
+		logger.Error(ctx, "can't save ceremony", logger.WithError(err))
+		return err
+	}
+	return dtos.ErrStepUpRequired
 }
@@ -0,0 +1,181 @@
+package usecase
+
+import (
+	"context"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/kobayashiyabako16g/passkey-auth-example/internal/domain/model"
+	dtos "github.com/kobayashiyabako16g/passkey-auth-example/internal/usecase/dto/oidc"
+	"github.com/kobayashiyabako16g/passkey-auth-example/pkg/logger"
+)
+
+// slowDownStep is added to the polling interval on every slow_down (RFC 8628 3.5).
+const slowDownStep = 5 * time.Second
+
+// DeviceAuthorization issues a device code and a user code to a device that can't run WebAuthn.
+func (o *oidc) DeviceAuthorization(ctx context.Context, dto dtos.DeviceAuthorizationRequest) (*dtos.DeviceAuthorizationResponse, error) {
+	// CLI やテレビはシークレットを持てないので公開クライアントも受け付ける
+	client, err := o.authenticateClient(ctx, dto.ClientID, dto.ClientSecret, true)
+	if err != nil {
+		return nil, err
+	}
+	if client.ResourceServer {
+		return nil, dtos.ErrUnauthorizedClient
+	}
+
+	now := time.Now()
+	grant := &model.DeviceGrant{
+		ClientID:  client.ID,
+		Scope:     filterScope(strings.Fields(dto.Scope)),
+		Status:    model.DeviceGrantPending,
+		Interval:  o.opts.DevicePollInterval,
+		CreatedAt: now,
+		ExpiresAt: now.Add(o.opts.DeviceCodeTTL),
+	}
+	if err := o.dg.Create(ctx, grant); err != nil {
+		logger.Error(ctx, "can't create device grant", logger.WithError(err))
+		return nil, err
+	}
+
+	userCode := model.FormatUserCode(grant.UserCode)
+	verificationURI, err := url.Parse(o.opts.DeviceVerificationURL)
+	if err != nil {
+		return nil, err
+	}
+	query := verificationURI.Query()
+	query.Set("user_code", userCode)
+	complete := *verificationURI
+	complete.RawQuery = query.Encode()
+
+	logger.Info(ctx, "Issued device code", "client_id", client.ID)
+	return &dtos.DeviceAuthorizationResponse{
+		DeviceCode:              grant.DeviceCode,
+		UserCode:                userCode,
+		VerificationURI:         verificationURI.String(),
+		VerificationURIComplete: complete.String(),
+		ExpiresIn:               int64(o.opts.DeviceCodeTTL.Seconds()),
+		Interval:                int64(grant.Interval.Seconds()),
+	}, nil
+}
+
+// DeviceInfo shows the user which client is asking for access before they approve it.
+func (o *oidc) DeviceInfo(ctx context.Context, dto dtos.DeviceInfoRequest) (*dtos.DeviceInfoResponse, error) {
+	grant, err := o.findPendingDevice(ctx, dto.UserCode)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := o.clients.FindById(ctx, grant.ClientID)
+	if err != nil {
+		logger.Error(ctx, "can't get client", logger.WithError(err))
+		return nil, err
+	}
+	if client == nil {
+		return nil, dtos.ErrDeviceNotFound
+	}
+
+	return &dtos.DeviceInfoResponse{
+		UserCode:   model.FormatUserCode(grant.UserCode),
+		ClientName: client.Name,
+		Scope:      grant.Scope,
+	}, nil
+}
+
+// ApproveDevice lets the signed-in user approve or deny the device.
+// The user must have signed in with a passkey after the device asked for the code.
+func (o *oidc) ApproveDevice(ctx context.Context, dto dtos.ApproveDeviceRequest) error {
+	grant, err := o.findPendingDevice(ctx, dto.UserCode)
+	if err != nil {
+		return err
+	}
+
+	if !dto.Approve {
+		grant.Status = model.DeviceGrantDenied
+	} else {
+		// 古いセッションだけでは承認させない
+		if dto.Session.AuthTime.Before(grant.CreatedAt) {
+			logger.Info(ctx, "session is older than the device grant", "client_id", grant.ClientID)
+			return dtos.ErrLoginRequired
+		}
+		grant.Status = model.DeviceGrantApproved
+		grant.UserID = dto.User.ID
+		grant.AMR = dto.Session.AMR
+		grant.AuthTime = dto.Session.AuthTime
+	}
+	if err := o.dg.Save(ctx, grant); err != nil {
+		logger.Error(ctx, "can't save device grant", logger.WithError(err))
+		return err
+	}
+
+	logger.Info(ctx, "User answered device grant", "client_id", grant.ClientID, "user_id", dto.User.ID, "status", grant.Status)
+	return nil
+}
+
+func (o *oidc) findPendingDevice(ctx context.Context, userCode string) (*model.DeviceGrant, error) {
+	grant, err := o.dg.FindByUserCode(ctx, userCode)
+	if err != nil {
+		logger.Error(ctx, "can't get device grant", logger.WithError(err))
+		return nil, err
+	}
+	if grant == nil || grant.Status != model.DeviceGrantPending {
+		return nil, dtos.ErrDeviceNotFound
+	}
+	return grant, nil
+}
+
+// exchangeDeviceCode answers a poll of the device (RFC 8628 3.4).
+func (o *oidc) exchangeDeviceCode(ctx context.Context, client *model.OAuthClient, dto dtos.TokenRequest) (*tokenGrant, error) {
+	if dto.DeviceCode == "" {
+		return nil, dtos.ErrInvalidRequest
+	}
+
+	grant, err := o.dg.FindByDeviceCode(ctx, dto.DeviceCode)
+	if err != nil {
+		logger.Error(ctx, "can't get device grant", logger.WithError(err))
+		return nil, err
+	}
+	// 期限切れのグラントは kvstore から消えている
+	if grant == nil {
+		return nil, dtos.ErrExpiredToken
+	}
+	if grant.ClientID != client.ID {
+		logger.Info(ctx, "device code belongs to another client", "client_id", client.ID)
+		return nil, dtos.ErrInvalidGrant
+	}
+
+	now := time.Now()
+	if grant.Status == model.DeviceGrantPending {
+		err := dtos.ErrAuthorizationPending
+		if !grant.LastPolledAt.IsZero() && now.Sub(grant.LastPolledAt) < grant.Interval {
+			grant.Interval += slowDownStep
+			err = dtos.ErrSlowDown
+		}
+		grant.LastPolledAt = now
+		if err := o.dg.SavePoll(ctx, grant); err != nil {
+			logger.Error(ctx, "can't save device poll", logger.WithError(err))
+			return nil, err
+		}
+		return nil, err
+	}
+
+	consumed, err := o.dg.Consume(ctx, grant)
+	if err != nil {
+		logger.Error(ctx, "can't consume device grant", logger.WithError(err))
+		return nil, err
+	}
+	if !consumed {
+		return nil, dtos.ErrInvalidGrant
+	}
+	if grant.Status == model.DeviceGrantDenied {
+		return nil, dtos.ErrAccessDenied
+	}
+
+	return &tokenGrant{
+		userID:   grant.UserID,
+		scope:    grant.Scope,
+		amr:      grant.AMR,
+		authTime: grant.AuthTime,
+	}, nil
+}
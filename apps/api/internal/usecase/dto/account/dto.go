@@ -0,0 +1,12 @@
+package account
+
+import "github.com/kobayashiyabako16g/passkey-auth-example/internal/domain/model"
+
+type ChangeUsernameRequest struct {
+	User     *model.User
+	Username string
+}
+
+type DeleteAccountRequest struct {
+	User *model.User
+}
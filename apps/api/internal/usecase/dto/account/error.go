@@ -0,0 +1,8 @@
+package account
+
+import "errors"
+
+var (
+	ErrUserExists      = errors.New("user already exists")
+	ErrInvalidUsername = errors.New("invalid username")
+)
@@ -0,0 +1,72 @@
+package admin
+
+import (
+	"time"
+
+	"github.com/kobayashiyabako16g/passkey-auth-example/internal/domain/model"
+)
+
+type ListCredentialsRequest struct {
+	UserID string
+}
+
+type ListCredentialsResponse struct {
+	Credentials []model.Credential
+}
+
+type ClearQuarantineRequest struct {
+	UserID string
+	ID     string
+}
+
+type RegisterClientRequest struct {
+	Name         string
+	RedirectURIs []string
+	// Public clients can't keep a secret, such as single-page and native apps.
+	Public bool
+	// ResourceServer registers a first-party API that introspects session IDs instead of
+	// a relying party. It has a secret and no redirect URIs.
+	ResourceServer bool
+}
+
+type RegisterClientResponse struct {
+	Client *model.OAuthClient
+	// Secret is only returned here. It's empty for public clients.
+	Secret string
+}
+
+type ListAuditEventsRequest struct {
+	UserID string
+}
+
+type ListAuditEventsResponse struct {
+	Events []model.AuditEvent
+}
+
+type CreateUserRequest struct {
+	Username string
+	// DisplayName defaults to Username.
+	DisplayName string
+	// Email is optional. It's verified once the user has enrolled.
+	Email     string
+	IP        string
+	UserAgent string
+}
+
+type CreateUserResponse struct {
+	User *model.User
+	// EnrollmentURL is only returned here. It works once until ExpiresAt.
+	EnrollmentURL string
+	ExpiresAt     time.Time
+}
+
+type IssueEnrollmentLinkRequest struct {
+	UserID    string
+	IP        string
+	UserAgent string
+}
+
+type IssueEnrollmentLinkResponse struct {
+	EnrollmentURL string
+	ExpiresAt     time.Time
+}
@@ -0,0 +1,13 @@
+package admin
+
+import "errors"
+
+var (
+	ErrUserNotFound       = errors.New("user not found")
+	ErrCredentialNotFound = errors.New("credential not found")
+	ErrInvalidClient      = errors.New("invalid client")
+	ErrInvalidUser        = errors.New("invalid user")
+	ErrUserExists         = errors.New("user already exists")
+	ErrEmailExists        = errors.New("email address already in use")
+	ErrUserEnrolled       = errors.New("user already has a passkey")
+)
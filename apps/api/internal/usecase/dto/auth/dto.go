@@ -5,33 +5,81 @@ import (
 
 	"github.com/go-webauthn/webauthn/protocol"
 	"github.com/kobayashiyabako16g/passkey-auth-example/internal/domain/model"
+	tokendtos "github.com/kobayashiyabako16g/passkey-auth-example/internal/usecase/dto/token"
 )
 
 type BeginRegistrationRequest struct {
 	Username string
+	// Email is optional. It identifies the user once it's verified.
+	Email string
+	// EnrollmentToken registers the user created by an administrator instead of a new one.
+	EnrollmentToken string
 }
 
 type BeginRegistrationResponse struct {
-	Cred    *protocol.CredentialCreation
-	Session *model.Session
+	Cred     *protocol.CredentialCreation
+	Ceremony *model.Ceremony
 }
 
 type FinishRegistrationRequest struct {
-	Session string
-	Request *http.Request
+	Ceremony  string
+	IP        string
+	UserAgent string
+	Request   *http.Request
+}
+
+type FinishRegistrationResponse struct {
+	// RecoveryCodes are shown once so the user can get back in without a passkey.
+	RecoveryCodes []string
 }
 
 type BeginLoginRequest struct {
 	Username string
-	Session  string
+	// Email identifies the user by a verified address when Username is empty.
+	Email    string
+	Ceremony string
 }
 
 type BeginLoginResponse struct {
-	Cred    *protocol.CredentialAssertion
-	Session *model.Session
+	Cred     *protocol.CredentialAssertion
+	Ceremony *model.Ceremony
 }
 
 type FinishLoginRequest struct {
-	Session string
-	Request *http.Request
+	Ceremony string
+	// Session is the session the client held before login. It's discarded.
+	Session   string
+	IP        string
+	UserAgent string
+	// IssueTokens asks for an access token and a refresh token besides the session.
+	IssueTokens bool
+	Request     *http.Request
+}
+
+type FinishLoginResponse struct {
+	// Session waits for a TOTP code when Session.SecondFactorRequired is set.
+	Session *model.Session
+	// Tokens is set when IssueTokens was requested and no second factor is required.
+	Tokens *tokendtos.TokenResponse
+}
+
+type BeginReauthRequest struct {
+	User *model.User
+}
+
+type BeginReauthResponse struct {
+	Cred     *protocol.CredentialAssertion
+	Ceremony *model.Ceremony
+}
+
+type FinishReauthRequest struct {
+	User     *model.User
+	Session  *model.Session
+	Ceremony string
+	Request  *http.Request
+}
+
+type FinishReauthResponse struct {
+	// Session has the new authentication time.
+	Session *model.Session
 }
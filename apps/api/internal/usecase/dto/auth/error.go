@@ -7,4 +7,11 @@ var (
 	ErrUserNotFound       = errors.New("user not found")
 	ErrSessionNotFound    = errors.New("session not found")
 	ErrFinishRegistration = errors.New("registration failed")
+	ErrCloneDetected      = errors.New("cloned authenticator detected")
+	ErrStepUpRequired     = errors.New("login with another credential required")
+	ErrReauthFailed       = errors.New("re-authentication failed")
+	ErrAssertionFailed    = errors.New("passkey assertion failed")
+	ErrInvalidEmail       = errors.New("invalid email address")
+	ErrEmailExists        = errors.New("email address already in use")
+	ErrEnrollmentNotFound = errors.New("enrollment link not found")
 )
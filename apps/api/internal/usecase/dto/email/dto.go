@@ -0,0 +1,41 @@
+package email
+
+import (
+	"net/http"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/kobayashiyabako16g/passkey-auth-example/internal/domain/model"
+)
+
+type BeginChangeRequest struct {
+	User  *model.User
+	Email string
+}
+
+type BeginChangeResponse struct {
+	Cred     *protocol.CredentialAssertion
+	Ceremony *model.Ceremony
+}
+
+type FinishChangeRequest struct {
+	User      *model.User
+	Ceremony  string
+	IP        string
+	UserAgent string
+	Request   *http.Request
+}
+
+type FinishChangeResponse struct {
+	// Email is the address the verification was sent to.
+	Email string
+}
+
+type VerifyRequest struct {
+	Token     string
+	IP        string
+	UserAgent string
+}
+
+type VerifyResponse struct {
+	Email string
+}
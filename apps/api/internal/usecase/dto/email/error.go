@@ -0,0 +1,12 @@
+package email
+
+import "errors"
+
+var (
+	ErrInvalidEmail    = errors.New("invalid email address")
+	ErrEmailExists     = errors.New("email address already in use")
+	ErrSessionNotFound = errors.New("session not found")
+	ErrAssertionFailed = errors.New("passkey assertion failed")
+	ErrCloneDetected   = errors.New("cloned authenticator detected")
+	ErrInvalidToken    = errors.New("invalid or expired verification")
+)
@@ -0,0 +1,22 @@
+package magiclink
+
+import "github.com/kobayashiyabako16g/passkey-auth-example/internal/domain/model"
+
+type SendRequest struct {
+	Email     string
+	IP        string
+	UserAgent string
+}
+
+type LoginRequest struct {
+	Token string
+	// Session is the session the client held before login. It's discarded.
+	Session   string
+	IP        string
+	UserAgent string
+}
+
+type LoginResponse struct {
+	// Session waits for a TOTP code if the user has set one up.
+	Session *model.Session
+}
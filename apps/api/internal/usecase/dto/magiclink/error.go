@@ -0,0 +1,10 @@
+package magiclink
+
+import "errors"
+
+var (
+	ErrDisabled     = errors.New("magic links are disabled")
+	ErrInvalidEmail = errors.New("invalid email address")
+	ErrRateLimited  = errors.New("too many magic link requests")
+	ErrInvalidToken = errors.New("invalid or expired magic link")
+)
@@ -0,0 +1,128 @@
+package oidc
+
+import "github.com/kobayashiyabako16g/passkey-auth-example/internal/domain/model"
+
+// AuthorizeRequest holds the query parameters of /authorize.
+type AuthorizeRequest struct {
+	// Session is the value of the session cookie, if any.
+	Session             string
+	ClientID            string
+	RedirectURI         string
+	ResponseType        string
+	Scope               string
+	State               string
+	Nonce               string
+	CodeChallenge       string
+	CodeChallengeMethod string
+	Prompt              string
+	MaxAge              string
+}
+
+type AuthorizeResponse struct {
+	// RedirectTo is the client callback, or the login page when the user has to sign in.
+	RedirectTo string
+}
+
+type CompleteAuthorizationRequest struct {
+	User    *model.User
+	Session *model.Session
+	// Request is the ID of the pending authorization request.
+	Request string
+}
+
+type TokenRequest struct {
+	GrantType    string
+	Code         string
+	DeviceCode   string
+	RedirectURI  string
+	CodeVerifier string
+	ClientID     string
+	ClientSecret string
+}
+
+type TokenResponse struct {
+	AccessToken string
+	IDToken     string
+	// ExpiresIn is the lifetime of the access token in seconds.
+	ExpiresIn int64
+	Scope     string
+}
+
+type UserInfoRequest struct {
+	AccessToken string
+}
+
+type UserInfoResponse struct {
+	User  *model.User
+	Scope []string
+}
+
+type DiscoveryResponse struct {
+	Issuer                            string
+	AuthorizationEndpoint             string
+	TokenEndpoint                     string
+	UserInfoEndpoint                  string
+	JWKSURI                           string
+	IntrospectionEndpoint             string
+	RevocationEndpoint                string
+	DeviceAuthorizationEndpoint       string
+	GrantTypesSupported               []string
+	IDTokenSigningAlgValuesSupported  []string
+	ScopesSupported                   []string
+	TokenEndpointAuthMethodsSupported []string
+}
+
+// IntrospectRequest asks about a session ID (RFC 7662).
+type IntrospectRequest struct {
+	ClientID     string
+	ClientSecret string
+	Token        string
+}
+
+type IntrospectResponse struct {
+	// Session is nil when the token isn't an active session.
+	Session *model.Session
+}
+
+// RevokeRequest revokes a session ID (RFC 7009).
+type RevokeRequest struct {
+	ClientID     string
+	ClientSecret string
+	Token        string
+}
+
+// DeviceAuthorizationRequest starts the device authorization grant (RFC 8628 3.1).
+type DeviceAuthorizationRequest struct {
+	ClientID     string
+	ClientSecret string
+	Scope        string
+}
+
+type DeviceAuthorizationResponse struct {
+	DeviceCode              string
+	UserCode                string
+	VerificationURI         string
+	VerificationURIComplete string
+	// ExpiresIn and Interval are in seconds.
+	ExpiresIn int64
+	Interval  int64
+}
+
+// DeviceInfoRequest looks up the grant the user is about to approve.
+type DeviceInfoRequest struct {
+	UserCode string
+}
+
+type DeviceInfoResponse struct {
+	UserCode   string
+	ClientName string
+	Scope      []string
+}
+
+type ApproveDeviceRequest struct {
+	User     *model.User
+	Session  *model.Session
+	UserCode string
+	// Approve is false when the user denies the device.
+	Approve bool
+}
@@ -0,0 +1,35 @@
+package oidc
+
+import "errors"
+
+// Error is an OAuth 2.0 error response.
+type Error struct {
+	Code        string
+	Description string
+}
+
+func (e *Error) Error() string {
+	return e.Code + ": " + e.Description
+}
+
+var (
+	// ErrInvalidClient at /authorize means the client or the redirect URI can't be trusted,
+	// so the error is shown to the user instead of being redirected.
+	ErrInvalidClient   = &Error{"invalid_client", "client authentication failed"}
+	ErrRequestNotFound = errors.New("authorization request not found")
+	ErrLoginRequired   = errors.New("login required")
+	ErrDeviceNotFound  = errors.New("device grant not found")
+
+	ErrInvalidRequest       = &Error{"invalid_request", "the request is missing a parameter or is malformed"}
+	ErrInvalidGrant         = &Error{"invalid_grant", "the authorization code is invalid or expired"}
+	ErrUnsupportedGrantType = &Error{"unsupported_grant_type", "the grant type isn't supported"}
+	ErrUnauthorizedClient   = &Error{"unauthorized_client", "the client isn't allowed to sign users in"}
+	ErrInvalidToken         = &Error{"invalid_token", "the access token is invalid"}
+	ErrInsufficientScope    = &Error{"insufficient_scope", "the access token lacks the openid scope"}
+
+	// Errors of the device code grant while polling (RFC 8628 3.5)
+	ErrAuthorizationPending = &Error{"authorization_pending", "the user hasn't approved the device yet"}
+	ErrSlowDown             = &Error{"slow_down", "the device polls too often"}
+	ErrAccessDenied         = &Error{"access_denied", "the user denied the device"}
+	ErrExpiredToken         = &Error{"expired_token", "the device code expired"}
+)
@@ -0,0 +1,56 @@
+package passkey
+
+import (
+	"net/http"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/kobayashiyabako16g/passkey-auth-example/internal/domain/model"
+)
+
+type BeginAddCredentialRequest struct {
+	User *model.User
+	// Conditional creates the passkey without a prompt when the browser allows it,
+	// e.g. right after the password manager filled in a password.
+	Conditional bool
+}
+
+type BeginAddCredentialResponse struct {
+	Cred     *protocol.CredentialCreation
+	Ceremony *model.Ceremony
+}
+
+type FinishAddCredentialRequest struct {
+	User *model.User
+	// Session is upgraded when it only allowed enrolling a passkey, e.g. after a recovery code.
+	Session   *model.Session
+	Ceremony  string
+	IP        string
+	UserAgent string
+	Request   *http.Request
+}
+
+type FinishAddCredentialResponse struct {
+	// Session replaces the session of the request when it was upgraded.
+	Session *model.Session
+	// SecondFactorRequired is set when the upgraded session still waits for a TOTP code.
+	SecondFactorRequired bool
+}
+
+type ListCredentialsRequest struct {
+	User *model.User
+}
+
+type ListCredentialsResponse struct {
+	Credentials []model.Credential
+}
+
+type RenameCredentialRequest struct {
+	User *model.User
+	ID   string
+	Name string
+}
+
+type DeleteCredentialRequest struct {
+	User *model.User
+	ID   string
+}
@@ -0,0 +1,11 @@
+package passkey
+
+import "errors"
+
+var (
+	ErrSessionNotFound    = errors.New("session not found")
+	ErrFinishRegistration = errors.New("registration failed")
+	ErrCredentialNotFound = errors.New("credential not found")
+	ErrInvalidName        = errors.New("invalid credential name")
+	ErrLastCredential     = errors.New("can't delete the last credential")
+)
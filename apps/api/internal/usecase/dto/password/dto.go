@@ -0,0 +1,17 @@
+package password
+
+import "github.com/kobayashiyabako16g/passkey-auth-example/internal/domain/model"
+
+type LoginRequest struct {
+	Username string
+	Password string
+	// Session is the session the client held before login. It's discarded.
+	Session   string
+	IP        string
+	UserAgent string
+}
+
+type LoginResponse struct {
+	// Session waits for a TOTP code when Session.SecondFactorRequired is set.
+	Session *model.Session
+}
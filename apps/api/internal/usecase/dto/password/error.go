@@ -0,0 +1,10 @@
+package password
+
+import "errors"
+
+var (
+	ErrInvalidCredentials = errors.New("invalid username or password")
+	// ErrPasswordRetired means the user has a passkey and must sign in with it.
+	ErrPasswordRetired = errors.New("password retired")
+	ErrTooManyAttempts = errors.New("too many attempts")
+)
@@ -0,0 +1,61 @@
+package qrlogin
+
+import (
+	"net/http"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/kobayashiyabako16g/passkey-auth-example/internal/domain/model"
+)
+
+// StartRequest describes the new browser asking to sign in.
+type StartRequest struct {
+	IP        string
+	UserAgent string
+}
+
+type StartResponse struct {
+	Login *model.QRLogin
+	// Code is the formatted code, e.g. "BCDF-GHJK".
+	Code string
+	// ApproveURL is encoded in the QR code and opens the approval page on the signed-in device.
+	ApproveURL string
+	ExpiresIn  int64
+}
+
+type WaitRequest struct {
+	// ID is the value of the qr_login cookie.
+	ID string
+	// Session is the session the new browser held before. It's discarded on approval.
+	Session string
+}
+
+type WaitResponse struct {
+	// Session is nil while the request is still pending.
+	Session *model.Session
+}
+
+type InfoRequest struct {
+	Code string
+}
+
+type InfoResponse struct {
+	Login *model.QRLogin
+	Code  string
+}
+
+type BeginApproveRequest struct {
+	User *model.User
+	Code string
+}
+
+type BeginApproveResponse struct {
+	Cred     *protocol.CredentialAssertion
+	Ceremony *model.Ceremony
+}
+
+type FinishApproveRequest struct {
+	User     *model.User
+	Code     string
+	Ceremony string
+	Request  *http.Request
+}
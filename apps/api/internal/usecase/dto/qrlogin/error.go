@@ -0,0 +1,10 @@
+package qrlogin
+
+import "errors"
+
+var (
+	ErrLoginNotFound   = errors.New("qr login not found")
+	ErrSessionNotFound = errors.New("session not found")
+	ErrAssertionFailed = errors.New("passkey assertion failed")
+	ErrCloneDetected   = errors.New("cloned authenticator detected")
+)
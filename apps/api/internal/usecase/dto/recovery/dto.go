@@ -0,0 +1,36 @@
+package recovery
+
+import "github.com/kobayashiyabako16g/passkey-auth-example/internal/domain/model"
+
+type GenerateRequest struct {
+	User      *model.User
+	IP        string
+	UserAgent string
+}
+
+type GenerateResponse struct {
+	// Codes are formatted for display. They can't be shown again.
+	Codes []string
+}
+
+type StatusRequest struct {
+	User *model.User
+}
+
+type StatusResponse struct {
+	Remaining int
+}
+
+type LoginRequest struct {
+	Username string
+	Code     string
+	// Session is the session the client held before login. It's discarded.
+	Session   string
+	IP        string
+	UserAgent string
+}
+
+type LoginResponse struct {
+	// Session only allows registering a new passkey.
+	Session *model.Session
+}
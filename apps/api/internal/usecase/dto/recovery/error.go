@@ -0,0 +1,8 @@
+package recovery
+
+import "errors"
+
+var (
+	ErrInvalidCode     = errors.New("invalid recovery code")
+	ErrTooManyAttempts = errors.New("too many attempts")
+)
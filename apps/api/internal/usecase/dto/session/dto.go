@@ -0,0 +1,55 @@
+package session
+
+import "github.com/kobayashiyabako16g/passkey-auth-example/internal/domain/model"
+
+type LogoutRequest struct {
+	Session string
+}
+
+type LogoutAllRequest struct {
+	Session *model.Session
+}
+
+type ListSessionsRequest struct {
+	Session *model.Session
+}
+
+type ListSessionsResponse struct {
+	Sessions []model.Session
+	// Current is the public ID of the session making the request.
+	Current string
+	// CredentialNames maps credential IDs to their names.
+	CredentialNames map[string]string
+}
+
+type RevokeSessionRequest struct {
+	Session *model.Session
+	// ID is the public ID of the session to revoke.
+	ID string
+}
+
+type RevokeSessionResponse struct {
+	// Current reports whether the session making the request was revoked.
+	Current bool
+}
+
+type MeRequest struct {
+	User    *model.User
+	Session *model.Session
+}
+
+type MeResponse struct {
+	User    *model.User
+	Session *model.Session
+	// Credential is the credential used to sign in. It's nil if it was deleted since.
+	Credential *model.Credential
+}
+
+type VerifyRequest struct {
+	Session string
+}
+
+type VerifyResponse struct {
+	User    *model.User
+	Session *model.Session
+}
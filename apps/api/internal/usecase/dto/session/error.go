@@ -0,0 +1,8 @@
+package session
+
+import "errors"
+
+var (
+	ErrUnauthorized    = errors.New("unauthorized")
+	ErrSessionNotFound = errors.New("session not found")
+)
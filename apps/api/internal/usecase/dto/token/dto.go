@@ -0,0 +1,12 @@
+package token
+
+type RefreshRequest struct {
+	RefreshToken string
+}
+
+type TokenResponse struct {
+	AccessToken  string
+	RefreshToken string
+	// ExpiresIn is the lifetime of the access token in seconds.
+	ExpiresIn int64
+}
@@ -0,0 +1,8 @@
+package token
+
+import "errors"
+
+var (
+	ErrInvalidRefreshToken = errors.New("invalid refresh token")
+	ErrInvalidAccessToken  = errors.New("invalid access token")
+)
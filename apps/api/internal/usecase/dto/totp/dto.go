@@ -0,0 +1,63 @@
+package totp
+
+import "github.com/kobayashiyabako16g/passkey-auth-example/internal/domain/model"
+
+type BeginEnrollRequest struct {
+	User *model.User
+}
+
+type BeginEnrollResponse struct {
+	// Secret is base32 for typing it into an authenticator app.
+	Secret string
+	// URI is the otpauth:// provisioning URI to show as a QR code.
+	URI string
+}
+
+type FinishEnrollRequest struct {
+	User      *model.User
+	Code      string
+	Policy    model.TOTPPolicy
+	IP        string
+	UserAgent string
+}
+
+type StatusRequest struct {
+	User *model.User
+}
+
+type StatusResponse struct {
+	Enabled bool
+	Policy  model.TOTPPolicy
+}
+
+type DisableRequest struct {
+	User      *model.User
+	IP        string
+	UserAgent string
+}
+
+type VerifyRequest struct {
+	// Session is the login waiting for the second factor.
+	Session   string
+	Code      string
+	IP        string
+	UserAgent string
+}
+
+type VerifyResponse struct {
+	Session *model.Session
+}
+
+type LoginRequest struct {
+	Username string
+	Code     string
+	// Session is the session the client held before login. It's discarded.
+	Session   string
+	IP        string
+	UserAgent string
+}
+
+type LoginResponse struct {
+	// Session only allows registering a new passkey.
+	Session *model.Session
+}
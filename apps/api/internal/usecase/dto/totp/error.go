@@ -0,0 +1,12 @@
+package totp
+
+import "errors"
+
+var (
+	ErrInvalidPolicy      = errors.New("invalid totp policy")
+	ErrEnrollmentNotFound = errors.New("totp enrollment not found")
+	ErrNotEnabled         = errors.New("totp not enabled")
+	ErrInvalidCode        = errors.New("invalid totp code")
+	ErrTooManyAttempts    = errors.New("too many totp attempts")
+	ErrSessionNotFound    = errors.New("session not found")
+)
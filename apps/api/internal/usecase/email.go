@@ -0,0 +1,237 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/kobayashiyabako16g/passkey-auth-example/internal/domain/model"
+	"github.com/kobayashiyabako16g/passkey-auth-example/internal/domain/repository"
+	dtos "github.com/kobayashiyabako16g/passkey-auth-example/internal/usecase/dto/email"
+	"github.com/kobayashiyabako16g/passkey-auth-example/pkg/logger"
+	"github.com/kobayashiyabako16g/passkey-auth-example/pkg/mailer"
+)
+
+type EmailVerificationOptions struct {
+	// URL is the frontend page that posts the token from its query to the verify endpoint.
+	URL string
+	TTL time.Duration
+}
+
+// EmailVerifier mails a link that verifies an email address of a user.
+type EmailVerifier struct {
+	evr    repository.EmailVerification
+	audit  repository.Audit
+	mailer mailer.Mailer
+	opts   EmailVerificationOptions
+}
+
+func NewEmailVerifier(evr repository.EmailVerification, audit repository.Audit, mailer mailer.Mailer, opts EmailVerificationOptions) *EmailVerifier {
+	return &EmailVerifier{evr, audit, mailer, opts}
+}
+
+// Send mails the verification of a normalized address.
+func (v *EmailVerifier) Send(ctx context.Context, user *model.User, email string, ip string, userAgent string) error {
+	verification := &model.EmailVerification{
+		UserID:    user.ID,
+		Email:     email,
+		ExpiresAt: time.Now().Add(v.opts.TTL),
+	}
+	if err := v.evr.Create(ctx, verification); err != nil {
+		logger.Error(ctx, "can't create email verification", logger.WithError(err))
+		return err
+	}
+
+	target, err := url.Parse(v.opts.URL)
+	if err != nil {
+		return err
+	}
+	query := target.Query()
+	query.Set("token", verification.Token)
+	target.RawQuery = query.Encode()
+
+	if err := v.mailer.Send(ctx, mailer.Message{
+		To:      email,
+		Subject: "Verify your email address",
+		Body: fmt.Sprintf("Open this link to use this address for %s:\n\n%s\n\nThe link expires in %s.\n\n"+
+			"If you didn't request it, you can ignore this email.\n",
+			user.Name, target.String(), v.opts.TTL),
+	}); err != nil {
+		logger.Error(ctx, "can't send email verification", logger.WithError(err))
+		return err
+	}
+
+	if err := v.audit.Record(ctx, &model.AuditEvent{
+		UserID:    user.ID,
+		Event:     model.AuditEmailVerificationSent,
+		IP:        ip,
+		UserAgent: userAgent,
+	}); err != nil {
+		logger.Error(ctx, "can't record audit event", logger.WithError(err))
+		return err
+	}
+	return nil
+}
+
+// Email manages the email address of a user. A new address is confirmed with a passkey
+// assertion first, and replaces the current one once it's verified.
+type Email interface {
+	BeginChange(ctx context.Context, dto dtos.BeginChangeRequest) (*dtos.BeginChangeResponse, error)
+	FinishChange(ctx context.Context, dto dtos.FinishChangeRequest) (*dtos.FinishChangeResponse, error)
+	Verify(ctx context.Context, dto dtos.VerifyRequest) (*dtos.VerifyResponse, error)
+}
+
+type email struct {
+	cr       repository.Ceremony
+	ur       repository.User
+	evr      repository.EmailVerification
+	audit    repository.Audit
+	webAuthn *webauthn.WebAuthn
+	verifier *EmailVerifier
+}
+
+func NewEmail(cr repository.Ceremony, ur repository.User, evr repository.EmailVerification, audit repository.Audit, webAuthn *webauthn.WebAuthn, verifier *EmailVerifier) Email {
+	return &email{
+		cr:       cr,
+		ur:       ur,
+		evr:      evr,
+		audit:    audit,
+		webAuthn: webAuthn,
+		verifier: verifier,
+	}
+}
+
+func (e *email) BeginChange(ctx context.Context, dto dtos.BeginChangeRequest) (*dtos.BeginChangeResponse, error) {
+	user := dto.User
+
+	address, ok := model.NormalizeEmail(dto.Email)
+	if !ok {
+		return nil, dtos.ErrInvalidEmail
+	}
+	if err := e.checkAvailable(ctx, user, address); err != nil {
+		return nil, err
+	}
+
+	// ログイン中のユーザーのクレデンシャルだけを許可する
+	options, sessionData, err := e.webAuthn.BeginLogin(user,
+		webauthn.WithUserVerification(protocol.VerificationRequired))
+	if err != nil {
+		logger.Error(ctx, "can't begin login", logger.WithError(err))
+		return nil, err
+	}
+
+	ceremony, err := e.cr.Create(ctx)
+	if err != nil {
+		logger.Error(ctx, "can't create ceremony", logger.WithError(err))
+		return nil, err
+	}
+	ceremony.UserID = user.ID
+	ceremony.Email = address
+	ceremony.AuthenticationData = sessionData
+	if err := e.cr.Save(ctx, ceremony); err != nil {
+		logger.Error(ctx, "can't save ceremony", logger.WithError(err))
+		return nil, err
+	}
+
+	return &dtos.BeginChangeResponse{Cred: options, Ceremony: ceremony}, nil
+}
+
+func (e *email) FinishChange(ctx context.Context, dto dtos.FinishChangeRequest) (*dtos.FinishChangeResponse, error) {
+	user := dto.User
+
+	ceremony, err := e.cr.Consume(ctx, dto.Ceremony)
+	if err != nil {
+		logger.Error(ctx, "can't get ceremony", logger.WithError(err))
+		return nil, err
+	}
+	if ceremony == nil || ceremony.AuthenticationData == nil || ceremony.UserID != user.ID || ceremony.Email == "" {
+		logger.Info(ctx, "authentication data is nil")
+		return nil, dtos.ErrSessionNotFound
+	}
+
+	validatedCredential, err := e.webAuthn.FinishLogin(user, *ceremony.AuthenticationData, dto.Request)
+	if err != nil {
+		logger.Info(ctx, "can't finish assertion", logger.WithError(err))
+		return nil, dtos.ErrAssertionFailed
+	}
+
+	if validatedCredential.Authenticator.CloneWarning {
+		if err := rejectClone(ctx, e.ur, user.ID, validatedCredential); err != nil {
+			return nil, err
+		}
+		return nil, dtos.ErrCloneDetected
+	}
+	user.UpdateCredential(validatedCredential)
+	if err := e.ur.UpdateCredential(ctx, user.ID, validatedCredential); err != nil {
+		logger.Error(ctx, "can't save credential", logger.WithError(err))
+		return nil, err
+	}
+
+	if err := e.verifier.Send(ctx, user, ceremony.Email, dto.IP, dto.UserAgent); err != nil {
+		return nil, err
+	}
+
+	logger.Info(ctx, "Sent email verification", "user_id", user.ID)
+	return &dtos.FinishChangeResponse{Email: ceremony.Email}, nil
+}
+
+func (e *email) Verify(ctx context.Context, dto dtos.VerifyRequest) (*dtos.VerifyResponse, error) {
+	verification, err := e.evr.Consume(ctx, dto.Token)
+	if err != nil {
+		logger.Error(ctx, "can't get email verification", logger.WithError(err))
+		return nil, err
+	}
+	if verification == nil {
+		logger.Info(ctx, "email verification not found")
+		return nil, dtos.ErrInvalidToken
+	}
+
+	user, err := e.ur.FindById(ctx, verification.UserID)
+	if err != nil {
+		logger.Error(ctx, "can't get user", logger.WithError(err))
+		return nil, err
+	}
+	if user == nil {
+		return nil, dtos.ErrInvalidToken
+	}
+	// 送信後に他のユーザーが確認した場合
+	if err := e.checkAvailable(ctx, user, verification.Email); err != nil {
+		return nil, err
+	}
+
+	if err := e.ur.VerifyEmail(ctx, user.ID, verification.Email); err != nil {
+		if err == repository.ErrEmailTaken {
+			return nil, dtos.ErrEmailExists
+		}
+		logger.Error(ctx, "can't verify email", logger.WithError(err))
+		return nil, err
+	}
+	if err := e.audit.Record(ctx, &model.AuditEvent{
+		UserID:    user.ID,
+		Event:     model.AuditEmailVerified,
+		IP:        dto.IP,
+		UserAgent: dto.UserAgent,
+	}); err != nil {
+		logger.Error(ctx, "can't record audit event", logger.WithError(err))
+		return nil, err
+	}
+
+	logger.Info(ctx, "Verified email", "user_id", user.ID)
+	return &dtos.VerifyResponse{Email: verification.Email}, nil
+}
+
+// checkAvailable fails when another user has verified the address.
+func (e *email) checkAvailable(ctx context.Context, user *model.User, address string) error {
+	owner, err := e.ur.FindByEmail(ctx, address)
+	if err != nil {
+		logger.Error(ctx, "can't get user", logger.WithError(err))
+		return err
+	}
+	if owner != nil && owner.ID != user.ID {
+		return dtos.ErrEmailExists
+	}
+	return nil
+}
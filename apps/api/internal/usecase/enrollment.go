@@ -0,0 +1,95 @@
+package usecase
+
+import (
+	"context"
+	"net/url"
+	"time"
+
+	"github.com/kobayashiyabako16g/passkey-auth-example/internal/domain/model"
+	"github.com/kobayashiyabako16g/passkey-auth-example/internal/domain/repository"
+	"github.com/kobayashiyabako16g/passkey-auth-example/pkg/logger"
+)
+
+type EnrollmentOptions struct {
+	// URL is the frontend page that starts the registration with the token from its query.
+	URL string
+	TTL time.Duration
+}
+
+// EnrollmentLinks issues and spends the one-time links that let a user provisioned
+// by an administrator register their first passkey.
+type EnrollmentLinks struct {
+	er    repository.EnrollmentToken
+	audit repository.Audit
+	opts  EnrollmentOptions
+}
+
+func NewEnrollmentLinks(er repository.EnrollmentToken, audit repository.Audit, opts EnrollmentOptions) *EnrollmentLinks {
+	return &EnrollmentLinks{er, audit, opts}
+}
+
+// Issue returns the link with its token. A new link replaces the unused ones of the user.
+func (e *EnrollmentLinks) Issue(ctx context.Context, userID string, ip string, userAgent string) (string, *model.EnrollmentToken, error) {
+	token := &model.EnrollmentToken{
+		UserID:    userID,
+		ExpiresAt: time.Now().Add(e.opts.TTL),
+	}
+	if err := e.er.Create(ctx, token); err != nil {
+		logger.Error(ctx, "can't create enrollment token", logger.WithError(err))
+		return "", nil, err
+	}
+
+	target, err := url.Parse(e.opts.URL)
+	if err != nil {
+		return "", nil, err
+	}
+	query := target.Query()
+	query.Set("token", token.Token)
+	target.RawQuery = query.Encode()
+
+	if err := e.record(ctx, userID, model.AuditEnrollmentLinkIssued, ip, userAgent); err != nil {
+		return "", nil, err
+	}
+
+	logger.Info(ctx, "Issued enrollment link", "user_id", userID, "expires_at", token.ExpiresAt)
+	return target.String(), token, nil
+}
+
+// Find returns the token of a link that is neither used nor expired, or nil.
+func (e *EnrollmentLinks) Find(ctx context.Context, raw string) (*model.EnrollmentToken, error) {
+	token, err := e.er.FindByToken(ctx, raw)
+	if err != nil {
+		logger.Error(ctx, "can't get enrollment token", logger.WithError(err))
+		return nil, err
+	}
+	return token, nil
+}
+
+// Use spends the link. It reports false when it was already used or has expired.
+func (e *EnrollmentLinks) Use(ctx context.Context, id string, userID string, ip string, userAgent string) (bool, error) {
+	ok, err := e.er.MarkUsed(ctx, id)
+	if err != nil {
+		logger.Error(ctx, "can't mark enrollment token used", logger.WithError(err))
+		return false, err
+	}
+	if !ok {
+		return false, nil
+	}
+	if err := e.record(ctx, userID, model.AuditEnrollmentLinkUsed, ip, userAgent); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (e *EnrollmentLinks) record(ctx context.Context, userID string, event model.AuditEventType, ip string, userAgent string) error {
+	if err := e.audit.Record(ctx, &model.AuditEvent{
+		UserID:    userID,
+		Event:     event,
+		IP:        ip,
+		UserAgent: userAgent,
+	}); err != nil {
+		logger.Error(ctx, "can't record audit event", logger.WithError(err))
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,44 @@
+package usecase
+
+import (
+	"context"
+	"time"
+
+	"github.com/kobayashiyabako16g/passkey-auth-example/internal/domain/repository"
+	"github.com/kobayashiyabako16g/passkey-auth-example/pkg/logger"
+)
+
+const (
+	// loginAttemptWindow is the window of the attempt limits of password and recovery code logins.
+	loginAttemptWindow = 15 * time.Minute
+	// maxUserLoginAttempts is the number of attempts per username in a window, against guessing.
+	maxUserLoginAttempts = 10
+	// maxIPLoginAttempts is the number of attempts per client IP address in a window,
+	// against spraying many usernames.
+	maxIPLoginAttempts = 50
+)
+
+// allowLoginAttempt counts an attempt of the method and reports whether both the username
+// and the IP address are within their limits.
+func allowLoginAttempt(ctx context.Context, attempts repository.LoginAttempt, method string, username string, ip string) (bool, error) {
+	count, err := attempts.CountIP(ctx, method, ip, loginAttemptWindow)
+	if err != nil {
+		logger.Error(ctx, "can't count login attempts", logger.WithError(err))
+		return false, err
+	}
+	if count > maxIPLoginAttempts {
+		logger.Info(ctx, "too many login attempts from ip", "method", method, "ip", ip)
+		return false, nil
+	}
+
+	count, err = attempts.CountUser(ctx, method, username, loginAttemptWindow)
+	if err != nil {
+		logger.Error(ctx, "can't count login attempts", logger.WithError(err))
+		return false, err
+	}
+	if count > maxUserLoginAttempts {
+		logger.Info(ctx, "too many login attempts for user", "method", method)
+		return false, nil
+	}
+	return true, nil
+}
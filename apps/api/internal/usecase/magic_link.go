@@ -0,0 +1,199 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/kobayashiyabako16g/passkey-auth-example/internal/domain/model"
+	"github.com/kobayashiyabako16g/passkey-auth-example/internal/domain/repository"
+	dtos "github.com/kobayashiyabako16g/passkey-auth-example/internal/usecase/dto/magiclink"
+	"github.com/kobayashiyabako16g/passkey-auth-example/pkg/logger"
+	"github.com/kobayashiyabako16g/passkey-auth-example/pkg/mailer"
+)
+
+// MagicLink signs in users without passkey support with a single-use link sent by email.
+// The session it issues is a normal one, since the device may not be able to create a passkey.
+// The client still offers to register one afterwards.
+type MagicLink interface {
+	Send(ctx context.Context, dto dtos.SendRequest) error
+	Login(ctx context.Context, dto dtos.LoginRequest) (*dtos.LoginResponse, error)
+}
+
+type MagicLinkOptions struct {
+	Enabled bool
+	// URL is the frontend page that posts the token from its query to the login endpoint.
+	URL string
+	TTL time.Duration
+	// RateLimit is the number of links that can be requested for an address per RateWindow.
+	RateLimit  int
+	RateWindow time.Duration
+}
+
+type magicLink struct {
+	sr     repository.Session
+	ur     repository.User
+	mr     repository.MagicLink
+	tr     repository.TOTP
+	audit  repository.Audit
+	mailer mailer.Mailer
+	opts   MagicLinkOptions
+}
+
+func NewMagicLink(sr repository.Session, ur repository.User, mr repository.MagicLink, tr repository.TOTP, audit repository.Audit, mailer mailer.Mailer, opts MagicLinkOptions) MagicLink {
+	return &magicLink{
+		sr:     sr,
+		ur:     ur,
+		mr:     mr,
+		tr:     tr,
+		audit:  audit,
+		mailer: mailer,
+		opts:   opts,
+	}
+}
+
+// Send mails a link if the address belongs to a user. It doesn't tell whether it does.
+func (m *magicLink) Send(ctx context.Context, dto dtos.SendRequest) error {
+	if !m.opts.Enabled {
+		return dtos.ErrDisabled
+	}
+	email, ok := model.NormalizeEmail(dto.Email)
+	if !ok {
+		return dtos.ErrInvalidEmail
+	}
+
+	// ユーザーの有無に関わらず数える
+	count, err := m.mr.CountRequest(ctx, email, m.opts.RateWindow)
+	if err != nil {
+		logger.Error(ctx, "can't count magic link requests", logger.WithError(err))
+		return err
+	}
+	if count > int64(m.opts.RateLimit) {
+		logger.Info(ctx, "magic link rate limit exceeded")
+		return dtos.ErrRateLimited
+	}
+
+	user, err := m.ur.FindByEmail(ctx, email)
+	if err != nil {
+		logger.Error(ctx, "can't get user", logger.WithError(err))
+		return err
+	}
+	if user == nil {
+		logger.Info(ctx, "no user for magic link")
+		return nil
+	}
+
+	link := &model.MagicLink{
+		UserID:    user.ID,
+		Email:     email,
+		ExpiresAt: time.Now().Add(m.opts.TTL),
+	}
+	if err := m.mr.Create(ctx, link); err != nil {
+		logger.Error(ctx, "can't create magic link", logger.WithError(err))
+		return err
+	}
+
+	target, err := url.Parse(m.opts.URL)
+	if err != nil {
+		return err
+	}
+	query := target.Query()
+	query.Set("token", link.Token)
+	target.RawQuery = query.Encode()
+
+	if err := m.mailer.Send(ctx, mailer.Message{
+		To:      email,
+		Subject: "Your sign-in link",
+		Body: fmt.Sprintf("Open this link to sign in as %s:\n\n%s\n\nThe link expires in %s and works once. "+
+			"After signing in, you can create a passkey for this device.\n\n"+
+			"If you didn't request it, you can ignore this email.\n",
+			user.Name, target.String(), m.opts.TTL),
+	}); err != nil {
+		logger.Error(ctx, "can't send magic link", logger.WithError(err))
+		return err
+	}
+
+	if err := m.record(ctx, user.ID, model.AuditMagicLinkSent, dto.IP, dto.UserAgent); err != nil {
+		return err
+	}
+	logger.Info(ctx, "Sent magic link", "user_id", user.ID)
+	return nil
+}
+
+func (m *magicLink) Login(ctx context.Context, dto dtos.LoginRequest) (*dtos.LoginResponse, error) {
+	if !m.opts.Enabled {
+		return nil, dtos.ErrDisabled
+	}
+
+	link, err := m.mr.Consume(ctx, dto.Token)
+	if err != nil {
+		logger.Error(ctx, "can't get magic link", logger.WithError(err))
+		return nil, err
+	}
+	if link == nil {
+		logger.Info(ctx, "magic link not found")
+		return nil, dtos.ErrInvalidToken
+	}
+
+	user, err := m.ur.FindById(ctx, link.UserID)
+	if err != nil {
+		logger.Error(ctx, "can't get user", logger.WithError(err))
+		return nil, err
+	}
+	// 送信後にアドレスが変更された場合は無効
+	if user == nil || user.Email != link.Email || !user.EmailVerified {
+		logger.Info(ctx, "magic link no longer matches the user")
+		return nil, dtos.ErrInvalidToken
+	}
+
+	if err := m.record(ctx, user.ID, model.AuditMagicLinkUsed, dto.IP, dto.UserAgent); err != nil {
+		return nil, err
+	}
+
+	// 以前のセッションは破棄する
+	previous, err := m.sr.Get(ctx, dto.Session)
+	if err != nil {
+		logger.Error(ctx, "can't get session", logger.WithError(err))
+		return nil, err
+	}
+	if previous != nil {
+		if err := m.sr.Delete(ctx, previous); err != nil {
+			logger.Error(ctx, "can't delete session", logger.WithError(err))
+			return nil, err
+		}
+	}
+
+	// メールのリンクはパスワードと同じく TOTP を求める
+	secondFactor, err := requiresSecondFactor(ctx, m.tr, user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	session, err := m.sr.Create(ctx, user, model.SessionInfo{
+		AMR:                  []string{model.AMREmail},
+		IP:                   dto.IP,
+		UserAgent:            dto.UserAgent,
+		SecondFactorRequired: secondFactor,
+	})
+	if err != nil {
+		logger.Error(ctx, "can't create session", logger.WithError(err))
+		return nil, err
+	}
+
+	logger.Info(ctx, "Signed in with a magic link", "user_id", user.ID)
+	return &dtos.LoginResponse{Session: session}, nil
+}
+
+func (m *magicLink) record(ctx context.Context, userID string, event model.AuditEventType, ip string, userAgent string) error {
+	if err := m.audit.Record(ctx, &model.AuditEvent{
+		UserID:    userID,
+		Event:     event,
+		IP:        ip,
+		UserAgent: userAgent,
+	}); err != nil {
+		logger.Error(ctx, "can't record audit event", logger.WithError(err))
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,223 @@
+package usecase
+
+import (
+	"context"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kobayashiyabako16g/passkey-auth-example/internal/domain/model"
+	"github.com/kobayashiyabako16g/passkey-auth-example/internal/domain/repository"
+	dtos "github.com/kobayashiyabako16g/passkey-auth-example/internal/usecase/dto/magiclink"
+	"github.com/kobayashiyabako16g/passkey-auth-example/pkg/kvstore"
+	"github.com/kobayashiyabako16g/passkey-auth-example/pkg/mailer"
+)
+
+// fakeMailer is the mail transport of the tests. It keeps the messages.
+type fakeMailer struct {
+	sent []mailer.Message
+}
+
+func (m *fakeMailer) Send(ctx context.Context, msg mailer.Message) error {
+	m.sent = append(m.sent, msg)
+	return nil
+}
+
+// fakeKV implements the kvstore commands of the magic link repository, with a clock
+// the tests move forward to expire keys.
+type fakeKV struct {
+	kvstore.Client
+	now     time.Time
+	values  map[string]string
+	sets    map[string][]string
+	expires map[string]time.Time
+}
+
+func (c *fakeKV) get(key string) string {
+	if at, ok := c.expires[key]; ok && !c.now.Before(at) {
+		delete(c.values, key)
+	}
+	return c.values[key]
+}
+
+func (c *fakeKV) Set(ctx context.Context, key, value string, opts ...kvstore.SetOptions) error {
+	c.values[key] = value
+	for _, opt := range opts {
+		c.expires[key] = c.now.Add(time.Duration(opt.Expiration) * time.Second)
+	}
+	return nil
+}
+
+func (c *fakeKV) GetDel(ctx context.Context, key string) (string, error) {
+	value := c.get(key)
+	delete(c.values, key)
+	return value, nil
+}
+
+func (c *fakeKV) Expire(ctx context.Context, key string, seconds int64) error {
+	c.expires[key] = c.now.Add(time.Duration(seconds) * time.Second)
+	return nil
+}
+
+func (c *fakeKV) Incr(ctx context.Context, key string) (int64, error) {
+	count, _ := strconv.ParseInt(c.get(key), 10, 64)
+	count++
+	c.values[key] = strconv.FormatInt(count, 10)
+	return count, nil
+}
+
+type fakeUsers struct {
+	repository.User
+	user *model.User
+}
+
+func (r *fakeUsers) FindById(ctx context.Context, id string) (*model.User, error) {
+	if id != r.user.ID {
+		return nil, nil
+	}
+	return r.user, nil
+}
+
+func (r *fakeUsers) FindByEmail(ctx context.Context, email string) (*model.User, error) {
+	if email != r.user.Email {
+		return nil, nil
+	}
+	return r.user, nil
+}
+
+// fakeSessions returns the session it would store.
+type fakeSessions struct {
+	repository.Session
+}
+
+func (r *fakeSessions) Create(ctx context.Context, user *model.User, info model.SessionInfo) (*model.Session, error) {
+	return &model.Session{
+		UserID:               user.ID,
+		Authenticated:        !info.EnrollmentRequired && !info.SecondFactorRequired,
+		EnrollmentRequired:   info.EnrollmentRequired,
+		SecondFactorRequired: info.SecondFactorRequired,
+	}, nil
+}
+
+func (r *fakeSessions) Get(ctx context.Context, id string) (*model.Session, error) {
+	return nil, nil
+}
+
+type fakeTOTP struct {
+	repository.TOTP
+	credential *model.TOTPCredential
+}
+
+func (r *fakeTOTP) Find(ctx context.Context, userID string) (*model.TOTPCredential, error) {
+	return r.credential, nil
+}
+
+type fakeAudit struct {
+	repository.Audit
+}
+
+func (r *fakeAudit) Record(ctx context.Context, event *model.AuditEvent) error {
+	return nil
+}
+
+const magicLinkEmail = "alice@example.com"
+
+func newTestMagicLink(totp *model.TOTPCredential) (MagicLink, *fakeKV, *fakeMailer) {
+	kv := &fakeKV{now: time.Now(), values: map[string]string{}, expires: map[string]time.Time{}}
+	mail := &fakeMailer{}
+	user := &model.User{ID: "user-1", Name: "alice", Email: magicLinkEmail, EmailVerified: true}
+	usecase := NewMagicLink(&fakeSessions{}, &fakeUsers{user: user}, repository.NewMagicLink(kv), &fakeTOTP{credential: totp}, &fakeAudit{}, mail, MagicLinkOptions{
+		Enabled:    true,
+		URL:        "https://example.com/auth/magic-link",
+		TTL:        15 * time.Minute,
+		RateLimit:  2,
+		RateWindow: time.Hour,
+	})
+	return usecase, kv, mail
+}
+
+// sendLink requests a link for the test user and returns the token in the mail.
+func sendLink(t *testing.T, usecase MagicLink, mail *fakeMailer) string {
+	t.Helper()
+	if err := usecase.Send(context.Background(), dtos.SendRequest{Email: magicLinkEmail}); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	if len(mail.sent) == 0 {
+		t.Fatal("no mail sent")
+	}
+	for _, field := range strings.Fields(mail.sent[len(mail.sent)-1].Body) {
+		if link, err := url.Parse(field); err == nil && link.Query().Has("token") {
+			return link.Query().Get("token")
+		}
+	}
+	t.Fatal("no link in the mail")
+	return ""
+}
+
+func redeemLink(usecase MagicLink, token string) (*dtos.LoginResponse, error) {
+	return usecase.Login(context.Background(), dtos.LoginRequest{Token: token})
+}
+
+func TestMagicLinkLogin(t *testing.T) {
+	usecase, _, mail := newTestMagicLink(nil)
+
+	result, err := redeemLink(usecase, sendLink(t, usecase, mail))
+	if err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+	if result.Session.UserID != "user-1" || !result.Session.Authenticated {
+		t.Errorf("session = %+v, want an authenticated session of user-1", result.Session)
+	}
+}
+
+func TestMagicLinkExpiredToken(t *testing.T) {
+	usecase, kv, mail := newTestMagicLink(nil)
+	token := sendLink(t, usecase, mail)
+
+	kv.now = kv.now.Add(15 * time.Minute)
+	if _, err := redeemLink(usecase, token); err != dtos.ErrInvalidToken {
+		t.Errorf("Login: err = %v, want %v", err, dtos.ErrInvalidToken)
+	}
+}
+
+func TestMagicLinkReusedToken(t *testing.T) {
+	usecase, _, mail := newTestMagicLink(nil)
+	token := sendLink(t, usecase, mail)
+
+	if _, err := redeemLink(usecase, token); err != nil {
+		t.Fatalf("first Login: %v", err)
+	}
+	if _, err := redeemLink(usecase, token); err != dtos.ErrInvalidToken {
+		t.Errorf("second Login: err = %v, want %v", err, dtos.ErrInvalidToken)
+	}
+}
+
+func TestMagicLinkRateLimit(t *testing.T) {
+	usecase, kv, mail := newTestMagicLink(nil)
+	sendLink(t, usecase, mail)
+	sendLink(t, usecase, mail)
+
+	if err := usecase.Send(context.Background(), dtos.SendRequest{Email: magicLinkEmail}); err != dtos.ErrRateLimited {
+		t.Errorf("third Send: err = %v, want %v", err, dtos.ErrRateLimited)
+	}
+	// 上限はアドレスごと
+	if err := usecase.Send(context.Background(), dtos.SendRequest{Email: "bob@example.com"}); err != nil {
+		t.Errorf("Send to another address: %v", err)
+	}
+	kv.now = kv.now.Add(time.Hour)
+	sendLink(t, usecase, mail)
+}
+
+func TestMagicLinkSecondFactor(t *testing.T) {
+	usecase, _, mail := newTestMagicLink(&model.TOTPCredential{UserID: "user-1", Policy: model.TOTPPolicySecondFactor})
+
+	result, err := redeemLink(usecase, sendLink(t, usecase, mail))
+	if err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+	if !result.Session.SecondFactorRequired || result.Session.Authenticated {
+		t.Errorf("session = %+v, want one waiting for the second factor", result.Session)
+	}
+}
@@ -0,0 +1,520 @@
+package usecase
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/kobayashiyabako16g/passkey-auth-example/internal/domain/model"
+	"github.com/kobayashiyabako16g/passkey-auth-example/internal/domain/repository"
+	dtos "github.com/kobayashiyabako16g/passkey-auth-example/internal/usecase/dto/oidc"
+	"github.com/kobayashiyabako16g/passkey-auth-example/pkg/jws"
+	"github.com/kobayashiyabako16g/passkey-auth-example/pkg/logger"
+)
+
+// OIDC is an OpenID Connect provider supporting the authorization code flow with PKCE
+// and the device authorization grant. Users sign in with the passkey login ceremonies of Auth.
+type OIDC interface {
+	Authorize(ctx context.Context, dto dtos.AuthorizeRequest) (*dtos.AuthorizeResponse, error)
+	CompleteAuthorization(ctx context.Context, dto dtos.CompleteAuthorizationRequest) (*dtos.AuthorizeResponse, error)
+	Token(ctx context.Context, dto dtos.TokenRequest) (*dtos.TokenResponse, error)
+	UserInfo(ctx context.Context, dto dtos.UserInfoRequest) (*dtos.UserInfoResponse, error)
+	Introspect(ctx context.Context, dto dtos.IntrospectRequest) (*dtos.IntrospectResponse, error)
+	Revoke(ctx context.Context, dto dtos.RevokeRequest) error
+	Discovery(ctx context.Context) *dtos.DiscoveryResponse
+	DeviceAuthorization(ctx context.Context, dto dtos.DeviceAuthorizationRequest) (*dtos.DeviceAuthorizationResponse, error)
+	DeviceInfo(ctx context.Context, dto dtos.DeviceInfoRequest) (*dtos.DeviceInfoResponse, error)
+	ApproveDevice(ctx context.Context, dto dtos.ApproveDeviceRequest) error
+}
+
+// OIDCOptions configures the OpenID Connect provider.
+type OIDCOptions struct {
+	// Issuer is the public URL of the API. Endpoints are relative to it.
+	Issuer string
+	// LoginURL is the frontend page that runs the passkey login for a pending request.
+	LoginURL          string
+	RequestTTL        time.Duration
+	CodeTTL           time.Duration
+	AccessTokenTTL    time.Duration
+	IDTokenTTL        time.Duration
+	SigningAlgorithms []string
+	// DeviceVerificationURL is the frontend page where the user enters a device's user code.
+	DeviceVerificationURL string
+	DeviceCodeTTL         time.Duration
+	DevicePollInterval    time.Duration
+}
+
+// supportedScopes are the scopes the provider understands. Others are dropped.
+var supportedScopes = []string{"openid", "profile"}
+
+type oidc struct {
+	sr      repository.Session
+	ur      repository.User
+	clients repository.OAuthClient
+	ar      repository.Authorization
+	dg      repository.DeviceGrant
+	signer  jws.Signer
+	opts    OIDCOptions
+}
+
+func NewOIDC(sr repository.Session, ur repository.User, clients repository.OAuthClient, ar repository.Authorization, dg repository.DeviceGrant, signer jws.Signer, opts OIDCOptions) OIDC {
+	return &oidc{
+		sr:      sr,
+		ur:      ur,
+		clients: clients,
+		ar:      ar,
+		dg:      dg,
+		signer:  signer,
+		opts:    opts,
+	}
+}
+
+func (o *oidc) Authorize(ctx context.Context, dto dtos.AuthorizeRequest) (*dtos.AuthorizeResponse, error) {
+	client, err := o.clients.FindById(ctx, dto.ClientID)
+	if err != nil {
+		logger.Error(ctx, "can't get client", logger.WithError(err))
+		return nil, err
+	}
+	if client == nil || !client.AllowsRedirectURI(dto.RedirectURI) {
+		logger.Info(ctx, "unknown client or redirect uri", "client_id", dto.ClientID)
+		return nil, dtos.ErrInvalidClient
+	}
+
+	// ここから先のエラーはクライアントにリダイレクトで返す
+	fail := func(code string, description string) *dtos.AuthorizeResponse {
+		return &dtos.AuthorizeResponse{RedirectTo: o.redirectURI(dto.RedirectURI, url.Values{
+			"error":             {code},
+			"error_description": {description},
+			"state":             {dto.State},
+		})}
+	}
+
+	if dto.ResponseType != "code" {
+		return fail("unsupported_response_type", "only the code response type is supported"), nil
+	}
+	scope := filterScope(strings.Fields(dto.Scope))
+	if !slices.Contains(scope, "openid") {
+		return fail("invalid_scope", "the openid scope is required"), nil
+	}
+	if dto.CodeChallenge == "" || dto.CodeChallengeMethod != "S256" {
+		return fail("invalid_request", "PKCE with the S256 method is required"), nil
+	}
+	maxAge := int64(-1)
+	if dto.MaxAge != "" {
+		maxAge, err = strconv.ParseInt(dto.MaxAge, 10, 64)
+		if err != nil || maxAge < 0 {
+			return fail("invalid_request", "max_age is invalid"), nil
+		}
+	}
+	prompt := strings.Fields(dto.Prompt)
+
+	now := time.Now()
+	request := &model.AuthorizationRequest{
+		ClientID:      client.ID,
+		RedirectURI:   dto.RedirectURI,
+		Scope:         scope,
+		State:         dto.State,
+		Nonce:         dto.Nonce,
+		CodeChallenge: dto.CodeChallenge,
+		MaxAge:        maxAge,
+		CreatedAt:     now,
+		ExpiresAt:     now.Add(o.opts.RequestTTL),
+	}
+	if slices.Contains(prompt, "login") {
+		request.Prompt = "login"
+	}
+
+	// サインイン済みならそのままコードを発行する
+	session, err := o.sr.Get(ctx, dto.Session)
+	if err != nil {
+		logger.Error(ctx, "can't get session", logger.WithError(err))
+		return nil, err
+	}
+	if session != nil && session.Authenticated && satisfies(request, session, now) {
+		return o.issueCode(ctx, request, session)
+	}
+	if slices.Contains(prompt, "none") {
+		return fail("login_required", "the user must sign in"), nil
+	}
+
+	if err := o.ar.SaveRequest(ctx, request); err != nil {
+		logger.Error(ctx, "can't save authorization request", logger.WithError(err))
+		return nil, err
+	}
+
+	loginURL, err := url.Parse(o.opts.LoginURL)
+	if err != nil {
+		return nil, err
+	}
+	query := loginURL.Query()
+	query.Set("request", request.ID)
+	loginURL.RawQuery = query.Encode()
+	return &dtos.AuthorizeResponse{RedirectTo: loginURL.String()}, nil
+}
+
+// CompleteAuthorization issues the code once the user signed in on the login page.
+func (o *oidc) CompleteAuthorization(ctx context.Context, dto dtos.CompleteAuthorizationRequest) (*dtos.AuthorizeResponse, error) {
+	// 同時に完了しても認可コードは一度だけ発行する
+	request, err := o.ar.ConsumeRequest(ctx, dto.Request)
+	if err != nil {
+		logger.Error(ctx, "can't get authorization request", logger.WithError(err))
+		return nil, err
+	}
+	if request == nil {
+		return nil, dtos.ErrRequestNotFound
+	}
+	if !satisfies(request, dto.Session, time.Now()) {
+		logger.Info(ctx, "session doesn't satisfy the authorization request")
+		// ログインし直してから再度完了できるように戻す
+		if err := o.ar.SaveRequest(ctx, request); err != nil {
+			logger.Error(ctx, "can't save authorization request", logger.WithError(err))
+			return nil, err
+		}
+		return nil, dtos.ErrLoginRequired
+	}
+
+	return o.issueCode(ctx, request, dto.Session)
+}
+
+func (o *oidc) issueCode(ctx context.Context, request *model.AuthorizationRequest, session *model.Session) (*dtos.AuthorizeResponse, error) {
+	// クライアントはこのセッションをイントロスペクト・失効できるようになる
+	if !session.IssuedTo(request.ClientID) {
+		session.ClientIDs = append(session.ClientIDs, request.ClientID)
+		if err := o.sr.Save(ctx, session); err != nil {
+			logger.Error(ctx, "can't save session", logger.WithError(err))
+			return nil, err
+		}
+	}
+
+	code := &model.AuthorizationCode{
+		ClientID:      request.ClientID,
+		RedirectURI:   request.RedirectURI,
+		UserID:        session.UserID,
+		Scope:         request.Scope,
+		Nonce:         request.Nonce,
+		CodeChallenge: request.CodeChallenge,
+		AMR:           session.AMR,
+		AuthTime:      session.AuthTime,
+		ExpiresAt:     time.Now().Add(o.opts.CodeTTL),
+	}
+	if err := o.ar.CreateCode(ctx, code); err != nil {
+		logger.Error(ctx, "can't create authorization code", logger.WithError(err))
+		return nil, err
+	}
+
+	logger.Info(ctx, "Issued authorization code", "client_id", request.ClientID, "user_id", session.UserID)
+	return &dtos.AuthorizeResponse{RedirectTo: o.redirectURI(request.RedirectURI, url.Values{
+		"code":  {code.Code},
+		"state": {request.State},
+	})}, nil
+}
+
+func (o *oidc) Token(ctx context.Context, dto dtos.TokenRequest) (*dtos.TokenResponse, error) {
+	client, err := o.authenticateClient(ctx, dto.ClientID, dto.ClientSecret, true)
+	if err != nil {
+		return nil, err
+	}
+	if client.ResourceServer {
+		return nil, dtos.ErrUnauthorizedClient
+	}
+
+	var grant *tokenGrant
+	switch dto.GrantType {
+	case grantTypeAuthorizationCode:
+		grant, err = o.exchangeCode(ctx, client, dto)
+	case grantTypeDeviceCode:
+		grant, err = o.exchangeDeviceCode(ctx, client, dto)
+	default:
+		return nil, dtos.ErrUnsupportedGrantType
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := o.ur.FindById(ctx, grant.userID)
+	if err != nil {
+		logger.Error(ctx, "can't get user", logger.WithError(err))
+		return nil, err
+	}
+	if user == nil {
+		return nil, dtos.ErrInvalidGrant
+	}
+
+	return o.issueTokens(ctx, client, user, grant)
+}
+
+const (
+	grantTypeAuthorizationCode = "authorization_code"
+	grantTypeDeviceCode        = "urn:ietf:params:oauth:grant-type:device_code"
+)
+
+// tokenGrant is what a grant proves about the user.
+type tokenGrant struct {
+	userID   string
+	scope    []string
+	nonce    string
+	amr      []string
+	authTime time.Time
+}
+
+func (o *oidc) exchangeCode(ctx context.Context, client *model.OAuthClient, dto dtos.TokenRequest) (*tokenGrant, error) {
+	if dto.Code == "" || dto.CodeVerifier == "" {
+		return nil, dtos.ErrInvalidRequest
+	}
+
+	code, err := o.ar.ConsumeCode(ctx, dto.Code)
+	if err != nil {
+		logger.Error(ctx, "can't consume authorization code", logger.WithError(err))
+		return nil, err
+	}
+	if code == nil || code.ClientID != client.ID || code.RedirectURI != dto.RedirectURI {
+		logger.Info(ctx, "authorization code is invalid", "client_id", client.ID)
+		return nil, dtos.ErrInvalidGrant
+	}
+	if !verifyCodeChallenge(dto.CodeVerifier, code.CodeChallenge) {
+		logger.Info(ctx, "code verifier doesn't match", "client_id", client.ID)
+		return nil, dtos.ErrInvalidGrant
+	}
+
+	return &tokenGrant{
+		userID:   code.UserID,
+		scope:    code.Scope,
+		nonce:    code.Nonce,
+		amr:      code.AMR,
+		authTime: code.AuthTime,
+	}, nil
+}
+
+// issueTokens signs an access token for the client, and an ID token when openid was granted.
+func (o *oidc) issueTokens(ctx context.Context, client *model.OAuthClient, user *model.User, grant *tokenGrant) (*dtos.TokenResponse, error) {
+	now := time.Now()
+	scope := strings.Join(grant.scope, " ")
+	accessToken, err := o.signer.Sign(jws.AccessClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        uuid.NewString(),
+			Issuer:    o.opts.Issuer,
+			Subject:   user.ID,
+			Audience:  jwt.ClaimStrings{client.ID},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(o.opts.AccessTokenTTL)),
+		},
+		AMR:      grant.amr,
+		AuthTime: grant.authTime.Unix(),
+		Scope:    scope,
+		ClientID: client.ID,
+	})
+	if err != nil {
+		logger.Error(ctx, "can't sign access token", logger.WithError(err))
+		return nil, err
+	}
+
+	res := &dtos.TokenResponse{
+		AccessToken: accessToken,
+		ExpiresIn:   int64(o.opts.AccessTokenTTL.Seconds()),
+		Scope:       scope,
+	}
+	if slices.Contains(grant.scope, "openid") {
+		idClaims := jws.IDClaims{
+			RegisteredClaims: jwt.RegisteredClaims{
+				Issuer:    o.opts.Issuer,
+				Subject:   user.ID,
+				Audience:  jwt.ClaimStrings{client.ID},
+				IssuedAt:  jwt.NewNumericDate(now),
+				ExpiresAt: jwt.NewNumericDate(now.Add(o.opts.IDTokenTTL)),
+			},
+			AMR:      grant.amr,
+			AuthTime: grant.authTime.Unix(),
+			Nonce:    grant.nonce,
+		}
+		if slices.Contains(grant.scope, "profile") {
+			idClaims.Name = user.DisplayName
+			idClaims.PreferredUsername = user.Name
+		}
+		res.IDToken, err = o.signer.Sign(idClaims)
+		if err != nil {
+			logger.Error(ctx, "can't sign id token", logger.WithError(err))
+			return nil, err
+		}
+	}
+
+	logger.Info(ctx, "Issued tokens to client", "client_id", client.ID, "user_id", user.ID)
+	return res, nil
+}
+
+func (o *oidc) UserInfo(ctx context.Context, dto dtos.UserInfoRequest) (*dtos.UserInfoResponse, error) {
+	var claims jws.AccessClaims
+	if err := o.signer.Verify(dto.AccessToken, &claims); err != nil {
+		logger.Info(ctx, "access token is invalid", logger.WithError(err))
+		return nil, dtos.ErrInvalidToken
+	}
+	// パスキーログインで発行したトークンにはクライアントとスコープがない
+	if claims.Issuer != o.opts.Issuer || claims.ClientID == "" {
+		return nil, dtos.ErrInvalidToken
+	}
+	scope := strings.Fields(claims.Scope)
+	if !slices.Contains(scope, "openid") {
+		return nil, dtos.ErrInsufficientScope
+	}
+
+	user, err := o.ur.FindById(ctx, claims.Subject)
+	if err != nil {
+		logger.Error(ctx, "can't get user", logger.WithError(err))
+		return nil, err
+	}
+	if user == nil {
+		return nil, dtos.ErrInvalidToken
+	}
+
+	return &dtos.UserInfoResponse{User: user, Scope: scope}, nil
+}
+
+// Introspect describes a session ID to a resource server. Sessions a relying party wasn't
+// authorized with are inactive to it; first-party resource servers see every session.
+func (o *oidc) Introspect(ctx context.Context, dto dtos.IntrospectRequest) (*dtos.IntrospectResponse, error) {
+	client, err := o.authenticateClient(ctx, dto.ClientID, dto.ClientSecret, false)
+	if err != nil {
+		return nil, err
+	}
+
+	session, err := o.sr.Get(ctx, dto.Token)
+	if err != nil {
+		logger.Error(ctx, "can't get session", logger.WithError(err))
+		return nil, err
+	}
+	if session == nil || !session.Authenticated {
+		return &dtos.IntrospectResponse{}, nil
+	}
+	// 他のクライアントのセッションは存在を明かさない
+	if !client.ResourceServer && !session.IssuedTo(client.ID) {
+		logger.Info(ctx, "session wasn't issued to the client", "client_id", client.ID)
+		return &dtos.IntrospectResponse{}, nil
+	}
+
+	logger.Info(ctx, "Introspected session", "client_id", client.ID, "user_id", session.UserID)
+	return &dtos.IntrospectResponse{Session: session}, nil
+}
+
+// Revoke deletes a session ID. Unknown tokens and sessions of other relying parties
+// aren't an error and are left alone (RFC 7009 2.2). Resource servers may revoke any session.
+func (o *oidc) Revoke(ctx context.Context, dto dtos.RevokeRequest) error {
+	client, err := o.authenticateClient(ctx, dto.ClientID, dto.ClientSecret, false)
+	if err != nil {
+		return err
+	}
+
+	session, err := o.sr.Get(ctx, dto.Token)
+	if err != nil {
+		logger.Error(ctx, "can't get session", logger.WithError(err))
+		return err
+	}
+	// 他のクライアントのセッションは失効させない (RFC 7009 2.1)
+	if session == nil || (!client.ResourceServer && !session.IssuedTo(client.ID)) {
+		return nil
+	}
+
+	if err := o.sr.Delete(ctx, session); err != nil {
+		logger.Error(ctx, "can't delete session", logger.WithError(err))
+		return err
+	}
+	logger.Info(ctx, "Revoked session", "client_id", client.ID, "user_id", session.UserID)
+	return nil
+}
+
+func (o *oidc) Discovery(ctx context.Context) *dtos.DiscoveryResponse {
+	return &dtos.DiscoveryResponse{
+		Issuer:                            o.opts.Issuer,
+		AuthorizationEndpoint:             o.opts.Issuer + "/oauth/authorize",
+		TokenEndpoint:                     o.opts.Issuer + "/oauth/token",
+		UserInfoEndpoint:                  o.opts.Issuer + "/oauth/userinfo",
+		JWKSURI:                           o.opts.Issuer + "/.well-known/jwks.json",
+		IntrospectionEndpoint:             o.opts.Issuer + "/oauth/introspect",
+		RevocationEndpoint:                o.opts.Issuer + "/oauth/revoke",
+		DeviceAuthorizationEndpoint:       o.opts.Issuer + "/oauth/device_authorization",
+		GrantTypesSupported:               []string{grantTypeAuthorizationCode, grantTypeDeviceCode},
+		IDTokenSigningAlgValuesSupported:  o.opts.SigningAlgorithms,
+		ScopesSupported:                   supportedScopes,
+		TokenEndpointAuthMethodsSupported: []string{"client_secret_basic", "client_secret_post", "none"},
+	}
+}
+
+// authenticateClient verifies the client credentials. Public clients have no secret,
+// so they are only accepted where PKCE protects the request.
+func (o *oidc) authenticateClient(ctx context.Context, clientID string, clientSecret string, allowPublic bool) (*model.OAuthClient, error) {
+	client, err := o.clients.FindById(ctx, clientID)
+	if err != nil {
+		logger.Error(ctx, "can't get client", logger.WithError(err))
+		return nil, err
+	}
+	if client == nil {
+		logger.Info(ctx, "client not found", "client_id", clientID)
+		return nil, dtos.ErrInvalidClient
+	}
+	if client.Public() {
+		if !allowPublic {
+			logger.Info(ctx, "public client isn't allowed", "client_id", clientID)
+			return nil, dtos.ErrInvalidClient
+		}
+		return client, nil
+	}
+	if !client.VerifySecret(clientSecret) {
+		logger.Info(ctx, "client authentication failed", "client_id", clientID)
+		return nil, dtos.ErrInvalidClient
+	}
+	return client, nil
+}
+
+// redirectURI appends the parameters to the client's redirect URI, with iss (RFC 9207).
+func (o *oidc) redirectURI(redirectURI string, params url.Values) string {
+	u, err := url.Parse(redirectURI)
+	if err != nil {
+		return redirectURI
+	}
+	query := u.Query()
+	for k, v := range params {
+		if len(v) > 0 && v[0] != "" {
+			query.Set(k, v[0])
+		}
+	}
+	query.Set("iss", o.opts.Issuer)
+	u.RawQuery = query.Encode()
+	return u.String()
+}
+
+// satisfies reports whether the session meets prompt=login and max_age of the request.
+func satisfies(request *model.AuthorizationRequest, session *model.Session, now time.Time) bool {
+	if request.Prompt == "login" && session.AuthTime.Before(request.CreatedAt) {
+		return false
+	}
+	if request.MaxAge >= 0 && now.Sub(session.AuthTime) > time.Duration(request.MaxAge)*time.Second {
+		return false
+	}
+	return true
+}
+
+func filterScope(scope []string) []string {
+	filtered := make([]string, 0, len(scope))
+	for _, s := range scope {
+		if slices.Contains(supportedScopes, s) && !slices.Contains(filtered, s) {
+			filtered = append(filtered, s)
+		}
+	}
+	return filtered
+}
+
+// verifyCodeChallenge checks the PKCE verifier with the S256 method (RFC 7636).
+func verifyCodeChallenge(verifier string, challenge string) bool {
+	if len(verifier) < 43 || len(verifier) > 128 {
+		return false
+	}
+	sum := sha256.Sum256([]byte(verifier))
+	expected := base64.RawURLEncoding.EncodeToString(sum[:])
+	return subtle.ConstantTimeCompare([]byte(expected), []byte(challenge)) == 1
+}
@@ -0,0 +1,41 @@
+package usecase
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"strings"
+	"testing"
+)
+
+func s256(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func TestVerifyCodeChallenge(t *testing.T) {
+	// RFC 7636 Appendix B の例
+	const verifier = "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	const challenge = "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"
+
+	tests := []struct {
+		name      string
+		verifier  string
+		challenge string
+		want      bool
+	}{
+		{"rfc 7636 example", verifier, challenge, true},
+		{"other verifier", strings.Repeat("a", 43), challenge, false},
+		{"plain method", verifier, verifier, false},
+		{"empty challenge", verifier, "", false},
+		{"empty verifier", "", s256(""), false},
+		{"42 characters", strings.Repeat("a", 42), s256(strings.Repeat("a", 42)), false},
+		{"43 characters", strings.Repeat("a", 43), s256(strings.Repeat("a", 43)), true},
+		{"128 characters", strings.Repeat("a", 128), s256(strings.Repeat("a", 128)), true},
+		{"129 characters", strings.Repeat("a", 129), s256(strings.Repeat("a", 129)), false},
+	}
+	for _, tt := range tests {
+		if got := verifyCodeChallenge(tt.verifier, tt.challenge); got != tt.want {
+			t.Errorf("%s: verifyCodeChallenge = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
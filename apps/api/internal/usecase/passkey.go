@@ -0,0 +1,263 @@
+package usecase
+
+import (
+	"context"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/kobayashiyabako16g/passkey-auth-example/internal/domain/model"
+	"github.com/kobayashiyabako16g/passkey-auth-example/internal/domain/repository"
+	dtos "github.com/kobayashiyabako16g/passkey-auth-example/internal/usecase/dto/passkey"
+	"github.com/kobayashiyabako16g/passkey-auth-example/pkg/logger"
+)
+
+// Passkey manages the credentials of a signed-in user.
+type Passkey interface {
+	BeginAddCredential(ctx context.Context, dto dtos.BeginAddCredentialRequest) (*dtos.BeginAddCredentialResponse, error)
+	FinishAddCredential(ctx context.Context, dto dtos.FinishAddCredentialRequest) (*dtos.FinishAddCredentialResponse, error)
+	ListCredentials(ctx context.Context, dto dtos.ListCredentialsRequest) (*dtos.ListCredentialsResponse, error)
+	RenameCredential(ctx context.Context, dto dtos.RenameCredentialRequest) error
+	DeleteCredential(ctx context.Context, dto dtos.DeleteCredentialRequest) error
+}
+
+// maxCredentialNameLength is the maximum number of characters of a credential name.
+const maxCredentialNameLength = 64
+
+type passkey struct {
+	sr       repository.Session
+	cr       repository.Ceremony
+	ur       repository.User
+	pr       repository.Password
+	tr       repository.TOTP
+	rcr      repository.RecoveryCode
+	audit    repository.Audit
+	webAuthn *webauthn.WebAuthn
+}
+
+func NewPasskey(sr repository.Session, cr repository.Ceremony, ur repository.User, pr repository.Password, tr repository.TOTP, rcr repository.RecoveryCode, audit repository.Audit, webAuthn *webauthn.WebAuthn) Passkey {
+	return &passkey{
+		sr:       sr,
+		cr:       cr,
+		ur:       ur,
+		pr:       pr,
+		tr:       tr,
+		rcr:      rcr,
+		audit:    audit,
+		webAuthn: webAuthn,
+	}
+}
+
+func (p *passkey) BeginAddCredential(ctx context.Context, dto dtos.BeginAddCredentialRequest) (*dtos.BeginAddCredentialResponse, error) {
+	user := dto.User
+
+	// パスワードログイン直後はパスワードマネージャーが確認なしでパスキーを作成できる
+	mediation := protocol.MediationDefault
+	if dto.Conditional {
+		mediation = protocol.MediationConditional
+	}
+
+	// 登録済みのクレデンシャルは隔離中のものも含めて除外する (credential_id は一意)
+	registered, err := p.ur.ListCredentials(ctx, user.ID)
+	if err != nil {
+		logger.Error(ctx, "can't list credentials", logger.WithError(err))
+		return nil, err
+	}
+	exclusions := make(webauthn.Credentials, 0, len(registered))
+	for _, c := range registered {
+		exclusions = append(exclusions, c.Credential)
+	}
+
+	options, sessionData, err := p.webAuthn.BeginMediatedRegistration(user,
+		mediation,
+		webauthn.WithResidentKeyRequirement(protocol.ResidentKeyRequirementRequired),
+		webauthn.WithExclusions(exclusions.CredentialDescriptors()),
+		webauthn.WithExtensions(map[string]any{"credProps": true}))
+	if err != nil {
+		logger.Error(ctx, "Error beginning registration", logger.WithError(err))
+		return nil, err
+	}
+
+	ceremony, err := p.cr.Create(ctx)
+	if err != nil {
+		logger.Error(ctx, "Failed to create ceremony", logger.WithError(err))
+		return nil, err
+	}
+
+	ceremony.UserID = user.ID
+	ceremony.Username = user.Name
+	ceremony.RegistrationData = sessionData
+	if err := p.cr.Save(ctx, ceremony); err != nil {
+		logger.Error(ctx, "Failed to store challenge", logger.WithError(err))
+		return nil, err
+	}
+
+	return &dtos.BeginAddCredentialResponse{Cred: options, Ceremony: ceremony}, nil
+}
+
+func (p *passkey) FinishAddCredential(ctx context.Context, dto dtos.FinishAddCredentialRequest) (*dtos.FinishAddCredentialResponse, error) {
+	user := dto.User
+
+	ceremony, err := p.cr.Consume(ctx, dto.Ceremony)
+	if err != nil {
+		logger.Error(ctx, "can't get ceremony", logger.WithError(err))
+		return nil, err
+	}
+	if ceremony == nil || ceremony.RegistrationData == nil || ceremony.UserID != user.ID {
+		logger.Info(ctx, "registration data is nil")
+		return nil, dtos.ErrSessionNotFound
+	}
+
+	credential, err := p.webAuthn.FinishRegistration(user, *ceremony.RegistrationData, dto.Request)
+	if err != nil {
+		logger.Error(ctx, "can't finish registration", logger.WithError(err))
+		return nil, dtos.ErrFinishRegistration
+	}
+
+	if err := p.ur.AddCredential(ctx, user.ID, credential); err != nil {
+		logger.Error(ctx, "can't add credential", logger.WithError(err))
+		return nil, err
+	}
+
+	// パスキーができたアカウントのパスワードは廃止する
+	retired, err := p.pr.Retire(ctx, user.ID)
+	if err != nil {
+		logger.Error(ctx, "can't retire password", logger.WithError(err))
+		return nil, err
+	}
+	if retired {
+		if err := p.audit.Record(ctx, &model.AuditEvent{
+			UserID:    user.ID,
+			Event:     model.AuditPasswordRetired,
+			IP:        dto.IP,
+			UserAgent: dto.UserAgent,
+		}); err != nil {
+			logger.Error(ctx, "can't record audit event", logger.WithError(err))
+			return nil, err
+		}
+		logger.Info(ctx, "Retired password", "user_id", user.ID)
+	}
+
+	// リカバリー (リカバリーコード・TOTP・マジックリンク) のセッションは新しいパスキーの登録で通常のセッションになる。
+	// 二要素目が必須のアカウントは TOTP のコードを確認するまで認証済みにしない
+	res := &dtos.FinishAddCredentialResponse{}
+	if session := dto.Session; session != nil && session.EnrollmentRequired {
+		res.SecondFactorRequired, err = requiresSecondFactor(ctx, p.tr, user.ID)
+		if err != nil {
+			return nil, err
+		}
+		info := session.Info()
+		info.EnrollmentRequired = false
+		info.SecondFactorRequired = res.SecondFactorRequired
+		res.Session, err = rotateSession(ctx, p.sr, user, session, info)
+		if err != nil {
+			return nil, err
+		}
+		logger.Info(ctx, "Enrolled a passkey after recovery", "user_id", user.ID, "second_factor_required", res.SecondFactorRequired)
+	}
+
+	return res, nil
+}
+
+func (p *passkey) ListCredentials(ctx context.Context, dto dtos.ListCredentialsRequest) (*dtos.ListCredentialsResponse, error) {
+	user := dto.User
+
+	credentials, err := p.ur.ListCredentials(ctx, user.ID)
+	if err != nil {
+		logger.Error(ctx, "can't list credentials", logger.WithError(err))
+		return nil, err
+	}
+
+	return &dtos.ListCredentialsResponse{Credentials: credentials}, nil
+}
+
+func (p *passkey) RenameCredential(ctx context.Context, dto dtos.RenameCredentialRequest) error {
+	user := dto.User
+
+	name := strings.TrimSpace(dto.Name)
+	if name == "" || utf8.RuneCountInString(name) > maxCredentialNameLength {
+		logger.Info(ctx, "invalid credential name")
+		return dtos.ErrInvalidName
+	}
+
+	credential, err := p.ur.FindCredential(ctx, user.ID, dto.ID)
+	if err != nil {
+		logger.Error(ctx, "can't get credential", logger.WithError(err))
+		return err
+	}
+	if credential == nil {
+		return dtos.ErrCredentialNotFound
+	}
+
+	if err := p.ur.RenameCredential(ctx, user.ID, credential.ID, name); err != nil {
+		logger.Error(ctx, "can't rename credential", logger.WithError(err))
+		return err
+	}
+
+	return nil
+}
+
+func (p *passkey) DeleteCredential(ctx context.Context, dto dtos.DeleteCredentialRequest) error {
+	user := dto.User
+
+	credentials, err := p.ur.ListCredentials(ctx, user.ID)
+	if err != nil {
+		logger.Error(ctx, "can't list credentials", logger.WithError(err))
+		return err
+	}
+
+	var target *model.Credential
+	usable := 0
+	for i, c := range credentials {
+		if c.ID == dto.ID {
+			target = &credentials[i]
+		}
+		if !c.Quarantined() {
+			usable++
+		}
+	}
+	if target == nil {
+		return dtos.ErrCredentialNotFound
+	}
+
+	// 隔離中のパスキーはサインインに使えないので常に削除できる。
+	// 最後に使えるパスキーは、リカバリーコードか TOTP のリカバリーで登録し直せる場合だけ削除できる
+	if !target.Quarantined() && usable <= 1 {
+		recoverable, err := p.recoverable(ctx, user.ID)
+		if err != nil {
+			return err
+		}
+		if !recoverable {
+			logger.Info(ctx, "refuse to delete the last credential")
+			return dtos.ErrLastCredential
+		}
+	}
+
+	if err := p.ur.DeleteCredential(ctx, user.ID, dto.ID); err != nil {
+		logger.Error(ctx, "can't delete credential", logger.WithError(err))
+		return err
+	}
+
+	return nil
+}
+
+// recoverable reports whether the user can still enroll a passkey without one,
+// with an unused recovery code or a TOTP authenticator for recovery.
+func (p *passkey) recoverable(ctx context.Context, userID string) (bool, error) {
+	codes, err := p.rcr.ListUnused(ctx, userID)
+	if err != nil {
+		logger.Error(ctx, "can't list recovery codes", logger.WithError(err))
+		return false, err
+	}
+	if len(codes) > 0 {
+		return true, nil
+	}
+
+	credential, err := p.tr.Find(ctx, userID)
+	if err != nil {
+		logger.Error(ctx, "can't get totp", logger.WithError(err))
+		return false, err
+	}
+	return credential != nil && credential.Policy == model.TOTPPolicyRecovery, nil
+}
@@ -0,0 +1,197 @@
+package usecase
+
+import (
+	"context"
+	"sync"
+
+	"github.com/kobayashiyabako16g/passkey-auth-example/internal/domain/model"
+	"github.com/kobayashiyabako16g/passkey-auth-example/internal/domain/repository"
+	dtos "github.com/kobayashiyabako16g/passkey-auth-example/internal/usecase/dto/password"
+	"github.com/kobayashiyabako16g/passkey-auth-example/pkg/logger"
+)
+
+// Password signs in accounts migrated with a password until they have a passkey.
+// The client should offer a passkey right after, with a conditional create.
+type Password interface {
+	Login(ctx context.Context, dto dtos.LoginRequest) (*dtos.LoginResponse, error)
+}
+
+// passwordHashConcurrency is the number of argon2id hashes computed at once.
+// Each takes DefaultArgon2Params.Memory, so this bounds the memory of password logins.
+const passwordHashConcurrency = 4
+
+// dummyPassword is verified for unknown users, so the response time doesn't tell them apart.
+var dummyPassword = sync.OnceValue(func() *model.PasswordCredential {
+	hash, err := model.HashPassword("dummy")
+	if err != nil {
+		panic(err)
+	}
+	return &model.PasswordCredential{Hash: hash}
+})
+
+type password struct {
+	sr       repository.Session
+	ur       repository.User
+	pr       repository.Password
+	tr       repository.TOTP
+	attempts repository.LoginAttempt
+	audit    repository.Audit
+	// hashing is a semaphore of passwordHashConcurrency slots.
+	hashing chan struct{}
+}
+
+func NewPassword(sr repository.Session, ur repository.User, pr repository.Password, tr repository.TOTP, attempts repository.LoginAttempt, audit repository.Audit) Password {
+	return &password{
+		sr:       sr,
+		ur:       ur,
+		pr:       pr,
+		tr:       tr,
+		attempts: attempts,
+		audit:    audit,
+		hashing:  make(chan struct{}, passwordHashConcurrency),
+	}
+}
+
+func (p *password) Login(ctx context.Context, dto dtos.LoginRequest) (*dtos.LoginResponse, error) {
+	allowed, err := allowLoginAttempt(ctx, p.attempts, model.AMRPassword, dto.Username, dto.IP)
+	if err != nil {
+		return nil, err
+	}
+	if !allowed {
+		return nil, dtos.ErrTooManyAttempts
+	}
+
+	user, err := p.ur.FindByUsername(ctx, dto.Username)
+	if err != nil {
+		logger.Error(ctx, "can't get user", logger.WithError(err))
+		return nil, err
+	}
+	var credential *model.PasswordCredential
+	if user != nil {
+		credential, err = p.pr.Find(ctx, user.ID)
+		if err != nil {
+			logger.Error(ctx, "can't get password", logger.WithError(err))
+			return nil, err
+		}
+	}
+	if credential == nil {
+		if _, err := p.verify(ctx, dummyPassword(), dto.Password); err != nil {
+			return nil, err
+		}
+		logger.Info(ctx, "no password for user")
+		return nil, dtos.ErrInvalidCredentials
+	}
+
+	ok, err := p.verify(ctx, credential, dto.Password)
+	if err != nil {
+		logger.Error(ctx, "can't verify password", logger.WithError(err))
+		return nil, err
+	}
+	if !ok {
+		if err := p.record(ctx, user.ID, model.AuditPasswordLoginFailed, dto); err != nil {
+			return nil, err
+		}
+		logger.Info(ctx, "password doesn't match", "user_id", user.ID)
+		return nil, dtos.ErrInvalidCredentials
+	}
+
+	// パスキーがあるアカウントのパスワードは使えない
+	if len(user.Credentials) > 0 {
+		if _, err := p.pr.Retire(ctx, user.ID); err != nil {
+			logger.Error(ctx, "can't retire password", logger.WithError(err))
+			return nil, err
+		}
+		if err := p.record(ctx, user.ID, model.AuditPasswordRetired, dto); err != nil {
+			return nil, err
+		}
+		return nil, dtos.ErrPasswordRetired
+	}
+
+	// 移行元のパラメーターのハッシュは現在のパラメーターで置き換える
+	var rehash string
+	if credential.NeedsRehash() {
+		if err := p.acquire(ctx); err != nil {
+			return nil, err
+		}
+		rehash, err = model.HashPassword(dto.Password)
+		p.release()
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err := p.pr.MarkUsed(ctx, user.ID, rehash); err != nil {
+		logger.Error(ctx, "can't update password", logger.WithError(err))
+		return nil, err
+	}
+	if err := p.record(ctx, user.ID, model.AuditPasswordLogin, dto); err != nil {
+		return nil, err
+	}
+
+	// 以前のセッションは破棄する
+	previous, err := p.sr.Get(ctx, dto.Session)
+	if err != nil {
+		logger.Error(ctx, "can't get session", logger.WithError(err))
+		return nil, err
+	}
+	if previous != nil {
+		if err := p.sr.Delete(ctx, previous); err != nil {
+			logger.Error(ctx, "can't delete session", logger.WithError(err))
+			return nil, err
+		}
+	}
+
+	secondFactor, err := requiresSecondFactor(ctx, p.tr, user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	session, err := p.sr.Create(ctx, user, model.SessionInfo{
+		AMR:                  []string{model.AMRPassword},
+		IP:                   dto.IP,
+		UserAgent:            dto.UserAgent,
+		SecondFactorRequired: secondFactor,
+	})
+	if err != nil {
+		logger.Error(ctx, "can't create session", logger.WithError(err))
+		return nil, err
+	}
+
+	logger.Info(ctx, "Signed in with a password", "user_id", user.ID)
+	return &dtos.LoginResponse{Session: session}, nil
+}
+
+// verify checks the password within the hashing limit.
+func (p *password) verify(ctx context.Context, credential *model.PasswordCredential, password string) (bool, error) {
+	if err := p.acquire(ctx); err != nil {
+		return false, err
+	}
+	defer p.release()
+	return credential.Verify(password)
+}
+
+// acquire waits for a hashing slot until the request is canceled.
+func (p *password) acquire(ctx context.Context) error {
+	select {
+	case p.hashing <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (p *password) release() {
+	<-p.hashing
+}
+
+func (p *password) record(ctx context.Context, userID string, event model.AuditEventType, dto dtos.LoginRequest) error {
+	if err := p.audit.Record(ctx, &model.AuditEvent{
+		UserID:    userID,
+		Event:     event,
+		IP:        dto.IP,
+		UserAgent: dto.UserAgent,
+	}); err != nil {
+		logger.Error(ctx, "can't record audit event", logger.WithError(err))
+		return err
+	}
+	return nil
+}
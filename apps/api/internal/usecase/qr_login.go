@@ -0,0 +1,282 @@
+package usecase
+
+import (
+	"context"
+	"net/url"
+	"time"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/kobayashiyabako16g/passkey-auth-example/internal/domain/model"
+	"github.com/kobayashiyabako16g/passkey-auth-example/internal/domain/repository"
+	dtos "github.com/kobayashiyabako16g/passkey-auth-example/internal/usecase/dto/qrlogin"
+	"github.com/kobayashiyabako16g/passkey-auth-example/pkg/logger"
+	"github.com/kobayashiyabako16g/passkey-auth-example/pkg/useragent"
+)
+
+// QRLogin signs in a new browser with the approval of a device that is already signed in.
+// The new browser shows a QR code, and the device approves it with a fresh passkey assertion.
+type QRLogin interface {
+	Start(ctx context.Context, dto dtos.StartRequest) (*dtos.StartResponse, error)
+	// Wait long-polls until the request is approved or the wait times out.
+	Wait(ctx context.Context, dto dtos.WaitRequest) (*dtos.WaitResponse, error)
+	Info(ctx context.Context, dto dtos.InfoRequest) (*dtos.InfoResponse, error)
+	BeginApprove(ctx context.Context, dto dtos.BeginApproveRequest) (*dtos.BeginApproveResponse, error)
+	FinishApprove(ctx context.Context, dto dtos.FinishApproveRequest) error
+}
+
+// QRLoginOptions configures cross-device sign-in.
+type QRLoginOptions struct {
+	// ApproveURL is the frontend page the QR code opens on the signed-in device.
+	ApproveURL  string
+	TTL         time.Duration
+	WaitTimeout time.Duration
+}
+
+// qrLoginPollInterval is how often a waiting request checks the store.
+const qrLoginPollInterval = time.Second
+
+type qrLogin struct {
+	sr       repository.Session
+	cr       repository.Ceremony
+	ur       repository.User
+	qr       repository.QRLogin
+	webAuthn *webauthn.WebAuthn
+	opts     QRLoginOptions
+}
+
+func NewQRLogin(sr repository.Session, cr repository.Ceremony, ur repository.User, qr repository.QRLogin, webAuthn *webauthn.WebAuthn, opts QRLoginOptions) QRLogin {
+	return &qrLogin{
+		sr:       sr,
+		cr:       cr,
+		ur:       ur,
+		qr:       qr,
+		webAuthn: webAuthn,
+		opts:     opts,
+	}
+}
+
+func (q *qrLogin) Start(ctx context.Context, dto dtos.StartRequest) (*dtos.StartResponse, error) {
+	now := time.Now()
+	login := &model.QRLogin{
+		Status:    model.QRLoginPending,
+		IP:        dto.IP,
+		UserAgent: dto.UserAgent,
+		Device:    useragent.Parse(dto.UserAgent),
+		CreatedAt: now,
+		ExpiresAt: now.Add(q.opts.TTL),
+	}
+	if err := q.qr.Create(ctx, login); err != nil {
+		logger.Error(ctx, "can't create qr login", logger.WithError(err))
+		return nil, err
+	}
+
+	code := model.FormatUserCode(login.Code)
+	approveURL, err := url.Parse(q.opts.ApproveURL)
+	if err != nil {
+		return nil, err
+	}
+	query := approveURL.Query()
+	query.Set("code", code)
+	approveURL.RawQuery = query.Encode()
+
+	return &dtos.StartResponse{
+		Login:      login,
+		Code:       code,
+		ApproveURL: approveURL.String(),
+		ExpiresIn:  int64(q.opts.TTL.Seconds()),
+	}, nil
+}
+
+func (q *qrLogin) Wait(ctx context.Context, dto dtos.WaitRequest) (*dtos.WaitResponse, error) {
+	deadline := time.NewTimer(q.opts.WaitTimeout)
+	defer deadline.Stop()
+	ticker := time.NewTicker(qrLoginPollInterval)
+	defer ticker.Stop()
+
+	for {
+		login, err := q.qr.FindByID(ctx, dto.ID)
+		if err != nil {
+			logger.Error(ctx, "can't get qr login", logger.WithError(err))
+			return nil, err
+		}
+		if login == nil {
+			return nil, dtos.ErrLoginNotFound
+		}
+		if login.Status == model.QRLoginApproved {
+			return q.signIn(ctx, login, dto.Session)
+		}
+
+		select {
+		case <-ctx.Done():
+			// ブラウザが接続を切った
+			return &dtos.WaitResponse{}, nil
+		case <-deadline.C:
+			return &dtos.WaitResponse{}, nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// signIn issues the new browser a session of the approving user.
+func (q *qrLogin) signIn(ctx context.Context, login *model.QRLogin, previous string) (*dtos.WaitResponse, error) {
+	consumed, err := q.qr.Consume(ctx, login)
+	if err != nil {
+		logger.Error(ctx, "can't consume qr login", logger.WithError(err))
+		return nil, err
+	}
+	if !consumed {
+		return nil, dtos.ErrLoginNotFound
+	}
+
+	user, err := q.ur.FindById(ctx, login.UserID)
+	if err != nil {
+		logger.Error(ctx, "can't get user", logger.WithError(err))
+		return nil, err
+	}
+	if user == nil {
+		return nil, dtos.ErrLoginNotFound
+	}
+
+	if old, err := q.sr.Get(ctx, previous); err != nil {
+		logger.Error(ctx, "can't get session", logger.WithError(err))
+		return nil, err
+	} else if old != nil {
+		if err := q.sr.Delete(ctx, old); err != nil {
+			logger.Error(ctx, "can't delete session", logger.WithError(err))
+			return nil, err
+		}
+	}
+
+	// セッションは新しいブラウザのもの。認証の強さは承認したパスキーに由来する
+	session, err := q.sr.Create(ctx, user, model.SessionInfo{
+		CredentialID: login.CredentialID,
+		UserVerified: login.UserVerified,
+		AMR:          login.AMR,
+		IP:           login.IP,
+		UserAgent:    login.UserAgent,
+	})
+	if err != nil {
+		logger.Error(ctx, "can't create session", logger.WithError(err))
+		return nil, err
+	}
+
+	logger.Info(ctx, "Signed in with qr login", "user_id", user.ID)
+	return &dtos.WaitResponse{Session: session}, nil
+}
+
+// Info describes the new browser so the user can check it's theirs before approving.
+func (q *qrLogin) Info(ctx context.Context, dto dtos.InfoRequest) (*dtos.InfoResponse, error) {
+	login, err := q.findPending(ctx, dto.Code)
+	if err != nil {
+		return nil, err
+	}
+	return &dtos.InfoResponse{Login: login, Code: model.FormatUserCode(login.Code)}, nil
+}
+
+// BeginApprove starts a passkey assertion restricted to the credentials of the signed-in user.
+// The assertion only approves the login of the code it was started for.
+func (q *qrLogin) BeginApprove(ctx context.Context, dto dtos.BeginApproveRequest) (*dtos.BeginApproveResponse, error) {
+	login, err := q.findPending(ctx, dto.Code)
+	if err != nil {
+		return nil, err
+	}
+
+	options, sessionData, err := q.webAuthn.BeginLogin(dto.User,
+		webauthn.WithUserVerification(protocol.VerificationRequired))
+	if err != nil {
+		logger.Error(ctx, "can't begin login", logger.WithError(err))
+		return nil, err
+	}
+
+	ceremony, err := q.cr.Create(ctx)
+	if err != nil {
+		logger.Error(ctx, "can't create ceremony", logger.WithError(err))
+		return nil, err
+	}
+	ceremony.UserID = dto.User.ID
+	ceremony.QRLoginCode = login.Code
+	ceremony.AuthenticationData = sessionData
+	if err := q.cr.Save(ctx, ceremony); err != nil {
+		logger.Error(ctx, "can't save ceremony", logger.WithError(err))
+		return nil, err
+	}
+
+	return &dtos.BeginApproveResponse{Cred: options, Ceremony: ceremony}, nil
+}
+
+func (q *qrLogin) FinishApprove(ctx context.Context, dto dtos.FinishApproveRequest) error {
+	user := dto.User
+
+	ceremony, err := q.cr.Consume(ctx, dto.Ceremony)
+	if err != nil {
+		logger.Error(ctx, "can't get ceremony", logger.WithError(err))
+		return err
+	}
+	if ceremony == nil || ceremony.AuthenticationData == nil || ceremony.UserID != user.ID {
+		logger.Info(ctx, "authentication data is nil")
+		return dtos.ErrSessionNotFound
+	}
+
+	login, err := q.findPending(ctx, dto.Code)
+	if err != nil {
+		return err
+	}
+	// 別のコードのために始めたアサーションでは承認しない
+	if login.Code != ceremony.QRLoginCode {
+		logger.Info(ctx, "ceremony was started for another qr login")
+		return dtos.ErrSessionNotFound
+	}
+
+	validatedCredential, err := q.webAuthn.FinishLogin(user, *ceremony.AuthenticationData, dto.Request)
+	if err != nil {
+		logger.Info(ctx, "can't finish login", logger.WithError(err))
+		return dtos.ErrAssertionFailed
+	}
+
+	// 別のブラウザにセッションを渡すので、クローンの疑いがあれば承認しない
+	if validatedCredential.Authenticator.CloneWarning {
+		if err := rejectClone(ctx, q.ur, user.ID, validatedCredential); err != nil {
+			return err
+		}
+		return dtos.ErrCloneDetected
+	}
+	user.UpdateCredential(validatedCredential)
+	if err := q.ur.UpdateCredential(ctx, user.ID, validatedCredential); err != nil {
+		logger.Error(ctx, "can't save credential", logger.WithError(err))
+		return err
+	}
+
+	credential, err := q.ur.FindCredentialByCredentialID(ctx, user.ID, validatedCredential.ID)
+	if err != nil {
+		logger.Error(ctx, "can't get credential", logger.WithError(err))
+		return err
+	}
+
+	login.Status = model.QRLoginApproved
+	login.UserID = user.ID
+	login.UserVerified = validatedCredential.Flags.UserVerified
+	login.AMR = model.AMR(validatedCredential.Flags.BackupEligible)
+	if credential != nil {
+		login.CredentialID = credential.ID
+	}
+	if err := q.qr.Save(ctx, login); err != nil {
+		logger.Error(ctx, "can't save qr login", logger.WithError(err))
+		return err
+	}
+
+	logger.Info(ctx, "Approved qr login", "user_id", user.ID)
+	return nil
+}
+
+func (q *qrLogin) findPending(ctx context.Context, code string) (*model.QRLogin, error) {
+	login, err := q.qr.FindByCode(ctx, code)
+	if err != nil {
+		logger.Error(ctx, "can't get qr login", logger.WithError(err))
+		return nil, err
+	}
+	if login == nil || login.Status != model.QRLoginPending {
+		return nil, dtos.ErrLoginNotFound
+	}
+	return login, nil
+}
@@ -0,0 +1,230 @@
+package usecase
+
+import (
+	"context"
+	"sync"
+
+	"github.com/kobayashiyabako16g/passkey-auth-example/internal/domain/model"
+	"github.com/kobayashiyabako16g/passkey-auth-example/internal/domain/repository"
+	dtos "github.com/kobayashiyabako16g/passkey-auth-example/internal/usecase/dto/recovery"
+	"github.com/kobayashiyabako16g/passkey-auth-example/pkg/logger"
+	"github.com/kobayashiyabako16g/passkey-auth-example/pkg/random"
+)
+
+// RecoveryCodeIssuer generates sets of recovery codes. A new set replaces the old one.
+type RecoveryCodeIssuer struct {
+	rcr       repository.RecoveryCode
+	audit     repository.Audit
+	lookupKey []byte
+}
+
+func NewRecoveryCodeIssuer(rcr repository.RecoveryCode, audit repository.Audit, lookupKey []byte) *RecoveryCodeIssuer {
+	return &RecoveryCodeIssuer{rcr, audit, lookupKey}
+}
+
+// Issue returns the formatted codes. Only their hashes are stored.
+func (r *RecoveryCodeIssuer) Issue(ctx context.Context, userID string, ip string, userAgent string) ([]string, error) {
+	codes := make([]string, 0, model.RecoveryCodeCount)
+	stored := make([]model.RecoveryCode, 0, model.RecoveryCodeCount)
+	for range model.RecoveryCodeCount {
+		code, err := random.String(model.RecoveryCodeLength, model.UserCodeAlphabet)
+		if err != nil {
+			return nil, err
+		}
+		hash, err := model.HashRecoveryCode(code)
+		if err != nil {
+			logger.Error(ctx, "can't hash recovery code", logger.WithError(err))
+			return nil, err
+		}
+		codes = append(codes, model.FormatRecoveryCode(code))
+		stored = append(stored, model.RecoveryCode{CodeHash: hash, Lookup: r.lookup(userID, code)})
+	}
+
+	if err := r.rcr.Replace(ctx, userID, stored); err != nil {
+		logger.Error(ctx, "can't store recovery codes", logger.WithError(err))
+		return nil, err
+	}
+	if err := r.audit.Record(ctx, &model.AuditEvent{
+		UserID:    userID,
+		Event:     model.AuditRecoveryCodesGenerated,
+		IP:        ip,
+		UserAgent: userAgent,
+	}); err != nil {
+		logger.Error(ctx, "can't record audit event", logger.WithError(err))
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+func (r *RecoveryCodeIssuer) lookup(userID string, code string) string {
+	return model.RecoveryCodeLookup(r.lookupKey, userID, code)
+}
+
+// dummyRecoveryCode is verified when no code is a candidate, so the response time
+// doesn't tell unknown users apart.
+var dummyRecoveryCode = sync.OnceValue(func() *model.RecoveryCode {
+	hash, err := model.HashRecoveryCode("dummy")
+	if err != nil {
+		panic(err)
+	}
+	return &model.RecoveryCode{CodeHash: hash}
+})
+
+// Recovery lets a user who lost every passkey back in with a recovery code.
+// The session it issues only allows registering a new passkey.
+type Recovery interface {
+	Generate(ctx context.Context, dto dtos.GenerateRequest) (*dtos.GenerateResponse, error)
+	Status(ctx context.Context, dto dtos.StatusRequest) (*dtos.StatusResponse, error)
+	Login(ctx context.Context, dto dtos.LoginRequest) (*dtos.LoginResponse, error)
+}
+
+type recovery struct {
+	sr       repository.Session
+	ur       repository.User
+	rcr      repository.RecoveryCode
+	attempts repository.LoginAttempt
+	audit    repository.Audit
+	issuer   *RecoveryCodeIssuer
+}
+
+func NewRecovery(sr repository.Session, ur repository.User, rcr repository.RecoveryCode, attempts repository.LoginAttempt, audit repository.Audit, issuer *RecoveryCodeIssuer) Recovery {
+	return &recovery{
+		sr:       sr,
+		ur:       ur,
+		rcr:      rcr,
+		attempts: attempts,
+		audit:    audit,
+		issuer:   issuer,
+	}
+}
+
+func (r *recovery) Generate(ctx context.Context, dto dtos.GenerateRequest) (*dtos.GenerateResponse, error) {
+	codes, err := r.issuer.Issue(ctx, dto.User.ID, dto.IP, dto.UserAgent)
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Info(ctx, "Generated recovery codes", "user_id", dto.User.ID)
+	return &dtos.GenerateResponse{Codes: codes}, nil
+}
+
+func (r *recovery) Status(ctx context.Context, dto dtos.StatusRequest) (*dtos.StatusResponse, error) {
+	codes, err := r.rcr.ListUnused(ctx, dto.User.ID)
+	if err != nil {
+		logger.Error(ctx, "can't list recovery codes", logger.WithError(err))
+		return nil, err
+	}
+	return &dtos.StatusResponse{Remaining: len(codes)}, nil
+}
+
+func (r *recovery) Login(ctx context.Context, dto dtos.LoginRequest) (*dtos.LoginResponse, error) {
+	allowed, err := allowLoginAttempt(ctx, r.attempts, model.AMRRecoveryCode, dto.Username, dto.IP)
+	if err != nil {
+		return nil, err
+	}
+	if !allowed {
+		return nil, dtos.ErrTooManyAttempts
+	}
+
+	user, err := r.ur.FindByUsername(ctx, dto.Username)
+	if err != nil {
+		logger.Error(ctx, "can't get user", logger.WithError(err))
+		return nil, err
+	}
+	if user == nil {
+		dummyRecoveryCode().Verify(model.NormalizeUserCode(dto.Code))
+		logger.Info(ctx, "user not found")
+		return nil, dtos.ErrInvalidCode
+	}
+
+	code, err := r.spend(ctx, user.ID, model.NormalizeUserCode(dto.Code))
+	if err != nil {
+		return nil, err
+	}
+	if code == nil {
+		if err := r.record(ctx, user.ID, model.AuditRecoveryCodeFailed, dto); err != nil {
+			return nil, err
+		}
+		logger.Info(ctx, "recovery code doesn't match", "user_id", user.ID)
+		return nil, dtos.ErrInvalidCode
+	}
+	if err := r.record(ctx, user.ID, model.AuditRecoveryCodeUsed, dto); err != nil {
+		return nil, err
+	}
+
+	// 以前のセッションは破棄する
+	previous, err := r.sr.Get(ctx, dto.Session)
+	if err != nil {
+		logger.Error(ctx, "can't get session", logger.WithError(err))
+		return nil, err
+	}
+	if previous != nil {
+		if err := r.sr.Delete(ctx, previous); err != nil {
+			logger.Error(ctx, "can't delete session", logger.WithError(err))
+			return nil, err
+		}
+	}
+
+	session, err := r.sr.Create(ctx, user, model.SessionInfo{
+		AMR:                []string{model.AMRRecoveryCode},
+		IP:                 dto.IP,
+		UserAgent:          dto.UserAgent,
+		EnrollmentRequired: true,
+	})
+	if err != nil {
+		logger.Error(ctx, "can't create session", logger.WithError(err))
+		return nil, err
+	}
+
+	logger.Info(ctx, "Signed in with a recovery code", "user_id", user.ID)
+	return &dtos.LoginResponse{Session: session}, nil
+}
+
+// spend finds the unused code matching the input and marks it used.
+// It returns nil when no code matches.
+func (r *recovery) spend(ctx context.Context, userID string, input string) (*model.RecoveryCode, error) {
+	if len(input) != model.RecoveryCodeLength {
+		return nil, nil
+	}
+
+	// ルックアップで候補を絞り、通常は 1 つのハッシュだけを照合する
+	codes, err := r.rcr.FindUnused(ctx, userID, r.issuer.lookup(userID, input))
+	if err != nil {
+		logger.Error(ctx, "can't list recovery codes", logger.WithError(err))
+		return nil, err
+	}
+	if len(codes) == 0 {
+		dummyRecoveryCode().Verify(input)
+		return nil, nil
+	}
+	for i := range codes {
+		if !codes[i].Verify(input) {
+			continue
+		}
+		// 同時に使われた場合は先に記録した方だけが成功する
+		used, err := r.rcr.MarkUsed(ctx, codes[i].ID)
+		if err != nil {
+			logger.Error(ctx, "can't mark recovery code used", logger.WithError(err))
+			return nil, err
+		}
+		if !used {
+			return nil, nil
+		}
+		return &codes[i], nil
+	}
+	return nil, nil
+}
+
+func (r *recovery) record(ctx context.Context, userID string, event model.AuditEventType, dto dtos.LoginRequest) error {
+	if err := r.audit.Record(ctx, &model.AuditEvent{
+		UserID:    userID,
+		Event:     event,
+		IP:        dto.IP,
+		UserAgent: dto.UserAgent,
+	}); err != nil {
+		logger.Error(ctx, "can't record audit event", logger.WithError(err))
+		return err
+	}
+	return nil
+}
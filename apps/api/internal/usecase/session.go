@@ -0,0 +1,184 @@
+package usecase
+
+import (
+	"context"
+
+	"github.com/kobayashiyabako16g/passkey-auth-example/internal/domain/model"
+	"github.com/kobayashiyabako16g/passkey-auth-example/internal/domain/repository"
+	dtos "github.com/kobayashiyabako16g/passkey-auth-example/internal/usecase/dto/session"
+	"github.com/kobayashiyabako16g/passkey-auth-example/pkg/logger"
+)
+
+// Session manages the authenticated sessions of a user.
+type Session interface {
+	Logout(ctx context.Context, dto dtos.LogoutRequest) error
+	LogoutAll(ctx context.Context, dto dtos.LogoutAllRequest) error
+	ListSessions(ctx context.Context, dto dtos.ListSessionsRequest) (*dtos.ListSessionsResponse, error)
+	RevokeSession(ctx context.Context, dto dtos.RevokeSessionRequest) (*dtos.RevokeSessionResponse, error)
+	Me(ctx context.Context, dto dtos.MeRequest) (*dtos.MeResponse, error)
+	Verify(ctx context.Context, dto dtos.VerifyRequest) (*dtos.VerifyResponse, error)
+}
+
+type session struct {
+	sr repository.Session
+	ur repository.User
+	rr repository.RefreshToken
+}
+
+func NewSession(sr repository.Session, ur repository.User, rr repository.RefreshToken) Session {
+	return &session{sr, ur, rr}
+}
+
+// Logout revokes the current session and the refresh tokens issued with it.
+// It succeeds when there is no session.
+func (s *session) Logout(ctx context.Context, dto dtos.LogoutRequest) error {
+	current, err := s.sr.Get(ctx, dto.Session)
+	if err != nil {
+		logger.Error(ctx, "can't get session", logger.WithError(err))
+		return err
+	}
+	if current == nil {
+		return nil
+	}
+
+	return s.revoke(ctx, current)
+}
+
+// revoke deletes the session and the refresh token families issued with it.
+func (s *session) revoke(ctx context.Context, target *model.Session) error {
+	if err := s.sr.Delete(ctx, target); err != nil {
+		logger.Error(ctx, "can't delete session", logger.WithError(err))
+		return err
+	}
+	if err := s.rr.RevokeBySessionID(ctx, target.UserID, target.ID); err != nil {
+		logger.Error(ctx, "can't revoke refresh tokens", logger.WithError(err))
+		return err
+	}
+	return nil
+}
+
+// LogoutAll revokes every session and refresh token of the current user.
+func (s *session) LogoutAll(ctx context.Context, dto dtos.LogoutAllRequest) error {
+	current := dto.Session
+
+	if err := s.sr.DeleteAllByUserID(ctx, current.UserID); err != nil {
+		logger.Error(ctx, "can't delete sessions", logger.WithError(err))
+		return err
+	}
+	if err := s.rr.RevokeAllByUserID(ctx, current.UserID); err != nil {
+		logger.Error(ctx, "can't revoke refresh tokens", logger.WithError(err))
+		return err
+	}
+	logger.Info(ctx, "Signed out everywhere", "user_id", current.UserID)
+	return nil
+}
+
+func (s *session) ListSessions(ctx context.Context, dto dtos.ListSessionsRequest) (*dtos.ListSessionsResponse, error) {
+	current := dto.Session
+
+	sessions, err := s.sr.ListByUserID(ctx, current.UserID)
+	if err != nil {
+		logger.Error(ctx, "can't list sessions", logger.WithError(err))
+		return nil, err
+	}
+
+	credentials, err := s.ur.ListCredentials(ctx, current.UserID)
+	if err != nil {
+		logger.Error(ctx, "can't list credentials", logger.WithError(err))
+		return nil, err
+	}
+	names := make(map[string]string, len(credentials))
+	for _, c := range credentials {
+		names[c.ID] = c.Name
+	}
+
+	return &dtos.ListSessionsResponse{
+		Sessions:        sessions,
+		Current:         current.PublicID(),
+		CredentialNames: names,
+	}, nil
+}
+
+func (s *session) RevokeSession(ctx context.Context, dto dtos.RevokeSessionRequest) (*dtos.RevokeSessionResponse, error) {
+	current := dto.Session
+
+	sessions, err := s.sr.ListByUserID(ctx, current.UserID)
+	if err != nil {
+		logger.Error(ctx, "can't list sessions", logger.WithError(err))
+		return nil, err
+	}
+
+	for i := range sessions {
+		if sessions[i].PublicID() != dto.ID {
+			continue
+		}
+		if err := s.revoke(ctx, &sessions[i]); err != nil {
+			return nil, err
+		}
+		return &dtos.RevokeSessionResponse{Current: sessions[i].ID == current.ID}, nil
+	}
+
+	return nil, dtos.ErrSessionNotFound
+}
+
+// Me describes the current user and how the current session was authenticated.
+func (s *session) Me(ctx context.Context, dto dtos.MeRequest) (*dtos.MeResponse, error) {
+	var credential *model.Credential
+	if dto.Session.CredentialID != "" {
+		c, err := s.ur.FindCredential(ctx, dto.User.ID, dto.Session.CredentialID)
+		if err != nil {
+			logger.Error(ctx, "can't get credential", logger.WithError(err))
+			return nil, err
+		}
+		credential = c
+	}
+
+	return &dtos.MeResponse{
+		User:       dto.User,
+		Session:    dto.Session,
+		Credential: credential,
+	}, nil
+}
+
+// Verify resolves the session cookie for a reverse proxy asking whether to let a request through.
+func (s *session) Verify(ctx context.Context, dto dtos.VerifyRequest) (*dtos.VerifyResponse, error) {
+	current, err := s.sr.Get(ctx, dto.Session)
+	if err != nil {
+		logger.Error(ctx, "can't get session", logger.WithError(err))
+		return nil, err
+	}
+	if current == nil || !current.Authenticated {
+		return nil, dtos.ErrUnauthorized
+	}
+	// プロキシはサブリクエストごとに問い合わせるので、保存は間引く
+	if err := s.sr.TouchIfStale(ctx, current); err != nil {
+		logger.Error(ctx, "can't touch session", logger.WithError(err))
+		return nil, err
+	}
+
+	user, err := s.ur.FindById(ctx, current.UserID)
+	if err != nil {
+		logger.Error(ctx, "can't get user", logger.WithError(err))
+		return nil, err
+	}
+	if user == nil {
+		return nil, dtos.ErrUnauthorized
+	}
+
+	return &dtos.VerifyResponse{User: user, Session: current}, nil
+}
+
+// rotateSession replaces a session whose privileges change with a new ID, so an ID fixed or
+// leaked before the change doesn't gain them.
+func rotateSession(ctx context.Context, sr repository.Session, user *model.User, current *model.Session, info model.SessionInfo) (*model.Session, error) {
+	rotated, err := sr.Create(ctx, user, info)
+	if err != nil {
+		logger.Error(ctx, "can't create session", logger.WithError(err))
+		return nil, err
+	}
+	if err := sr.Delete(ctx, current); err != nil {
+		logger.Error(ctx, "can't delete session", logger.WithError(err))
+		return nil, err
+	}
+	return rotated, nil
+}
@@ -0,0 +1,192 @@
+package usecase
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/kobayashiyabako16g/passkey-auth-example/internal/domain/model"
+	"github.com/kobayashiyabako16g/passkey-auth-example/internal/domain/repository"
+	dtos "github.com/kobayashiyabako16g/passkey-auth-example/internal/usecase/dto/token"
+	"github.com/kobayashiyabako16g/passkey-auth-example/pkg/jws"
+	"github.com/kobayashiyabako16g/passkey-auth-example/pkg/logger"
+)
+
+// TokenOptions configures access and refresh tokens.
+type TokenOptions struct {
+	Issuer          string
+	AccessTokenTTL  time.Duration
+	RefreshTokenTTL time.Duration
+}
+
+// firstPartyAudience is the audience of access tokens issued after a passkey login.
+// They are only for the first-party API; OpenID Connect clients get their client ID instead.
+const firstPartyAudience = "first-party"
+
+// TokenIssuer issues access tokens and rotating refresh tokens.
+type TokenIssuer struct {
+	rr     repository.RefreshToken
+	signer jws.Signer
+	opts   TokenOptions
+}
+
+func NewTokenIssuer(rr repository.RefreshToken, signer jws.Signer, opts TokenOptions) *TokenIssuer {
+	return &TokenIssuer{rr, signer, opts}
+}
+
+// Issue starts a new refresh token family for the login of the session.
+func (t *TokenIssuer) Issue(ctx context.Context, session *model.Session) (*dtos.TokenResponse, error) {
+	return t.issue(ctx, &model.RefreshToken{
+		UserID:       session.UserID,
+		CredentialID: session.CredentialID,
+		AMR:          session.AMR,
+		AuthTime:     session.AuthTime,
+		ExpiresAt:    session.AuthTime.Add(t.opts.RefreshTokenTTL),
+		SessionID:    session.ID,
+	})
+}
+
+// MoveSession keeps the refresh token families of a session revocable by logging out
+// of the session that replaced it.
+func (t *TokenIssuer) MoveSession(ctx context.Context, from *model.Session, to *model.Session) error {
+	if err := t.rr.MoveSession(ctx, from.ID, to.ID, t.opts.RefreshTokenTTL); err != nil {
+		logger.Error(ctx, "can't move refresh token families", logger.WithError(err))
+		return err
+	}
+	return nil
+}
+
+func (t *TokenIssuer) issue(ctx context.Context, refreshToken *model.RefreshToken) (*dtos.TokenResponse, error) {
+	if err := t.rr.Create(ctx, refreshToken); err != nil {
+		logger.Error(ctx, "can't create refresh token", logger.WithError(err))
+		return nil, err
+	}
+
+	now := time.Now()
+	claims := jws.AccessClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        uuid.NewString(),
+			Issuer:    t.opts.Issuer,
+			Subject:   refreshToken.UserID,
+			Audience:  jwt.ClaimStrings{firstPartyAudience},
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(t.opts.AccessTokenTTL)),
+		},
+		AMR:      refreshToken.AMR,
+		AuthTime: refreshToken.AuthTime.Unix(),
+	}
+	accessToken, err := t.signer.Sign(claims)
+	if err != nil {
+		logger.Error(ctx, "can't sign access token", logger.WithError(err))
+		return nil, err
+	}
+
+	return &dtos.TokenResponse{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken.Token,
+		ExpiresIn:    int64(t.opts.AccessTokenTTL.Seconds()),
+	}, nil
+}
+
+// ValidateAccessToken verifies an access token of the first-party API. Tokens issued to
+// OpenID Connect clients are rejected.
+func (t *TokenIssuer) ValidateAccessToken(ctx context.Context, accessToken string) (*jws.AccessClaims, error) {
+	var claims jws.AccessClaims
+	if err := t.signer.Verify(accessToken, &claims); err != nil {
+		logger.Info(ctx, "access token is invalid", logger.WithError(err))
+		return nil, dtos.ErrInvalidAccessToken
+	}
+	if claims.Issuer != t.opts.Issuer || !slices.Contains(claims.Audience, firstPartyAudience) || claims.ClientID != "" {
+		logger.Info(ctx, "access token isn't for the first-party api", "audience", claims.Audience)
+		return nil, dtos.ErrInvalidAccessToken
+	}
+	return &claims, nil
+}
+
+// Token exchanges refresh tokens for new access tokens.
+type Token interface {
+	Refresh(ctx context.Context, dto dtos.RefreshRequest) (*dtos.TokenResponse, error)
+}
+
+type token struct {
+	rr     repository.RefreshToken
+	ur     repository.User
+	tokens *TokenIssuer
+}
+
+func NewToken(rr repository.RefreshToken, ur repository.User, tokens *TokenIssuer) Token {
+	return &token{rr, ur, tokens}
+}
+
+// Refresh rotates the refresh token. Presenting a used token revokes its whole family,
+// since either the client or an attacker holds a stolen copy. So does a token whose user
+// or passkey is gone.
+func (t *token) Refresh(ctx context.Context, dto dtos.RefreshRequest) (*dtos.TokenResponse, error) {
+	refreshToken, reused, err := t.rr.Consume(ctx, dto.RefreshToken)
+	if err != nil {
+		logger.Error(ctx, "can't consume refresh token", logger.WithError(err))
+		return nil, err
+	}
+	if reused {
+		logger.Warn(ctx, "refresh token reuse detected", "user_id", refreshToken.UserID)
+		if err := t.rr.RevokeFamily(ctx, refreshToken); err != nil {
+			logger.Error(ctx, "can't revoke refresh token family", logger.WithError(err))
+			return nil, err
+		}
+		return nil, dtos.ErrInvalidRefreshToken
+	}
+	if refreshToken == nil {
+		logger.Info(ctx, "refresh token is invalid")
+		return nil, dtos.ErrInvalidRefreshToken
+	}
+
+	// ログイン後に削除されたユーザーや、削除・隔離されたパスキーのトークンは更新しない
+	active, err := t.active(ctx, refreshToken)
+	if err != nil {
+		return nil, err
+	}
+	if !active {
+		logger.Info(ctx, "refresh token outlived its user or credential", "user_id", refreshToken.UserID)
+		if err := t.rr.RevokeFamily(ctx, refreshToken); err != nil {
+			logger.Error(ctx, "can't revoke refresh token family", logger.WithError(err))
+			return nil, err
+		}
+		return nil, dtos.ErrInvalidRefreshToken
+	}
+
+	// 同じファミリー、同じ有効期限
+	return t.tokens.issue(ctx, &model.RefreshToken{
+		FamilyID:     refreshToken.FamilyID,
+		UserID:       refreshToken.UserID,
+		CredentialID: refreshToken.CredentialID,
+		AMR:          refreshToken.AMR,
+		AuthTime:     refreshToken.AuthTime,
+		ExpiresAt:    refreshToken.ExpiresAt,
+	})
+}
+
+// active reports whether the user still exists and the credential of the login, if any,
+// can still sign in.
+func (t *token) active(ctx context.Context, refreshToken *model.RefreshToken) (bool, error) {
+	user, err := t.ur.FindById(ctx, refreshToken.UserID)
+	if err != nil {
+		logger.Error(ctx, "can't get user", logger.WithError(err))
+		return false, err
+	}
+	if user == nil {
+		return false, nil
+	}
+	if refreshToken.CredentialID == "" {
+		return true, nil
+	}
+
+	credential, err := t.ur.FindCredential(ctx, user.ID, refreshToken.CredentialID)
+	if err != nil {
+		logger.Error(ctx, "can't get credential", logger.WithError(err))
+		return false, err
+	}
+	return credential != nil && !credential.Quarantined(), nil
+}
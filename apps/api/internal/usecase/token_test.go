@@ -0,0 +1,182 @@
+package usecase
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/kobayashiyabako16g/passkey-auth-example/internal/domain/model"
+	"github.com/kobayashiyabako16g/passkey-auth-example/internal/domain/repository"
+	dtos "github.com/kobayashiyabako16g/passkey-auth-example/internal/usecase/dto/token"
+	"github.com/kobayashiyabako16g/passkey-auth-example/pkg/jws"
+)
+
+func (c *fakeKV) Get(ctx context.Context, key string) (string, error) {
+	return c.get(key), nil
+}
+
+func (c *fakeKV) Delete(ctx context.Context, key string) error {
+	delete(c.values, key)
+	delete(c.sets, key)
+	return nil
+}
+
+func (c *fakeKV) SAdd(ctx context.Context, key string, members ...string) error {
+	if c.sets == nil {
+		c.sets = map[string][]string{}
+	}
+	for _, member := range members {
+		if !slices.Contains(c.sets[key], member) {
+			c.sets[key] = append(c.sets[key], member)
+		}
+	}
+	return nil
+}
+
+func (c *fakeKV) SMembers(ctx context.Context, key string) ([]string, error) {
+	return c.sets[key], nil
+}
+
+func (c *fakeKV) SRem(ctx context.Context, key string, members ...string) error {
+	if c.sets == nil {
+		return nil
+	}
+	c.sets[key] = slices.DeleteFunc(c.sets[key], func(m string) bool {
+		return slices.Contains(members, m)
+	})
+	return nil
+}
+
+// testSession is the session of a passkey login that asked for tokens.
+func testSession() *model.Session {
+	return &model.Session{ID: "session-1", UserID: "user-1", AMR: []string{model.AMRHardwareKey}, AuthTime: time.Now()}
+}
+
+func newTestToken(t *testing.T) (*TokenIssuer, Token) {
+	t.Helper()
+	key, err := jws.GenerateKey(jws.AlgorithmES256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := jws.NewStaticKeyManager([]*jws.Key{key})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	kv := &fakeKV{now: time.Now(), values: map[string]string{}, expires: map[string]time.Time{}}
+	rr := repository.NewRefreshToken(kv)
+	tokens := NewTokenIssuer(rr, signer, TokenOptions{
+		Issuer:          "https://example.com",
+		AccessTokenTTL:  5 * time.Minute,
+		RefreshTokenTTL: 24 * time.Hour,
+	})
+	users := &fakeUsers{user: &model.User{ID: "user-1", Name: "alice"}}
+	return tokens, NewToken(rr, users, tokens)
+}
+
+func refresh(usecase Token, refreshToken string) (*dtos.TokenResponse, error) {
+	return usecase.Refresh(context.Background(), dtos.RefreshRequest{RefreshToken: refreshToken})
+}
+
+func TestRefreshTokenReuseRevokesFamily(t *testing.T) {
+	tokens, usecase := newTestToken(t)
+	issued, err := tokens.Issue(context.Background(), testSession())
+	if err != nil {
+		t.Fatalf("Issue: %v", err)
+	}
+
+	rotated, err := refresh(usecase, issued.RefreshToken)
+	if err != nil {
+		t.Fatalf("first Refresh: %v", err)
+	}
+	if rotated.RefreshToken == issued.RefreshToken {
+		t.Fatal("refresh token wasn't rotated")
+	}
+
+	if _, err := refresh(usecase, issued.RefreshToken); err != dtos.ErrInvalidRefreshToken {
+		t.Errorf("reused token: err = %v, want %v", err, dtos.ErrInvalidRefreshToken)
+	}
+	// 再利用の検知でローテーション後のトークンも失効する
+	if _, err := refresh(usecase, rotated.RefreshToken); err != dtos.ErrInvalidRefreshToken {
+		t.Errorf("token rotated before the reuse: err = %v, want %v", err, dtos.ErrInvalidRefreshToken)
+	}
+}
+
+func TestRevokeBySessionID(t *testing.T) {
+	tokens, usecase := newTestToken(t)
+	ctx := context.Background()
+	session := testSession()
+	issued, err := tokens.Issue(ctx, session)
+	if err != nil {
+		t.Fatalf("Issue: %v", err)
+	}
+	other, err := tokens.Issue(ctx, &model.Session{ID: "session-2", UserID: "user-1", AuthTime: time.Now()})
+	if err != nil {
+		t.Fatalf("Issue: %v", err)
+	}
+
+	// 再認証で置き換えられたセッションのログアウトでも失効する
+	rotated := &model.Session{ID: "session-3", UserID: "user-1"}
+	if err := tokens.MoveSession(ctx, session, rotated); err != nil {
+		t.Fatalf("MoveSession: %v", err)
+	}
+	if err := tokens.rr.RevokeBySessionID(ctx, rotated.UserID, rotated.ID); err != nil {
+		t.Fatalf("RevokeBySessionID: %v", err)
+	}
+
+	if _, err := refresh(usecase, issued.RefreshToken); err != dtos.ErrInvalidRefreshToken {
+		t.Errorf("token of the revoked session: err = %v, want %v", err, dtos.ErrInvalidRefreshToken)
+	}
+	if _, err := refresh(usecase, other.RefreshToken); err != nil {
+		t.Errorf("token of another session: %v", err)
+	}
+}
+
+func TestValidateAccessToken(t *testing.T) {
+	tokens, _ := newTestToken(t)
+	ctx := context.Background()
+	issued, err := tokens.Issue(ctx, testSession())
+	if err != nil {
+		t.Fatalf("Issue: %v", err)
+	}
+
+	claims, err := tokens.ValidateAccessToken(ctx, issued.AccessToken)
+	if err != nil {
+		t.Fatalf("ValidateAccessToken: %v", err)
+	}
+	if claims.Subject != "user-1" {
+		t.Errorf("subject = %s, want user-1", claims.Subject)
+	}
+
+	sign := func(issuer string, audience string, clientID string) string {
+		token, err := tokens.signer.Sign(jws.AccessClaims{
+			RegisteredClaims: jwt.RegisteredClaims{
+				Issuer:    issuer,
+				Subject:   "user-1",
+				Audience:  jwt.ClaimStrings{audience},
+				ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+			},
+			ClientID: clientID,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{"oidc client token", sign("https://example.com", "client-1", "client-1")},
+		{"no audience", sign("https://example.com", "", "")},
+		{"other issuer", sign("https://other.example.com", firstPartyAudience, "")},
+		{"not a jwt", "not-a-jwt"},
+	}
+	for _, tt := range tests {
+		if _, err := tokens.ValidateAccessToken(ctx, tt.token); err != dtos.ErrInvalidAccessToken {
+			t.Errorf("%s: err = %v, want %v", tt.name, err, dtos.ErrInvalidAccessToken)
+		}
+	}
+}
@@ -0,0 +1,312 @@
+package usecase
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"github.com/kobayashiyabako16g/passkey-auth-example/internal/domain/model"
+	"github.com/kobayashiyabako16g/passkey-auth-example/internal/domain/repository"
+	dtos "github.com/kobayashiyabako16g/passkey-auth-example/internal/usecase/dto/totp"
+	"github.com/kobayashiyabako16g/passkey-auth-example/pkg/logger"
+	"github.com/kobayashiyabako16g/passkey-auth-example/pkg/totp"
+)
+
+// TOTP manages a TOTP authenticator as a backup of the passkeys. The policy of the account
+// makes it either a recovery method or a required second step after every login.
+type TOTP interface {
+	BeginEnroll(ctx context.Context, dto dtos.BeginEnrollRequest) (*dtos.BeginEnrollResponse, error)
+	FinishEnroll(ctx context.Context, dto dtos.FinishEnrollRequest) error
+	Status(ctx context.Context, dto dtos.StatusRequest) (*dtos.StatusResponse, error)
+	Disable(ctx context.Context, dto dtos.DisableRequest) error
+	// Verify completes a login that requires the second factor.
+	Verify(ctx context.Context, dto dtos.VerifyRequest) (*dtos.VerifyResponse, error)
+	// Login signs in with a code when the policy is recovery.
+	Login(ctx context.Context, dto dtos.LoginRequest) (*dtos.LoginResponse, error)
+}
+
+const (
+	// totpSkew is the number of time steps accepted before and after the current one.
+	totpSkew = 1
+	// totpEnrollmentTTL is how long the user has to confirm a new secret.
+	totpEnrollmentTTL = 10 * time.Minute
+	// totpMaxAttempts codes can be checked per totpAttemptWindow, against guessing.
+	totpMaxAttempts   = 5
+	totpAttemptWindow = 5 * time.Minute
+)
+
+type TOTPOptions struct {
+	// Issuer is the account name prefix shown in authenticator apps.
+	Issuer string
+}
+
+type totpFactor struct {
+	sr    repository.Session
+	ur    repository.User
+	tr    repository.TOTP
+	ts    repository.TOTPState
+	audit repository.Audit
+	opts  TOTPOptions
+}
+
+func NewTOTP(sr repository.Session, ur repository.User, tr repository.TOTP, ts repository.TOTPState, audit repository.Audit, opts TOTPOptions) TOTP {
+	return &totpFactor{
+		sr:    sr,
+		ur:    ur,
+		tr:    tr,
+		ts:    ts,
+		audit: audit,
+		opts:  opts,
+	}
+}
+
+// BeginEnroll generates a secret. It replaces the current authenticator only once a code is confirmed.
+func (t *totpFactor) BeginEnroll(ctx context.Context, dto dtos.BeginEnrollRequest) (*dtos.BeginEnrollResponse, error) {
+	user := dto.User
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return nil, err
+	}
+	if err := t.ts.SaveEnrollment(ctx, user.ID, secret, totpEnrollmentTTL); err != nil {
+		logger.Error(ctx, "can't save totp enrollment", logger.WithError(err))
+		return nil, err
+	}
+
+	return &dtos.BeginEnrollResponse{
+		Secret: totp.EncodeSecret(secret),
+		URI:    totp.URI(t.opts.Issuer, user.Name, secret),
+	}, nil
+}
+
+func (t *totpFactor) FinishEnroll(ctx context.Context, dto dtos.FinishEnrollRequest) error {
+	user := dto.User
+
+	if !dto.Policy.Valid() {
+		return dtos.ErrInvalidPolicy
+	}
+	secret, err := t.ts.FindEnrollment(ctx, user.ID)
+	if err != nil {
+		logger.Error(ctx, "can't get totp enrollment", logger.WithError(err))
+		return err
+	}
+	if secret == nil {
+		return dtos.ErrEnrollmentNotFound
+	}
+
+	// 登録前にアプリが正しく設定されたことを確認する
+	counter, ok := totp.Validate(secret, dto.Code, time.Now(), totpSkew)
+	if !ok {
+		logger.Info(ctx, "totp code doesn't match the new secret", "user_id", user.ID)
+		return dtos.ErrInvalidCode
+	}
+	if _, err := t.ts.MarkUsed(ctx, user.ID, counter, totpUsedTTL()); err != nil {
+		logger.Error(ctx, "can't mark totp code used", logger.WithError(err))
+		return err
+	}
+
+	if err := t.tr.Save(ctx, &model.TOTPCredential{
+		UserID: user.ID,
+		Secret: secret,
+		Policy: dto.Policy,
+	}); err != nil {
+		logger.Error(ctx, "can't save totp", logger.WithError(err))
+		return err
+	}
+	if err := t.ts.DeleteEnrollment(ctx, user.ID); err != nil {
+		logger.Error(ctx, "can't delete totp enrollment", logger.WithError(err))
+		return err
+	}
+	if err := t.record(ctx, user.ID, model.AuditTOTPEnabled, dto.IP, dto.UserAgent); err != nil {
+		return err
+	}
+
+	logger.Info(ctx, "Enabled totp", "user_id", user.ID, "policy", dto.Policy)
+	return nil
+}
+
+func (t *totpFactor) Status(ctx context.Context, dto dtos.StatusRequest) (*dtos.StatusResponse, error) {
+	credential, err := t.tr.Find(ctx, dto.User.ID)
+	if err != nil {
+		logger.Error(ctx, "can't get totp", logger.WithError(err))
+		return nil, err
+	}
+	if credential == nil {
+		return &dtos.StatusResponse{}, nil
+	}
+	return &dtos.StatusResponse{Enabled: true, Policy: credential.Policy}, nil
+}
+
+func (t *totpFactor) Disable(ctx context.Context, dto dtos.DisableRequest) error {
+	deleted, err := t.tr.Delete(ctx, dto.User.ID)
+	if err != nil {
+		logger.Error(ctx, "can't delete totp", logger.WithError(err))
+		return err
+	}
+	if !deleted {
+		return dtos.ErrNotEnabled
+	}
+	if err := t.record(ctx, dto.User.ID, model.AuditTOTPDisabled, dto.IP, dto.UserAgent); err != nil {
+		return err
+	}
+
+	logger.Info(ctx, "Disabled totp", "user_id", dto.User.ID)
+	return nil
+}
+
+func (t *totpFactor) Verify(ctx context.Context, dto dtos.VerifyRequest) (*dtos.VerifyResponse, error) {
+	session, err := t.sr.Get(ctx, dto.Session)
+	if err != nil {
+		logger.Error(ctx, "can't get session", logger.WithError(err))
+		return nil, err
+	}
+	if session == nil || !session.SecondFactorRequired {
+		return nil, dtos.ErrSessionNotFound
+	}
+
+	credential, err := t.tr.Find(ctx, session.UserID)
+	if err != nil {
+		logger.Error(ctx, "can't get totp", logger.WithError(err))
+		return nil, err
+	}
+	if credential == nil {
+		return nil, dtos.ErrNotEnabled
+	}
+	if err := t.check(ctx, credential, dto.Code, dto.IP, dto.UserAgent); err != nil {
+		return nil, err
+	}
+
+	user, err := t.ur.FindById(ctx, session.UserID)
+	if err != nil {
+		logger.Error(ctx, "can't get user", logger.WithError(err))
+		return nil, err
+	}
+	if user == nil {
+		return nil, dtos.ErrSessionNotFound
+	}
+
+	// 認証済みになるセッションは ID を変える
+	info := session.Info()
+	info.SecondFactorRequired = false
+	info.AMR = append(slices.Clone(info.AMR), model.AMROTP)
+	rotated, err := rotateSession(ctx, t.sr, user, session, info)
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Info(ctx, "Verified second factor", "user_id", session.UserID)
+	return &dtos.VerifyResponse{Session: rotated}, nil
+}
+
+func (t *totpFactor) Login(ctx context.Context, dto dtos.LoginRequest) (*dtos.LoginResponse, error) {
+	user, err := t.ur.FindByUsername(ctx, dto.Username)
+	if err != nil {
+		logger.Error(ctx, "can't get user", logger.WithError(err))
+		return nil, err
+	}
+	if user == nil {
+		logger.Info(ctx, "user not found")
+		return nil, dtos.ErrInvalidCode
+	}
+	credential, err := t.tr.Find(ctx, user.ID)
+	if err != nil {
+		logger.Error(ctx, "can't get totp", logger.WithError(err))
+		return nil, err
+	}
+	// 二要素目として登録されたアプリだけではログインできない
+	if credential == nil || credential.Policy != model.TOTPPolicyRecovery {
+		logger.Info(ctx, "totp isn't a recovery method", "user_id", user.ID)
+		return nil, dtos.ErrInvalidCode
+	}
+	if err := t.check(ctx, credential, dto.Code, dto.IP, dto.UserAgent); err != nil {
+		return nil, err
+	}
+
+	// 以前のセッションは破棄する
+	previous, err := t.sr.Get(ctx, dto.Session)
+	if err != nil {
+		logger.Error(ctx, "can't get session", logger.WithError(err))
+		return nil, err
+	}
+	if previous != nil {
+		if err := t.sr.Delete(ctx, previous); err != nil {
+			logger.Error(ctx, "can't delete session", logger.WithError(err))
+			return nil, err
+		}
+	}
+
+	session, err := t.sr.Create(ctx, user, model.SessionInfo{
+		AMR:                []string{model.AMROTP},
+		IP:                 dto.IP,
+		UserAgent:          dto.UserAgent,
+		EnrollmentRequired: true,
+	})
+	if err != nil {
+		logger.Error(ctx, "can't create session", logger.WithError(err))
+		return nil, err
+	}
+
+	logger.Info(ctx, "Signed in with totp", "user_id", user.ID)
+	return &dtos.LoginResponse{Session: session}, nil
+}
+
+// check validates a code within the attempt limit and rejects a time step that was already used.
+func (t *totpFactor) check(ctx context.Context, credential *model.TOTPCredential, code string, ip string, userAgent string) error {
+	attempts, err := t.ts.CountAttempt(ctx, credential.UserID, totpAttemptWindow)
+	if err != nil {
+		logger.Error(ctx, "can't count totp attempts", logger.WithError(err))
+		return err
+	}
+	if attempts > totpMaxAttempts {
+		logger.Info(ctx, "too many totp attempts", "user_id", credential.UserID)
+		return dtos.ErrTooManyAttempts
+	}
+
+	counter, ok := totp.Validate(credential.Secret, code, time.Now(), totpSkew)
+	if ok {
+		ok, err = t.ts.MarkUsed(ctx, credential.UserID, counter, totpUsedTTL())
+		if err != nil {
+			logger.Error(ctx, "can't mark totp code used", logger.WithError(err))
+			return err
+		}
+		if !ok {
+			logger.Info(ctx, "totp code replayed", "user_id", credential.UserID)
+		}
+	}
+	if !ok {
+		if err := t.record(ctx, credential.UserID, model.AuditTOTPFailed, ip, userAgent); err != nil {
+			return err
+		}
+		return dtos.ErrInvalidCode
+	}
+
+	return t.record(ctx, credential.UserID, model.AuditTOTPUsed, ip, userAgent)
+}
+
+func (t *totpFactor) record(ctx context.Context, userID string, event model.AuditEventType, ip string, userAgent string) error {
+	if err := t.audit.Record(ctx, &model.AuditEvent{
+		UserID:    userID,
+		Event:     event,
+		IP:        ip,
+		UserAgent: userAgent,
+	}); err != nil {
+		logger.Error(ctx, "can't record audit event", logger.WithError(err))
+		return err
+	}
+	return nil
+}
+
+// totpUsedTTL keeps the last accepted time step until no clock skew accepts it anymore.
+func totpUsedTTL() time.Duration {
+	return time.Duration(2*totpSkew+1) * totp.Period
+}
+
+// requiresSecondFactor reports whether logins of the user wait for a TOTP code.
+func requiresSecondFactor(ctx context.Context, tr repository.TOTP, userID string) (bool, error) {
+	credential, err := tr.Find(ctx, userID)
+	if err != nil {
+		logger.Error(ctx, "can't get totp", logger.WithError(err))
+		return false, err
+	}
+	return credential != nil && credential.Policy == model.TOTPPolicySecondFactor, nil
+}
@@ -0,0 +1,102 @@
+package usecase
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/kobayashiyabako16g/passkey-auth-example/internal/domain/model"
+	"github.com/kobayashiyabako16g/passkey-auth-example/internal/domain/repository"
+	dtos "github.com/kobayashiyabako16g/passkey-auth-example/internal/usecase/dto/totp"
+	"github.com/kobayashiyabako16g/passkey-auth-example/pkg/totp"
+)
+
+func (r *fakeUsers) FindByUsername(ctx context.Context, name string) (*model.User, error) {
+	if name != r.user.Name {
+		return nil, nil
+	}
+	return r.user, nil
+}
+
+// fakeTOTPState keeps the last accepted time step and the attempts like the kvstore script does.
+type fakeTOTPState struct {
+	repository.TOTPState
+	last     map[string]int64
+	attempts int64
+}
+
+func (s *fakeTOTPState) MarkUsed(ctx context.Context, userID string, counter int64, ttl time.Duration) (bool, error) {
+	if last, ok := s.last[userID]; ok && counter <= last {
+		return false, nil
+	}
+	s.last[userID] = counter
+	return true, nil
+}
+
+func (s *fakeTOTPState) CountAttempt(ctx context.Context, userID string, window time.Duration) (int64, error) {
+	s.attempts++
+	return s.attempts, nil
+}
+
+var totpTestSecret = []byte("12345678901234567890")
+
+func newTestTOTP() TOTP {
+	user := &model.User{ID: "user-1", Name: "alice"}
+	credential := &model.TOTPCredential{UserID: user.ID, Secret: totpTestSecret, Policy: model.TOTPPolicyRecovery}
+	return NewTOTP(&fakeSessions{}, &fakeUsers{user: user}, &fakeTOTP{credential: credential},
+		&fakeTOTPState{last: map[string]int64{}}, &fakeAudit{}, TOTPOptions{Issuer: "example"})
+}
+
+// currentCounter returns the time step of now, after waiting out a step that is about to end
+// so that the usecase checks the codes in the same step.
+func currentCounter() int64 {
+	next := time.Unix((totp.Counter(time.Now())+1)*int64(totp.Period.Seconds()), 0)
+	if wait := time.Until(next); wait < time.Second {
+		time.Sleep(wait)
+	}
+	return totp.Counter(time.Now())
+}
+
+func totpLogin(usecase TOTP, code string) error {
+	_, err := usecase.Login(context.Background(), dtos.LoginRequest{Username: "alice", Code: code})
+	return err
+}
+
+func TestTOTPDriftWindow(t *testing.T) {
+	tests := []struct {
+		steps int64
+		want  error
+	}{
+		{-2, dtos.ErrInvalidCode},
+		{-1, nil},
+		{0, nil},
+		{1, nil},
+		{2, dtos.ErrInvalidCode},
+	}
+	for _, tt := range tests {
+		usecase := newTestTOTP()
+		code := totp.Code(totpTestSecret, currentCounter()+tt.steps)
+		if err := totpLogin(usecase, code); err != tt.want {
+			t.Errorf("code %+d steps away: err = %v, want %v", tt.steps, err, tt.want)
+		}
+	}
+}
+
+func TestTOTPReplay(t *testing.T) {
+	usecase := newTestTOTP()
+	counter := currentCounter()
+
+	if err := totpLogin(usecase, totp.Code(totpTestSecret, counter)); err != nil {
+		t.Fatalf("first Login: %v", err)
+	}
+	if err := totpLogin(usecase, totp.Code(totpTestSecret, counter)); err != dtos.ErrInvalidCode {
+		t.Errorf("replayed code: err = %v, want %v", err, dtos.ErrInvalidCode)
+	}
+	// ドリフトの範囲内でも受け付けたステップより前のコードは使えない
+	if err := totpLogin(usecase, totp.Code(totpTestSecret, counter-1)); err != dtos.ErrInvalidCode {
+		t.Errorf("older code: err = %v, want %v", err, dtos.ErrInvalidCode)
+	}
+	if err := totpLogin(usecase, totp.Code(totpTestSecret, counter+1)); err != nil {
+		t.Errorf("later code: %v", err)
+	}
+}
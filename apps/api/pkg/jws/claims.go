@@ -0,0 +1,23 @@
+package jws
+
+import "github.com/golang-jwt/jwt/v5"
+
+// AccessClaims are the claims of an access token.
+type AccessClaims struct {
+	jwt.RegisteredClaims
+	AMR      []string `json:"amr"`
+	AuthTime int64    `json:"auth_time"`
+	// Scope and ClientID are set on tokens issued to OpenID Connect clients.
+	Scope    string `json:"scope,omitempty"`
+	ClientID string `json:"client_id,omitempty"`
+}
+
+// IDClaims are the claims of an OpenID Connect ID token.
+type IDClaims struct {
+	jwt.RegisteredClaims
+	AMR               []string `json:"amr"`
+	AuthTime          int64    `json:"auth_time"`
+	Nonce             string   `json:"nonce,omitempty"`
+	Name              string   `json:"name,omitempty"`
+	PreferredUsername string   `json:"preferred_username,omitempty"`
+}
@@ -0,0 +1,9 @@
+package jws
+
+import "github.com/golang-jwt/jwt/v5"
+
+// Signer signs and verifies JWTs.
+type Signer interface {
+	Sign(claims jwt.Claims) (string, error)
+	Verify(token string, claims jwt.Claims) error
+}
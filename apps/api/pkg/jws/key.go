@@ -0,0 +1,184 @@
+package jws
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Signing algorithms supported by the key manager.
+const (
+	AlgorithmEdDSA = "EdDSA"
+	AlgorithmES256 = "ES256"
+	AlgorithmRS256 = "RS256"
+)
+
+// Key is an asymmetric signing key.
+type Key struct {
+	ID         string
+	Algorithm  string
+	PrivateKey crypto.Signer
+	CreatedAt  time.Time
+	// RetiredAt is when the key stopped signing. Nil while it's the current key.
+	RetiredAt *time.Time
+	// ExpiresAt is when the key leaves the JWKS. Nil while it's the current key.
+	ExpiresAt *time.Time
+}
+
+// GenerateKey generates a key for the algorithm.
+func GenerateKey(algorithm string) (*Key, error) {
+	var (
+		privateKey crypto.Signer
+		err        error
+	)
+	switch algorithm {
+	case AlgorithmEdDSA:
+		_, privateKey, err = ed25519.GenerateKey(rand.Reader)
+	case AlgorithmES256:
+		privateKey, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case AlgorithmRS256:
+		privateKey, err = rsa.GenerateKey(rand.Reader, 3072)
+	default:
+		return nil, fmt.Errorf("jws: unsupported algorithm %q", algorithm)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return NewKey(privateKey, time.Now())
+}
+
+// NewKey wraps a private key. The algorithm follows the key type
+// and the ID is the RFC 7638 thumbprint of the public key.
+func NewKey(privateKey crypto.Signer, createdAt time.Time) (*Key, error) {
+	var algorithm string
+	switch k := privateKey.(type) {
+	case ed25519.PrivateKey:
+		algorithm = AlgorithmEdDSA
+	case *ecdsa.PrivateKey:
+		if k.Curve != elliptic.P256() {
+			return nil, errors.New("jws: only P-256 ECDSA keys are supported")
+		}
+		algorithm = AlgorithmES256
+	case *rsa.PrivateKey:
+		if k.N.BitLen() < 2048 {
+			return nil, errors.New("jws: RSA keys must be at least 2048 bits")
+		}
+		algorithm = AlgorithmRS256
+	default:
+		return nil, fmt.Errorf("jws: unsupported key type %T", privateKey)
+	}
+
+	key := &Key{
+		Algorithm:  algorithm,
+		PrivateKey: privateKey,
+		CreatedAt:  createdAt,
+	}
+	key.ID = key.PublicJWK().Thumbprint()
+	return key, nil
+}
+
+// ParsePrivateKey parses a PKCS #8 private key, in PEM or DER.
+func ParsePrivateKey(data []byte, createdAt time.Time) (*Key, error) {
+	if block, _ := pem.Decode(data); block != nil {
+		data = block.Bytes
+	}
+	privateKey, err := x509.ParsePKCS8PrivateKey(data)
+	if err != nil {
+		return nil, fmt.Errorf("jws: can't parse private key: %w", err)
+	}
+	signer, ok := privateKey.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("jws: unsupported key type %T", privateKey)
+	}
+	return NewKey(signer, createdAt)
+}
+
+// MarshalPrivateKey encodes the private key as PKCS #8 DER.
+func (k *Key) MarshalPrivateKey() ([]byte, error) {
+	return x509.MarshalPKCS8PrivateKey(k.PrivateKey)
+}
+
+func (k *Key) signingMethod() jwt.SigningMethod {
+	switch k.Algorithm {
+	case AlgorithmEdDSA:
+		return jwt.SigningMethodEdDSA
+	case AlgorithmES256:
+		return jwt.SigningMethodES256
+	default:
+		return jwt.SigningMethodRS256
+	}
+}
+
+// PublicJWK returns the public key as a JWK.
+func (k *Key) PublicJWK() JWK {
+	jwk := JWK{KeyID: k.ID, Use: "sig", Algorithm: k.Algorithm}
+	switch pub := k.PrivateKey.Public().(type) {
+	case ed25519.PublicKey:
+		jwk.KeyType = "OKP"
+		jwk.Curve = "Ed25519"
+		jwk.X = encode(pub)
+	case *ecdsa.PublicKey:
+		// 非圧縮形式の点: 0x04 || X || Y
+		point, _ := pub.ECDH()
+		b := point.Bytes()
+		jwk.KeyType = "EC"
+		jwk.Curve = "P-256"
+		jwk.X = encode(b[1:33])
+		jwk.Y = encode(b[33:])
+	case *rsa.PublicKey:
+		jwk.KeyType = "RSA"
+		jwk.N = encode(pub.N.Bytes())
+		jwk.E = encode(big.NewInt(int64(pub.E)).Bytes())
+	}
+	return jwk
+}
+
+// JWK is a public JSON Web Key (RFC 7517).
+type JWK struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	Curve     string `json:"crv,omitempty"`
+	X         string `json:"x,omitempty"`
+	Y         string `json:"y,omitempty"`
+	N         string `json:"n,omitempty"`
+	E         string `json:"e,omitempty"`
+}
+
+// JWKSet is served at /.well-known/jwks.json.
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// Thumbprint computes the RFC 7638 thumbprint from the required members in lexical order.
+func (j JWK) Thumbprint() string {
+	var s string
+	switch j.KeyType {
+	case "OKP":
+		s = fmt.Sprintf(`{"crv":%q,"kty":%q,"x":%q}`, j.Curve, j.KeyType, j.X)
+	case "EC":
+		s = fmt.Sprintf(`{"crv":%q,"kty":%q,"x":%q,"y":%q}`, j.Curve, j.KeyType, j.X, j.Y)
+	case "RSA":
+		s = fmt.Sprintf(`{"e":%q,"kty":%q,"n":%q}`, j.E, j.KeyType, j.N)
+	}
+	sum := sha256.Sum256([]byte(s))
+	return encode(sum[:])
+}
+
+func encode(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
@@ -0,0 +1,272 @@
+package jws
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/kobayashiyabako16g/passkey-auth-example/pkg/logger"
+)
+
+// KeyStore persists generated keys so that every instance signs with the same keys.
+type KeyStore interface {
+	// ListKeys returns the keys that haven't expired.
+	ListKeys(ctx context.Context) ([]*Key, error)
+	CreateKey(ctx context.Context, key *Key) error
+	// RetireKey saves RetiredAt and ExpiresAt.
+	RetireKey(ctx context.Context, key *Key) error
+	DeleteExpiredKeys(ctx context.Context) error
+}
+
+type KeyManagerOptions struct {
+	Algorithm string
+	// RotationPeriod is how long a key signs before the next one takes over.
+	RotationPeriod time.Duration
+	// PublishAhead publishes the next key before it signs, so verifiers
+	// caching the JWKS already know it when the first token arrives.
+	PublishAhead time.Duration
+	// RetainPeriod keeps a retired key in the JWKS. It must outlive the tokens it signed.
+	RetainPeriod time.Duration
+}
+
+// KeyManager signs with the current key and publishes every key that may still verify a token.
+type KeyManager struct {
+	store KeyStore
+	opts  KeyManagerOptions
+
+	mu   sync.RWMutex
+	keys []*Key
+}
+
+// NewKeyManager loads the keys from the store and generates the first key if needed.
+func NewKeyManager(ctx context.Context, store KeyStore, opts KeyManagerOptions) (*KeyManager, error) {
+	if opts.PublishAhead >= opts.RotationPeriod {
+		return nil, errors.New("jws: PublishAhead must be shorter than RotationPeriod")
+	}
+	m := &KeyManager{store: store, opts: opts}
+	if err := m.Rotate(ctx); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// NewStaticKeyManager uses keys provisioned by the operator. The last key signs and
+// the others are only published. Keys aren't rotated.
+func NewStaticKeyManager(keys []*Key) (*KeyManager, error) {
+	if len(keys) == 0 {
+		return nil, errors.New("jws: no signing key")
+	}
+	return &KeyManager{keys: keys}, nil
+}
+
+// LoadKeyDir reads PKCS #8 PEM files (*.pem) from dir in file name order.
+// Operators rotate by adding a file whose name sorts last.
+func LoadKeyDir(dir string) ([]*Key, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+
+	keys := make([]*Key, 0, len(files))
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		info, err := os.Stat(file)
+		if err != nil {
+			return nil, err
+		}
+		key, err := ParsePrivateKey(data, info.ModTime())
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// Run rotates the keys every interval until ctx is done.
+func (m *KeyManager) Run(ctx context.Context, interval time.Duration) {
+	if m.store == nil {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := m.Rotate(ctx); err != nil {
+				logger.Error(ctx, "can't rotate signing keys", logger.WithError(err))
+			}
+		}
+	}
+}
+
+// Rotate publishes the next key when the current one is due and retires the keys
+// it replaced. Several instances may rotate at once; the extra keys are retired
+// on the next run.
+func (m *KeyManager) Rotate(ctx context.Context) error {
+	keys, err := m.store.ListKeys(ctx)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	active := activeKeys(keys)
+	if len(active) == 0 || now.Sub(active[len(active)-1].CreatedAt) >= m.opts.RotationPeriod-m.opts.PublishAhead {
+		key, err := GenerateKey(m.opts.Algorithm)
+		if err != nil {
+			return err
+		}
+		if err := m.store.CreateKey(ctx, key); err != nil {
+			return err
+		}
+		logger.Info(ctx, "Generated signing key", "kid", key.ID, "alg", key.Algorithm)
+		keys = append(keys, key)
+		active = append(active, key)
+	}
+
+	current := currentKey(active, now, m.opts.PublishAhead)
+	for _, key := range active {
+		if !key.CreatedAt.Before(current.CreatedAt) {
+			continue
+		}
+		expiresAt := now.Add(m.opts.RetainPeriod)
+		key.RetiredAt = &now
+		key.ExpiresAt = &expiresAt
+		if err := m.store.RetireKey(ctx, key); err != nil {
+			return err
+		}
+		logger.Info(ctx, "Retired signing key", "kid", key.ID, "expires_at", expiresAt)
+	}
+
+	if err := m.store.DeleteExpiredKeys(ctx); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	m.keys = keys
+	m.mu.Unlock()
+	return nil
+}
+
+// Sign signs the claims with the current key.
+func (m *KeyManager) Sign(claims jwt.Claims) (string, error) {
+	key := m.current()
+	if key == nil {
+		return "", errors.New("jws: no signing key")
+	}
+	token := jwt.NewWithClaims(key.signingMethod(), claims)
+	token.Header["kid"] = key.ID
+	return token.SignedString(key.PrivateKey)
+}
+
+// Verify verifies a token signed by any published key.
+func (m *KeyManager) Verify(token string, claims jwt.Claims) error {
+	_, err := jwt.ParseWithClaims(token, claims, func(t *jwt.Token) (any, error) {
+		kid, _ := t.Header["kid"].(string)
+		key := m.find(kid)
+		if key == nil {
+			return nil, fmt.Errorf("jws: unknown key %q", kid)
+		}
+		if t.Method.Alg() != key.Algorithm {
+			return nil, fmt.Errorf("jws: algorithm %q doesn't match key %q", t.Method.Alg(), kid)
+		}
+		return key.PrivateKey.Public(), nil
+	}, jwt.WithValidMethods([]string{AlgorithmEdDSA, AlgorithmES256, AlgorithmRS256}))
+	return err
+}
+
+// JWKS returns the public keys that may still verify a token.
+func (m *KeyManager) JWKS() JWKSet {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	now := time.Now()
+	set := JWKSet{Keys: make([]JWK, 0, len(m.keys))}
+	for _, key := range m.keys {
+		if key.ExpiresAt != nil && !now.Before(*key.ExpiresAt) {
+			continue
+		}
+		set.Keys = append(set.Keys, key.PublicJWK())
+	}
+	return set
+}
+
+// Algorithms returns the algorithms of the published keys.
+func (m *KeyManager) Algorithms() []string {
+	var algorithms []string
+	for _, key := range m.JWKS().Keys {
+		if !slices.Contains(algorithms, key.Algorithm) {
+			algorithms = append(algorithms, key.Algorithm)
+		}
+	}
+	return algorithms
+}
+
+func (m *KeyManager) current() *Key {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if m.store == nil {
+		return m.keys[len(m.keys)-1]
+	}
+	return currentKey(activeKeys(m.keys), time.Now(), m.opts.PublishAhead)
+}
+
+func (m *KeyManager) find(kid string) *Key {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	now := time.Now()
+	for _, key := range m.keys {
+		if key.ID != kid {
+			continue
+		}
+		if key.ExpiresAt != nil && !now.Before(*key.ExpiresAt) {
+			return nil
+		}
+		return key
+	}
+	return nil
+}
+
+// activeKeys returns the keys that haven't been retired, oldest first.
+func activeKeys(keys []*Key) []*Key {
+	active := make([]*Key, 0, len(keys))
+	for _, key := range keys {
+		if key.RetiredAt == nil {
+			active = append(active, key)
+		}
+	}
+	sort.Slice(active, func(i, j int) bool {
+		return active[i].CreatedAt.Before(active[j].CreatedAt)
+	})
+	return active
+}
+
+// currentKey is the newest key published for at least publishAhead.
+// The oldest key signs until then.
+func currentKey(active []*Key, now time.Time, publishAhead time.Duration) *Key {
+	if len(active) == 0 {
+		return nil
+	}
+	current := active[0]
+	for _, key := range active[1:] {
+		if !key.CreatedAt.After(now.Add(-publishAhead)) {
+			current = key
+		}
+	}
+	return current
+}
@@ -6,6 +6,17 @@ type Client interface {
 	Get(ctx context.Context, key string) (string, error)
 	Set(ctx context.Context, key, value string, opts ...SetOptions) error
 	Delete(ctx context.Context, key string) error
+	// GetDel gets the value of key and deletes it atomically.
+	GetDel(ctx context.Context, key string) (string, error)
+	Expire(ctx context.Context, key string, seconds int64) error
+	// Incr increments the integer value of key and returns the new value. A missing key starts at 0.
+	Incr(ctx context.Context, key string) (int64, error)
+	// EvalInt runs a Lua script atomically and returns its integer result.
+	EvalInt(ctx context.Context, script string, keys []string, args ...string) (int64, error)
+	// Set operations
+	SAdd(ctx context.Context, key string, members ...string) error
+	SMembers(ctx context.Context, key string) ([]string, error)
+	SRem(ctx context.Context, key string, members ...string) error
 }
 
 type SetOptions struct {
@@ -83,3 +83,62 @@ func (c *valKeyClient) Delete(ctx context.Context, key string) error {
 
 	return nil
 }
+
+func (c *valKeyClient) GetDel(ctx context.Context, key string) (string, error) {
+	resp := c.client.Do(ctx, c.client.B().Getdel().Key(key).Build())
+	if err := resp.Error(); err != nil {
+		if valkey.IsValkeyNil(err) {
+			return "", nil // not found
+		}
+		return "", err
+	}
+
+	return resp.ToString()
+}
+
+func (c *valKeyClient) Expire(ctx context.Context, key string, seconds int64) error {
+	resp := c.client.Do(ctx, c.client.B().Expire().Key(key).Seconds(seconds).Build())
+	if err := resp.Error(); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (c *valKeyClient) Incr(ctx context.Context, key string) (int64, error) {
+	return c.client.Do(ctx, c.client.B().Incr().Key(key).Build()).AsInt64()
+}
+
+func (c *valKeyClient) EvalInt(ctx context.Context, script string, keys []string, args ...string) (int64, error) {
+	return c.client.Do(ctx, c.client.B().Eval().Script(script).Numkeys(int64(len(keys))).Key(keys...).Arg(args...).Build()).AsInt64()
+}
+
+func (c *valKeyClient) SAdd(ctx context.Context, key string, members ...string) error {
+	resp := c.client.Do(ctx, c.client.B().Sadd().Key(key).Member(members...).Build())
+	if err := resp.Error(); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (c *valKeyClient) SMembers(ctx context.Context, key string) ([]string, error) {
+	resp := c.client.Do(ctx, c.client.B().Smembers().Key(key).Build())
+	if err := resp.Error(); err != nil {
+		if valkey.IsValkeyNil(err) {
+			return nil, nil // not found
+		}
+		return nil, err
+	}
+
+	return resp.AsStrSlice()
+}
+
+func (c *valKeyClient) SRem(ctx context.Context, key string, members ...string) error {
+	resp := c.client.Do(ctx, c.client.B().Srem().Key(key).Member(members...).Build())
+	if err := resp.Error(); err != nil {
+		return err
+	}
+
+	return nil
+}
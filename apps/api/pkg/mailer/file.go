@@ -0,0 +1,33 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/kobayashiyabako16g/passkey-auth-example/pkg/random"
+)
+
+type fileMailer struct {
+	dir  string
+	from string
+}
+
+// NewFile writes each message to its own .eml file in dir.
+func NewFile(dir string, from string) Mailer {
+	return &fileMailer{dir, from}
+}
+
+func (m *fileMailer) Send(ctx context.Context, msg Message) error {
+	if err := os.MkdirAll(m.dir, 0o700); err != nil {
+		return err
+	}
+	suffix, err := random.Token(6)
+	if err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%s-%s.eml", time.Now().UTC().Format("20060102T150405Z"), suffix)
+	return os.WriteFile(filepath.Join(m.dir, name), encode(m.from, msg), 0o600)
+}
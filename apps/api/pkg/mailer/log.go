@@ -0,0 +1,20 @@
+package mailer
+
+import (
+	"context"
+
+	"github.com/kobayashiyabako16g/passkey-auth-example/pkg/logger"
+)
+
+type logMailer struct{}
+
+// NewLog writes messages to the log instead of sending them.
+// Links in the body are sign-in credentials, so it's for development only.
+func NewLog() Mailer {
+	return &logMailer{}
+}
+
+func (m *logMailer) Send(ctx context.Context, msg Message) error {
+	logger.Info(ctx, "Mail", "to", msg.To, "subject", msg.Subject, "body", msg.Body)
+	return nil
+}
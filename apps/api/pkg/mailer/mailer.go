@@ -0,0 +1,63 @@
+package mailer
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"mime"
+	"net/mail"
+	"time"
+)
+
+// Mailer delivers email messages.
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// Message is a plain text email.
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+type Config struct {
+	// Transport is smtp, file or log. file and log are meant for development.
+	Transport string     `env:"TRANSPORT" envDefault:"log"`
+	From      string     `env:"FROM" envDefault:"no-reply@localhost"`
+	SMTP      SMTPConfig `envPrefix:"SMTP_"`
+	// Dir is where the file transport writes messages as .eml files.
+	Dir string `env:"DIR" envDefault:"mail"`
+}
+
+// New returns the Mailer of the configured transport.
+func New(cfg Config) (Mailer, error) {
+	if _, err := mail.ParseAddress(cfg.From); err != nil {
+		return nil, fmt.Errorf("invalid sender address %q: %v", cfg.From, err)
+	}
+	switch cfg.Transport {
+	case "smtp":
+		return NewSMTP(cfg.SMTP, cfg.From), nil
+	case "file":
+		return NewFile(cfg.Dir, cfg.From), nil
+	case "log":
+		return NewLog(), nil
+	default:
+		return nil, fmt.Errorf("unknown mail transport: %s", cfg.Transport)
+	}
+}
+
+// encode renders the message in RFC 5322 format.
+func encode(from string, msg Message) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", msg.Subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("Content-Transfer-Encoding: 8bit\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(msg.Body)
+	return b.Bytes()
+}
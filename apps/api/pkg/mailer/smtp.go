@@ -0,0 +1,37 @@
+package mailer
+
+import (
+	"context"
+	"net"
+	"net/smtp"
+)
+
+type SMTPConfig struct {
+	// Addr is host:port of the server, e.g. a local stub such as mailpit.
+	Addr     string `env:"ADDR" envDefault:"localhost:1025"`
+	Username string `env:"USERNAME"`
+	Password string `env:"PASSWORD"`
+}
+
+type smtpMailer struct {
+	config SMTPConfig
+	from   string
+}
+
+// NewSMTP sends messages through an SMTP server. STARTTLS is used when the server offers it,
+// and credentials are only sent over TLS or to localhost.
+func NewSMTP(config SMTPConfig, from string) Mailer {
+	return &smtpMailer{config, from}
+}
+
+func (m *smtpMailer) Send(ctx context.Context, msg Message) error {
+	var auth smtp.Auth
+	if m.config.Username != "" {
+		host, _, err := net.SplitHostPort(m.config.Addr)
+		if err != nil {
+			return err
+		}
+		auth = smtp.PlainAuth("", m.config.Username, m.config.Password, host)
+	}
+	return smtp.SendMail(m.config.Addr, auth, m.from, []string{msg.To}, encode(m.from, msg))
+}
@@ -0,0 +1,30 @@
+package random
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"math/big"
+)
+
+// Token returns n bytes from crypto/rand encoded as unpadded base64url.
+func Token(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// String returns n characters picked uniformly from the alphabet with crypto/rand.
+func String(n int, alphabet string) (string, error) {
+	max := big.NewInt(int64(len(alphabet)))
+	b := make([]byte, n)
+	for i := range b {
+		idx, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		b[i] = alphabet[idx.Int64()]
+	}
+	return string(b), nil
+}
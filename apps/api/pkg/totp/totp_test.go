@@ -0,0 +1,55 @@
+package totp
+
+import (
+	"testing"
+	"time"
+)
+
+// rfc6238Secret is the HMAC-SHA1 key of the RFC 6238 test vectors.
+var rfc6238Secret = []byte("12345678901234567890")
+
+func TestCode(t *testing.T) {
+	// RFC 6238 Appendix B の SHA1 のベクター (8 桁のうち下 6 桁)
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+	for _, tt := range tests {
+		if got := Code(rfc6238Secret, Counter(time.Unix(tt.unix, 0))); got != tt.want {
+			t.Errorf("Code at %d = %s, want %s", tt.unix, got, tt.want)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	counter := Counter(now)
+
+	tests := []struct {
+		name    string
+		code    string
+		want    bool
+		counter int64
+	}{
+		{"current step", Code(rfc6238Secret, counter), true, counter},
+		{"previous step", Code(rfc6238Secret, counter-1), true, counter - 1},
+		{"next step", Code(rfc6238Secret, counter+1), true, counter + 1},
+		{"outside the skew", Code(rfc6238Secret, counter-2), false, 0},
+		{"wrong code", "000000", false, 0},
+		{"too short", "05047", false, 0},
+		{"too long", "0050471", false, 0},
+	}
+	for _, tt := range tests {
+		got, ok := Validate(rfc6238Secret, tt.code, now, 1)
+		if ok != tt.want || got != tt.counter {
+			t.Errorf("%s: Validate = (%d, %v), want (%d, %v)", tt.name, got, ok, tt.counter, tt.want)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package useragent
+
+import "strings"
+
+// Agent is the result of parsing a User-Agent header.
+type Agent struct {
+	Browser string `json:"browser"`
+	OS      string `json:"os"`
+	Device  string `json:"device"`
+}
+
+// Parse extracts the browser, OS and device class from a User-Agent header.
+// It only recognizes the common browsers; anything else is reported as "Other".
+func Parse(ua string) Agent {
+	return Agent{
+		Browser: browser(ua),
+		OS:      os(ua),
+		Device:  device(ua),
+	}
+}
+
+func browser(ua string) string {
+	// 判定順が重要 (Edge/Opera の UA は Chrome を含み、Chrome の UA は Safari を含む)
+	switch {
+	case strings.Contains(ua, "Edg/"):
+		return "Edge"
+	case strings.Contains(ua, "OPR/"):
+		return "Opera"
+	case strings.Contains(ua, "Firefox/"), strings.Contains(ua, "FxiOS/"):
+		return "Firefox"
+	case strings.Contains(ua, "Chrome/"), strings.Contains(ua, "CriOS/"):
+		return "Chrome"
+	case strings.Contains(ua, "Safari/"):
+		return "Safari"
+	default:
+		return "Other"
+	}
+}
+
+func os(ua string) string {
+	switch {
+	case strings.Contains(ua, "iPhone"), strings.Contains(ua, "iPad"):
+		return "iOS"
+	case strings.Contains(ua, "Android"):
+		return "Android"
+	case strings.Contains(ua, "CrOS"):
+		return "ChromeOS"
+	case strings.Contains(ua, "Windows"):
+		return "Windows"
+	case strings.Contains(ua, "Mac OS X"), strings.Contains(ua, "Macintosh"):
+		return "macOS"
+	case strings.Contains(ua, "Linux"):
+		return "Linux"
+	default:
+		return "Other"
+	}
+}
+
+func device(ua string) string {
+	switch {
+	case strings.Contains(ua, "iPad"), strings.Contains(ua, "Android") && !strings.Contains(ua, "Mobile"):
+		return "Tablet"
+	case strings.Contains(ua, "Mobi"), strings.Contains(ua, "iPhone"):
+		return "Mobile"
+	default:
+		return "Desktop"
+	}
+}